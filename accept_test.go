@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// negotiatingOrigin answers by the Accept header; without a Vary.
+func negotiatingOrigin(fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("Accept") == "application/xml" {
+			w.Write([]byte("<ok/>"))
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+}
+
+func getAccepting(proxy *Proxy, url, accept string) *http.Response {
+	httpRequest := newRequest("GET", url, "")
+	httpRequest.Header.Set("Accept", accept)
+	return serve(proxy, httpRequest)
+}
+
+func TestVaryOnAccept(t *testing.T) {
+	var fetches atomic.Int32
+	origin := negotiatingOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseCacheNameStyle(CacheNameURI).VaryOnAccept(true)
+
+	for i := 0; i < 2; i++ {
+		if got := readBody(t, getAccepting(proxy, origin.URL+"/api", "application/json")); got != `{"ok":true}` {
+			t.Errorf("JSON %d = %q", i, got)
+		}
+		if got := readBody(t, getAccepting(proxy, origin.URL+"/api", "application/xml")); got != "<ok/>" {
+			t.Errorf("XML %d = %q", i, got)
+		}
+	}
+
+	if files := entryFiles(t, root); len(files) != 2 {
+		t.Errorf("cache entries = %v; want one for each Accept", files)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want once for each Accept", n)
+	}
+}
+
+func TestVaryOnAcceptOff(t *testing.T) {
+	var fetches atomic.Int32
+	origin := negotiatingOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseCacheNameStyle(CacheNameURI)
+
+	readBody(t, getAccepting(proxy, origin.URL+"/api", "application/json"))
+	readBody(t, getAccepting(proxy, origin.URL+"/api", "application/xml"))
+
+	// Without a Vary the URL alone names the entry.
+	if files := entryFiles(t, root); len(files) != 1 {
+		t.Errorf("cache entries = %v; want one shared", files)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want 1", n)
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAgeHeaderFreshness(t *testing.T) {
+	for _, test := range []struct {
+		resident time.Duration
+		expired  bool
+	}{
+		{0, false},
+		{15 * time.Second, false},
+		{25 * time.Second, true},
+		{time.Minute, true},
+	} {
+		// Already 100s old upstream; so only 20s of the 120s are left.
+		storedAt := time.Now().Add(-test.resident)
+		response := LoadResponse(&http.Response{Header: http.Header{
+			"Age":           {"100"},
+			"Cache-Control": {"max-age=120"},
+			"Date":          {storedAt.UTC().Format(http.TimeFormat)},
+		}}, nil).MarkAsCached().SetStoredAt(storedAt)
+		response.proxy = NewProxy().snapshot()
+
+		expired := response.CacheExpired(func() *Response {
+			t.Fatalf("resident %v: revalidated an explicit lifetime", test.resident)
+			return nil
+		})
+		if expired != test.expired {
+			t.Errorf("resident %v: expired = %v; want %v", test.resident, expired, test.expired)
+		}
+	}
+}
+
+func TestStaleOnErrorByAge(t *testing.T) {
+	// Fresh for 10s by its Last-Modified; 90s stale by its Age.
+	var failing atomic.Bool
+	origin := failingOrigin(&failing, http.Header{
+		"Age":           {"100"},
+		"Last-Modified": {time.Now().Add(-100 * time.Second).UTC().Format(http.TimeFormat)},
+	})
+	defer origin.Close()
+
+	for max, want := range map[time.Duration]int{
+		time.Minute: http.StatusInternalServerError,
+		time.Hour:   http.StatusOK,
+	} {
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseStaleOnError(max)
+
+		failing.Store(false)
+		readBody(t, get(proxy, origin.URL+"/s"))
+
+		failing.Store(true)
+		response := get(proxy, origin.URL+"/s")
+		readBody(t, response)
+		if response.StatusCode != want {
+			t.Errorf("90s stale by Age under UseStaleOnError(%v) = %d; want %d", max, response.StatusCode, want)
+		}
+	}
+}
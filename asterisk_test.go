@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rawRequest sends the request line and headers to the server as they
+// are; so request targets a client would rewrite reach it intact.
+func rawRequest(t *testing.T, server *httptest.Server, message string) *http.Response {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprint(conn, message)
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	return response
+}
+
+// optionsServer lets the handler serve "OPTIONS *" itself; rather than
+// answering it for the server as net/http does by default.
+func optionsServer(handler http.Handler) *httptest.Server {
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.DisableGeneralOptionsHandler = true
+	server.Start()
+	return server
+}
+
+func TestOptionsAsteriskForm(t *testing.T) {
+	var mutex sync.Mutex
+	var targets []string
+	origin := optionsServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		targets = append(targets, r.Method+" "+r.RequestURI)
+		mutex.Unlock()
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.Header().Set("Cache-Control", "max-age=60")
+	}))
+	defer origin.Close()
+
+	server := optionsServer(NewProxy().UseCachePath(t.TempDir()))
+	defer server.Close()
+
+	host := strings.TrimPrefix(origin.URL, "http://")
+	for _, message := range []string{
+		// As received by a reverse proxy; twice, as it is never cached.
+		"OPTIONS * HTTP/1.1\r\nHost: " + host + "\r\n\r\n",
+		"OPTIONS * HTTP/1.1\r\nHost: " + host + "\r\n\r\n",
+		// The absolute-form without a path, as sent to a forward proxy.
+		"OPTIONS " + origin.URL + " HTTP/1.1\r\nHost: " + host + "\r\n\r\n",
+	} {
+		response := rawRequest(t, server, message)
+		if response.StatusCode != http.StatusOK || response.Header.Get("Allow") != "GET, OPTIONS" {
+			t.Errorf("%q = %d Allow %q; want the origin's answer", strings.Fields(message)[1], response.StatusCode, response.Header.Get("Allow"))
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if got := strings.Join(targets, "|"); got != "OPTIONS *|OPTIONS *|OPTIONS *" {
+		t.Errorf("origin saw %q; want every OPTIONS with the * target", got)
+	}
+}
+
+func TestTraceAtMaxForwards(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("TRACE at Max-Forwards 0 reached the origin")
+	}))
+	defer origin.Close()
+
+	httpRequest := newRequest("TRACE", origin.URL+"/t", "")
+	httpRequest.Header.Set("Max-Forwards", "0")
+	httpRequest.Header.Set("Authorization", "Bearer secret")
+	httpRequest.Header.Set("X-Echo", "me")
+
+	response := serve(NewProxy().UseCachePath(t.TempDir()), httpRequest)
+	body := readBody(t, response)
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "message/http" {
+		t.Errorf("TRACE = %d %q; want the proxy's message/http echo", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	uri, _ := url.Parse(origin.URL)
+	if !strings.Contains(body, "X-Echo: me") || strings.Contains(body, "secret") || !strings.Contains(body, uri.Host) {
+		t.Errorf("echo = %q; want the request less its credentials", body)
+	}
+}
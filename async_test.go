@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAsyncCacheWrites(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	// A cache write that takes until released; as on a slow disk.
+	var stored atomic.Int32
+	release := make(chan struct{})
+	proxy := NewProxy().UseCachePath(t.TempDir()).AsyncCacheWrites(true)
+	proxy.OnCacheStore(func(key string, size int64) {
+		<-release
+		stored.Add(1)
+	})
+
+	served := make(chan *http.Response)
+	go func() { served <- get(proxy, origin.URL+"/a") }()
+
+	select {
+	case response := <-served:
+		if body := readBody(t, response); body != "/a" {
+			t.Errorf("body = %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("the client was held up by the cache write")
+	}
+
+	if stored.Load() != 0 {
+		t.Error("stored before the write was released")
+	}
+
+	close(release)
+	waitFor(t, "the cache write", func() bool { return stored.Load() == 1 })
+
+	if body := readBody(t, get(proxy, origin.URL+"/a")); body != "/a" || fetches.Load() != 1 {
+		t.Errorf("second get = %q after %d fetches; want it cached", body, fetches.Load())
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrProxyAuthRequired is the error of the 407 answering requests
+// without valid credentials for RequireBasicAuth.
+var ErrProxyAuthRequired = errors.New("proxy: authentication required")
+
+// basicAuth holds the RequireBasicAuth realm and validator.
+type basicAuth struct {
+	realm    string
+	validate func(user, pass string) bool
+}
+
+// RequireBasicAuth requires ServeHTTP clients to send Basic credentials
+// for the proxy in Proxy-Authorization; validated by validate. Other
+// requests are answered with 407 Proxy Authentication Required.
+func (proxy *Proxy) RequireBasicAuth(
+	realm string, validate func(user, pass string) bool,
+) *Proxy {
+	defer proxy.configure()()
+	proxy.auth = &basicAuth{realm, validate}
+	return proxy
+}
+
+// authorize reports if the request has valid proxy credentials;
+// otherwise answering it with the 407 itself.
+func (proxy *Proxy) authorize(
+	writer http.ResponseWriter,
+	httpRequest *http.Request,
+) bool {
+	if proxy.auth == nil {
+		return true
+	}
+
+	if user, pass, ok := proxyBasicAuth(httpRequest); ok && proxy.auth.validate(user, pass) {
+		return true
+	}
+
+	proxyLog.WithFields(Fields{"realm": proxy.auth.realm}).Warning("Proxy Authentication Required")
+	response := newStatusResponse(
+		httpRequest, http.StatusProxyAuthRequired, ErrProxyAuthRequired,
+	)
+
+	// Set after loading; LoadResponse removes it as hop-by-hop.
+	response.proxied.Header.Set("Proxy-Authenticate", fmt.Sprintf(
+		"Basic realm=%q", proxy.auth.realm,
+	))
+
+	response.serve(writer)
+	return false
+}
+
+// proxyBasicAuth returns the Basic credentials of the
+// Proxy-Authorization header; as http.Request.BasicAuth.
+func proxyBasicAuth(httpRequest *http.Request) (user, pass string, ok bool) {
+	const prefix = "basic "
+
+	header := httpRequest.Header.Get("Proxy-Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return
+	}
+
+	user, pass, ok = strings.Cut(string(decoded), ":")
+	return
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireBasicAuth(t *testing.T) {
+	var forwarded string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("Proxy-Authorization")
+		w.Write([]byte("through"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).RequireBasicAuth(
+		"tests", func(user, pass string) bool { return user == "alice" && pass == "secret" },
+	)
+
+	basic := func(credentials string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	for _, test := range []struct {
+		name, header string
+		status       int
+	}{
+		{"missing", "", http.StatusProxyAuthRequired},
+		{"wrong", basic("alice:wrong"), http.StatusProxyAuthRequired},
+		{"malformed", "Basic !!!", http.StatusProxyAuthRequired},
+		{"correct", basic("alice:secret"), http.StatusOK},
+	} {
+		forwarded = ""
+		httpRequest := newRequest("GET", origin.URL+"/"+test.name, "")
+		if test.header != "" {
+			httpRequest.Header.Set("Proxy-Authorization", test.header)
+		}
+
+		response := serve(proxy, httpRequest)
+		body := readBody(t, response)
+		if response.StatusCode != test.status {
+			t.Errorf("%s credentials: status = %d; want %d", test.name, response.StatusCode, test.status)
+		}
+
+		if test.status == http.StatusProxyAuthRequired {
+			if got := response.Header.Get("Proxy-Authenticate"); got != `Basic realm="tests"` {
+				t.Errorf("%s credentials: Proxy-Authenticate = %q", test.name, got)
+			}
+		} else if body != "through" {
+			t.Errorf("%s credentials: body = %q; want through", test.name, body)
+		}
+
+		if forwarded != "" {
+			t.Errorf("%s credentials: Proxy-Authorization forwarded upstream", test.name)
+		}
+	}
+}
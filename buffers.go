@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"bytes"
+	"sync"
+)
+
+// BufferPool hands out the buffers used to hold response bodies.
+type BufferPool interface {
+	Get() *bytes.Buffer
+	Put(*bytes.Buffer)
+}
+
+// BodyBuffers is the BufferPool used by every Response;
+// replace it to plug in a custom pooling strategy.
+var BodyBuffers BufferPool = new(syncBufferPool)
+
+// maxPooledBuffer keeps unusually large bodies
+// from pinning their memory inside the pool.
+const maxPooledBuffer = 1 << 20
+
+type syncBufferPool struct {
+	pool sync.Pool
+}
+
+func (pool *syncBufferPool) Get() *bytes.Buffer {
+	if buffer, ok := pool.pool.Get().(*bytes.Buffer); ok {
+		return buffer
+	}
+
+	return new(bytes.Buffer)
+}
+
+func (pool *syncBufferPool) Put(buffer *bytes.Buffer) {
+	if buffer.Cap() > maxPooledBuffer {
+		return
+	}
+
+	buffer.Reset()
+	pool.pool.Put(buffer)
+}
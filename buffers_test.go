@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/op/go-logging"
+)
+
+func TestBufferPoolResets(t *testing.T) {
+	pool := new(syncBufferPool)
+	buffer := pool.Get()
+	buffer.WriteString("left over")
+	pool.Put(buffer)
+
+	if reused := pool.Get(); reused.Len() != 0 {
+		t.Errorf("pooled buffer holds %q", reused.String())
+	}
+}
+
+func TestPooledBodiesDoNotLeak(t *testing.T) {
+	bodies := map[string]string{
+		"/long":  strings.Repeat("secret ", 4096),
+		"/short": "ok",
+		"/empty": "",
+	}
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(bodies[r.URL.Path]))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	for round := 0; round < 3; round++ {
+		for _, path := range []string{"/long", "/short", "/empty", "/short"} {
+			if body := readBody(t, get(proxy, origin.URL+path)); body != bodies[path] {
+				t.Fatalf("round %d %s: body of %d bytes; want %d", round, path, len(body), len(bodies[path]))
+			}
+		}
+	}
+}
+
+func TestWriteToKeepsBodyReadable(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	response := proxy.Fetch(httptest.NewRequest("GET", origin.URL+"/a", nil))
+
+	recorder := httptest.NewRecorder()
+	response.WriteTo(recorder)
+	if body := recorder.Body.String(); body != "hello" {
+		t.Fatalf("written body = %q", body)
+	}
+
+	var again bytes.Buffer
+	response.WriteBodyTo(&again)
+	if again.String() != "hello" {
+		t.Errorf("body after WriteTo = %q", again.String())
+	}
+}
+
+// discardWriter is a http.ResponseWriter that drops what is written.
+type discardWriter http.Header
+
+func (writer discardWriter) Header() http.Header            { return http.Header(writer) }
+func (writer discardWriter) Write(data []byte) (int, error) { return len(data), nil }
+func (writer discardWriter) WriteHeader(int)                {}
+
+// allocatingPool is a BufferPool that never reuses a buffer.
+type allocatingPool struct{}
+
+func (allocatingPool) Get() *bytes.Buffer { return new(bytes.Buffer) }
+func (allocatingPool) Put(*bytes.Buffer)  {}
+
+func benchmarkServe(b *testing.B, pool BufferPool) {
+	defer func(pool BufferPool) { BodyBuffers = pool }(BodyBuffers)
+	BodyBuffers = pool
+
+	defer logging.SetLevel(logging.GetLevel("proxy"), "proxy")
+	logging.SetLevel(logging.ERROR, "proxy")
+
+	body := bytes.Repeat([]byte("x"), 64<<10)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		response := LoadResponse(&http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Cache-Control": {"no-store"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil)
+		response.serve(make(discardWriter))
+	}
+}
+
+func BenchmarkServePooled(b *testing.B)   { benchmarkServe(b, new(syncBufferPool)) }
+func BenchmarkServeUnpooled(b *testing.B) { benchmarkServe(b, allocatingPool{}) }
@@ -0,0 +1,564 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheMetaDir holds the requests of the cache entries under the
+// cache path; mirroring the names of the entries they belong to.
+const cacheMetaDir = ".meta"
+
+// cacheTempPrefix begins the names cache files are written under
+// before they are renamed to the names they are stored by.
+const cacheTempPrefix = ".tmp-"
+
+// createCacheFile creates the file the named entry is written to;
+// aside of the name, and renamed to it by storeCache once written,
+// so a partial entry is never found by this process or another.
+func createCacheFile(name string) (*os.File, error) {
+	return ioutil.TempFile(filepath.Dir(name), cacheTempPrefix)
+}
+
+// cacheTempFile reports if the name is of a cache file still written.
+func cacheTempFile(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), cacheTempPrefix)
+}
+
+// cacheRoot returns the cache path; "./cache" unless one is set.
+func cacheRoot(path string) string {
+	if path == "" {
+		return "./cache"
+	}
+
+	return path
+}
+
+// metaName returns the name the request of the named
+// cache entry is stored under; if it is within root.
+func metaName(root string, name string) (string, bool) {
+	rel, err := filepath.Rel(root, name)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return filepath.Join(root, cacheMetaDir, rel), true
+}
+
+// cacheReader returns a reader of the response stored in the cache
+// file; through gzip when it was written by CompressCacheFiles.
+func cacheReader(file *os.File) (reader *bufio.Reader, gzipped bool, err error) {
+	reader = bufio.NewReader(file)
+
+	// Written by CompressCacheFiles; gzip rather than "HTTP/".
+	magic, _ := reader.Peek(2)
+	if gzipped = bytes.Equal(magic, []byte{0x1f, 0x8b}); !gzipped {
+		return reader, false, nil
+	}
+
+	gzread, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return bufio.NewReader(gzread), true, nil
+}
+
+// CacheEntry describes a response stored in the cache.
+type CacheEntry struct {
+	Name       string
+	Size       int64
+	StoredAt   time.Time
+	AccessedAt time.Time
+
+	// body is the sum of the stored body it references under DedupeBodies.
+	body string
+}
+
+// cacheIndex keeps the cache entries in memory so hits are found
+// without walking the disk; in least recently used order for eviction.
+// It walks the cache path on first use and is kept in step with the
+// disk by the writes after; and by Has, those of other writers.
+type cacheIndex struct {
+	mutex   sync.RWMutex
+	root    string
+	entries map[string]*list.Element
+	lru     *list.List
+
+	// bodies counts the entries referencing each stored body.
+	bodies map[string]int
+}
+
+func newCacheIndex() *cacheIndex {
+	return new(cacheIndex)
+}
+
+// load walks root into the index unless it is already loaded; outside
+// the lock, so lookups carry on until the walked entries are swapped in.
+func (index *cacheIndex) load(root string) {
+	index.mutex.RLock()
+	loaded := index.entries != nil && index.root == root
+	index.mutex.RUnlock()
+
+	if loaded {
+		return
+	}
+
+	cacheLog.WithFields(Fields{"root": root}).Debug("Loading Cache Index")
+
+	// Read for the bodies they reference; only if any are stored.
+	_, err := os.Stat(filepath.Join(root, cacheBodyDir))
+	dedupe := err == nil
+
+	var entries []*CacheEntry
+	filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && cacheSkipDir(root, name) {
+			return filepath.SkipDir
+		}
+
+		if err != nil || info.IsDir() || cacheTempFile(name) {
+			return nil
+		}
+
+		entry := &CacheEntry{
+			Name:       name,
+			Size:       info.Size(),
+			StoredAt:   info.ModTime(),
+			AccessedAt: info.ModTime(),
+		}
+
+		if dedupe {
+			entry.body = entryBody(name)
+		}
+
+		entries = append(entries, entry)
+		return nil
+	})
+
+	// Without access times on disk; the oldest writes go first.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].StoredAt.Before(entries[j].StoredAt)
+	})
+
+	lru := list.New()
+	elements := make(map[string]*list.Element, len(entries))
+	bodies := make(map[string]int)
+	for _, entry := range entries {
+		elements[entry.Name] = lru.PushFront(entry)
+		if entry.body != "" {
+			bodies[entry.body]++
+		}
+	}
+
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	// Loaded by another caller meanwhile; theirs may have seen writes since.
+	if index.entries != nil && index.root == root {
+		return
+	}
+
+	index.root, index.entries, index.lru, index.bodies = root, elements, lru, bodies
+}
+
+// Has reports if the named entry is cached under root; one the index
+// doesn't know of is looked for on disk, and added if found, so those
+// written by other processes sharing the cache path are seen too.
+func (index *cacheIndex) Has(root string, name string) bool {
+	index.load(root)
+
+	index.mutex.RLock()
+	_, ok := index.entries[name]
+	index.mutex.RUnlock()
+
+	if ok {
+		return true
+	}
+
+	info, err := os.Stat(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	index.Add(&CacheEntry{
+		Name:     name,
+		Size:     info.Size(),
+		StoredAt: info.ModTime(),
+		body:     entryBody(name),
+	})
+
+	return true
+}
+
+// Add records the entry as the most recently used, replacing any
+// previous entry of the same name; whose stored body is returned if
+// no entry references it any longer, for release.
+func (index *cacheIndex) Add(entry *CacheEntry) (released string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if index.entries == nil {
+		return
+	}
+
+	if element, ok := index.entries[entry.Name]; ok {
+		index.lru.Remove(element)
+		released = index.unreference(element.Value.(*CacheEntry))
+	}
+
+	if entry.AccessedAt.IsZero() {
+		entry.AccessedAt = entry.StoredAt
+	}
+
+	if entry.body != "" {
+		index.bodies[entry.body]++
+	}
+
+	index.entries[entry.Name] = index.lru.PushFront(entry)
+	if released == entry.body {
+		released = ""
+	}
+
+	return
+}
+
+// unreference uncounts the stored body of the forgotten entry;
+// returning it if no entry references it any longer.
+func (index *cacheIndex) unreference(entry *CacheEntry) string {
+	if entry.body == "" {
+		return ""
+	}
+
+	if index.bodies[entry.body]--; index.bodies[entry.body] > 0 {
+		return ""
+	}
+
+	delete(index.bodies, entry.body)
+	return entry.body
+}
+
+// Reset forgets every entry; so the cache path is walked again.
+func (index *cacheIndex) Reset() {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	index.entries = nil
+	index.lru = nil
+	index.bodies = nil
+}
+
+// Touch marks the named entry as the most recently used.
+func (index *cacheIndex) Touch(name string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if element, ok := index.entries[name]; ok {
+		element.Value.(*CacheEntry).AccessedAt = time.Now()
+		index.lru.MoveToFront(element)
+	}
+}
+
+// Entries returns a copy of every entry; the most recently used first.
+func (index *cacheIndex) Entries() []CacheEntry {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	if index.lru == nil {
+		return nil
+	}
+
+	entries := make([]CacheEntry, 0, index.lru.Len())
+	for element := index.lru.Front(); element != nil; element = element.Next() {
+		entries = append(entries, *element.Value.(*CacheEntry))
+	}
+
+	return entries
+}
+
+// Remove forgets the named entry; returning its stored
+// body if no entry references it any longer, for release.
+func (index *cacheIndex) Remove(name string) (released string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if element, ok := index.entries[name]; ok {
+		index.lru.Remove(element)
+		delete(index.entries, name)
+		released = index.unreference(element.Value.(*CacheEntry))
+	}
+
+	return
+}
+
+// Evict forgets and returns the least recently used entries until at
+// most max are left; skipping those kept, which may leave more. The
+// stored bodies no entry references any longer are returned too.
+func (index *cacheIndex) Evict(
+	max int, keep func(name string) bool,
+) (evicted []*CacheEntry, released []string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if index.lru == nil {
+		return
+	}
+
+	for element := index.lru.Back(); element != nil && index.lru.Len() > max; {
+		previous := element.Prev()
+		entry := element.Value.(*CacheEntry)
+
+		if keep == nil || !keep(entry.Name) {
+			index.lru.Remove(element)
+			delete(index.entries, entry.Name)
+			evicted = append(evicted, entry)
+
+			if body := index.unreference(entry); body != "" {
+				released = append(released, body)
+			}
+		}
+
+		element = previous
+	}
+
+	return
+}
+
+// LoadCacheIndex walks the cache path into the index up front; as on
+// startup, rather than on the first request. Each entry is checked to
+// parse as a response, whether stored gzipped or as is, and those that
+// don't are deleted. It returns the error reading the cache path.
+func (proxy *Proxy) LoadCacheIndex() error {
+	proxy = proxy.snapshot()
+
+	root := cacheRoot(proxy.cachePath)
+	if _, err := os.Stat(root); err != nil && !os.IsNotExist(err) {
+		cacheLog.WithError(err).Error("Could Not Read Cache Path")
+		return err
+	}
+
+	if proxy.index == nil {
+		proxy.index = newCacheIndex()
+	}
+
+	proxy.index.Reset()
+	proxy.index.load(root)
+
+	referenced := make(map[string]bool)
+	for _, entry := range proxy.index.Entries() {
+		body, err := validCacheFile(root, entry.Name, proxy.entryMeta(root, entry.Name))
+		if err != nil {
+			cacheLog.WithFields(Fields{"name": entry.Name}).WithError(err).Warning("Discarding Invalid Cache Entry")
+
+			if err := proxy.removeCacheEntry(entry.Name); err != nil && !os.IsNotExist(err) {
+				cacheLog.WithError(err).Error("Could Not Remove Invalid Cache")
+			}
+
+			continue
+		}
+
+		if body != "" {
+			referenced[body] = true
+		}
+	}
+
+	pruneBodies(root, referenced)
+	return nil
+}
+
+// validCacheFile returns why the named cache file under root doesn't
+// parse as a response; nil when it does. The sum of the stored body it
+// references under DedupeBodies is returned too, if any; it must be the
+// Sum of the metadata, as storeBody records it.
+func validCacheFile(root string, name string, meta *CacheMetadata) (body string, err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	reader, _, err := cacheReader(file)
+	if err != nil {
+		return "", err
+	}
+
+	httpResponse, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return "", err
+	}
+
+	httpResponse.Body.Close()
+	if httpResponse.StatusCode < 100 || httpResponse.StatusCode > 599 {
+		return "", fmt.Errorf("proxy: invalid cached status %d", httpResponse.StatusCode)
+	}
+
+	if body = httpResponse.Header.Get(cacheBodyHeader); body != "" {
+		stored, ok := cacheBodyName(root, body)
+		if !ok {
+			return "", fmt.Errorf("proxy: invalid cached body %q", body)
+		}
+
+		if !bodyStoredFor(meta, body) {
+			return "", fmt.Errorf("proxy: cached body %q not stored for the entry", body)
+		}
+
+		if _, err := os.Stat(stored); err != nil {
+			return "", err
+		}
+	}
+
+	return body, nil
+}
+
+// evictCache deletes the least recently used cache
+// files beyond the limit of UseMaxCacheEntries.
+func (proxy *Proxy) evictCache() {
+	if proxy.index == nil || proxy.maxCacheEntries <= 0 {
+		return
+	}
+
+	root := cacheRoot(proxy.cachePath)
+	evicted, released := proxy.index.Evict(proxy.maxCacheEntries, proxy.pinned)
+	for _, entry := range evicted {
+		cacheLog.WithFields(Fields{"name": entry.Name}).Debug("Evicting Cache Entry")
+
+		if err := os.Remove(entry.Name); err != nil && !os.IsNotExist(err) {
+			cacheLog.WithError(err).Error("Could Not Evict Cache Entry")
+		}
+
+		if meta, ok := metaName(root, entry.Name); ok {
+			os.Remove(meta)
+		}
+
+		proxy.events.cacheEvicted(entry.Name)
+	}
+
+	proxy.index.release(root, released...)
+}
+
+// MigrateCache renames the entries cached under the from naming style
+// to their names under the to style (and the current UseCacheSharding);
+// recomputed from the request stored with each entry. Entries cached
+// without a stored request can't be renamed and are left as they are;
+// as are CacheNameSHA1 entries of requests with credentials, such as an
+// Authorization or Cookie, which are not stored.
+func (proxy *Proxy) MigrateCache(from CacheNameStyle, to CacheNameStyle) error {
+	proxy = proxy.snapshot()
+
+	root := cacheRoot(proxy.cachePath)
+	cacheLog.WithFields(Fields{"root": root, "from": from, "to": to}).Info("Migrating Cache")
+
+	var names []string
+	err := filepath.Walk(root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && cacheSkipDir(root, name) {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && !cacheTempFile(name) {
+			names = append(names, name)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		cacheLog.WithError(err).Error("Could Not Walk Cache")
+		return err
+	}
+
+	// The entries are moving; walk the cache path again on next use.
+	if proxy.index != nil {
+		defer proxy.index.Reset()
+	}
+
+	for _, name := range names {
+		if err := proxy.migrateCacheEntry(root, name, from, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateCacheEntry moves the named entry and its stored
+// request to the name of the request under the to style.
+func (proxy *Proxy) migrateCacheEntry(
+	root string, name string, from CacheNameStyle, to CacheNameStyle,
+) error {
+	meta, _ := metaName(root, name)
+	if _, err := os.Stat(meta); err != nil {
+		cacheLog.WithFields(Fields{"name": name}).Warning("No Stored Request To Migrate")
+		return nil
+	}
+
+	httpRequest, err := proxy.readMeta(meta)
+	if err != nil {
+		cacheLog.WithFields(Fields{"name": name}).WithError(err).Warning("Could Not Read Stored Request")
+		return nil
+	}
+
+	// The sharding may have changed since; so SHA1 names match by Sum.
+	named := proxy.cacheNameOf(httpRequest, from)
+	if named != name && (from != CacheNameSHA1 || filepath.Base(named) != filepath.Base(name)) {
+		cacheLog.WithFields(Fields{"name": name}).Debug("Not Named By Migrating Style")
+		return nil
+	}
+
+	target := proxy.cacheNameOf(httpRequest, to)
+	if target == name {
+		return nil
+	}
+
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		cacheLog.WithFields(Fields{"name": target}).Warning("Cache Name is a Directory")
+		return nil
+	}
+
+	targetMeta, _ := metaName(root, target)
+	for _, move := range [][2]string{{name, target}, {meta, targetMeta}} {
+		if err := os.MkdirAll(filepath.Dir(move[1]), 0700); err != nil {
+			cacheLog.WithFields(Fields{"name": move[1]}).WithError(err).Error("Cache Directory is not writeable!")
+			return err
+		}
+
+		if err := os.Rename(move[0], move[1]); err != nil {
+			cacheLog.WithFields(Fields{"name": move[0]}).WithError(err).Error("Could Not Migrate Cache Entry")
+			return err
+		}
+	}
+
+	cacheLog.WithFields(Fields{"from": name, "to": target}).Debug("Migrated Cache Entry")
+	return nil
+}
+
+// cacheNameOf returns the cache name of the request under the style.
+func (proxy *Proxy) cacheNameOf(
+	httpRequest *http.Request, style CacheNameStyle,
+) string {
+	request := LoadRequest(httpRequest).
+		SetCachePath(proxy.cachePath).
+		SetCacheNameStyle(style).
+		SetCacheSharding(proxy.cacheSharding)
+	request.proxy = proxy
+
+	if style == CacheNameURI && uriCacheable(httpRequest) {
+		request.SetCacheName(proxy.uriCacheName(httpRequest))
+	}
+
+	return request.CacheName()
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/op/go-logging"
+)
+
+// cacheOrigin answers every path with a fresh, cacheable body of it.
+func cacheOrigin(fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches != nil {
+			fetches.Add(1)
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.Path))
+	}))
+}
+
+// entryFiles returns the cache entries on disk; less the stored
+// requests and the bodies stored by DedupeBodies.
+func entryFiles(t *testing.T, root string) (names []string) {
+	t.Helper()
+
+	for _, name := range cacheFiles(t, root) {
+		if !strings.HasPrefix(name, filepath.Join(root, cacheMetaDir)+string(filepath.Separator)) &&
+			!strings.HasPrefix(name, filepath.Join(root, cacheBodyDir)+string(filepath.Separator)) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func TestCacheIndexMatchesDiskAfterEviction(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseMaxCacheEntries(2)
+	for _, path := range []string{"/a", "/b", "/c", "/a", "/d"} {
+		readBody(t, get(proxy, origin.URL+path))
+	}
+
+	var indexed []string
+	for _, entry := range proxy.index.Entries() {
+		indexed = append(indexed, entry.Name)
+	}
+	sort.Strings(indexed)
+
+	onDisk := entryFiles(t, root)
+	if strings.Join(indexed, "\n") != strings.Join(onDisk, "\n") {
+		t.Errorf("index %v; disk %v", indexed, onDisk)
+	}
+	if len(onDisk) != 2 {
+		t.Errorf("%d entries cached; want 2", len(onDisk))
+	}
+}
+
+func TestCacheIndexSeesOtherWriters(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	reader := NewProxy().UseCachePath(root)
+	writer := NewProxy().UseCachePath(root)
+
+	// The reader's index is loaded before the writer caches the entry;
+	// so it is only found by looking on disk.
+	reader.LoadCacheIndex()
+	readBody(t, get(writer, origin.URL+"/a"))
+
+	if body := readBody(t, get(reader, origin.URL+"/a")); body != "/a" {
+		t.Fatalf("body = %q", body)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want 1", n)
+	}
+}
+
+func TestLoadCacheIndexAfterRestart(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	// Stored as is, gzipped and (with its meta removed) as a legacy entry.
+	root := t.TempDir()
+	readBody(t, get(NewProxy().UseCachePath(root), origin.URL+"/plain"))
+	readBody(t, get(NewProxy().UseCachePath(root).CompressCacheFiles(true), origin.URL+"/gzipped"))
+	readBody(t, get(NewProxy().UseCachePath(root), origin.URL+"/legacy"))
+
+	entries := entryFiles(t, root)
+	if len(entries) != 3 {
+		t.Fatalf("cache entries = %q; want 3", entries)
+	}
+
+	for _, name := range entries {
+		meta, _ := metaName(root, name)
+		if stored, err := NewProxy().UseCachePath(root).readMeta(meta); err == nil &&
+			stored.URL.Path == "/legacy" {
+			os.Remove(meta)
+		}
+	}
+
+	garbage := filepath.Join(root, "garbage")
+	if err := ioutil.WriteFile(garbage, []byte("not a response"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh process; with nothing in memory but what it loads.
+	proxy := NewProxy().UseCachePath(root)
+	if err := proxy.LoadCacheIndex(); err != nil {
+		t.Fatalf("LoadCacheIndex: %v", err)
+	}
+
+	if _, err := os.Stat(garbage); !os.IsNotExist(err) {
+		t.Errorf("invalid entry was kept: %v", err)
+	}
+	if n := len(proxy.index.Entries()); n != 3 {
+		t.Errorf("index has %d entries; want 3", n)
+	}
+
+	fetched := fetches.Load()
+	for _, path := range []string{"/plain", "/gzipped", "/legacy"} {
+		if body := readBody(t, get(proxy, origin.URL+path)); body != path {
+			t.Errorf("%s: body = %q", path, body)
+		}
+	}
+
+	if n := fetches.Load() - fetched; n != 0 {
+		t.Errorf("origin fetched %d times after the restart; want all from the cache", n)
+	}
+}
+
+func benchmarkCacheMiss(b *testing.B, indexed bool) {
+	defer logging.SetLevel(logging.GetLevel("proxy"), "proxy")
+	logging.SetLevel(logging.ERROR, "proxy")
+
+	root := b.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+	if !indexed {
+		proxy.index = nil
+	}
+
+	request := proxy.prepareRequest(httptest.NewRequest("GET", "http://example.com/missing", nil))
+	name := request.FullCacheName()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		b.Fatalf("%s exists", name)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if request.loadCache(name) != nil {
+			b.Fatal("missing entry was loaded")
+		}
+	}
+}
+
+// An indexed miss makes no syscall; unindexed it opens the stored request and entry.
+func BenchmarkCacheMissIndexed(b *testing.B)   { benchmarkCacheMiss(b, true) }
+func BenchmarkCacheMissUnindexed(b *testing.B) { benchmarkCacheMiss(b, false) }
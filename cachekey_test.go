@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheKeyHeaders(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).CacheKeyHeaders("Accept-Language")
+
+	getWith := func(agent, language string) {
+		request := newRequest("GET", origin.URL+"/a", "")
+		request.Header.Set("User-Agent", agent)
+		request.Header.Set("Accept-Language", language)
+		readBody(t, serve(proxy, request))
+	}
+
+	// Differing only by the User-Agent, left out; so one entry.
+	getWith("curl/8.0", "en")
+	getWith("Mozilla/5.0", "en")
+	if fetches.Load() != 1 || len(entryFiles(t, root)) != 1 {
+		t.Errorf("origin fetched %d times for %d entries; want the one shared",
+			fetches.Load(), len(entryFiles(t, root)))
+	}
+
+	// By the included Accept-Language; another entry.
+	getWith("curl/8.0", "de")
+	if fetches.Load() != 2 || len(entryFiles(t, root)) != 2 {
+		t.Errorf("origin fetched %d times for %d entries; want another for the language",
+			fetches.Load(), len(entryFiles(t, root)))
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// bodyCapture keeps the first max bytes of a request body
+// as it is forwarded; for the CacheMetadata of its response.
+type bodyCapture struct {
+	mutex  sync.Mutex
+	max    int64
+	buffer bytes.Buffer
+}
+
+// Write keeps what fits within max; never failing the body read.
+func (capture *bodyCapture) Write(data []byte) (int, error) {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	if room := capture.max - int64(capture.buffer.Len()); room > 0 {
+		if int64(len(data)) > room {
+			capture.buffer.Write(data[:room])
+		} else {
+			capture.buffer.Write(data)
+		}
+	}
+
+	return len(data), nil
+}
+
+// Bytes returns a copy of the body captured so far.
+func (capture *bodyCapture) Bytes() []byte {
+	if capture == nil {
+		return nil
+	}
+
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+
+	if capture.buffer.Len() == 0 {
+		return nil
+	}
+
+	return append([]byte(nil), capture.buffer.Bytes()...)
+}
+
+// CaptureRequestBodies sets how many bytes of request bodies are kept
+// in the CacheMetadata of their cached responses (see ReadCacheMetadata);
+// for replaying or debugging them. Bodies are still forwarded whole.
+// Zero, the default, keeps none.
+//
+// Note: captured bodies are stored in clear, in .meta files readable
+// only by the owner (0600); keep them off a cache path others share.
+// They are stored only with responses that are cached, so the bodies
+// of requests failing upstream, or otherwise not cached, are not kept.
+func (proxy *Proxy) CaptureRequestBodies(max int64) *Proxy {
+	defer proxy.configure()()
+	proxy.captureBodies = max
+	return proxy
+}
+
+// captureBody tees the body of the request into a bodyCapture
+// of max bytes as it is read to be forwarded.
+func (request *Request) captureBody(max int64) {
+	request.traced(requestLog).WithFields(Fields{"max": max}).Debug("Capturing Request Body")
+	request.capture = &bodyCapture{max: max}
+	request.proxied.Body = readCloser{
+		io.TeeReader(request.proxied.Body, request.capture), request.proxied.Body,
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCaptureRequestBodies(t *testing.T) {
+	var fetches atomic.Int32
+	origin := postOrigin(&fetches)
+	defer origin.Close()
+
+	for _, test := range []struct {
+		max  int64
+		want string
+	}{
+		{8, "an event"},
+		{1024, "an event to replay"},
+		{0, ""},
+	} {
+		root := t.TempDir()
+		proxy := NewProxy().UseCachePath(root).
+			UseCacheableMethods("GET", "POST").CaptureRequestBodies(test.max)
+
+		// Forwarded whole, however much is captured.
+		response := serve(proxy, newRequest("POST", origin.URL+"/events", "an event to replay"))
+		if body := readBody(t, response); body != "POST an event to replay" {
+			t.Errorf("max %d: origin answered %q; want the whole body", test.max, body)
+		}
+
+		entries := entryFiles(t, root)
+		if len(entries) != 1 {
+			t.Fatalf("max %d: cache entries = %q; want 1", test.max, entries)
+		}
+
+		meta, err := proxy.ReadCacheMetadata(entries[0])
+		if err != nil {
+			t.Fatalf("max %d: ReadCacheMetadata: %v", test.max, err)
+		}
+		if meta.Method != "POST" || string(meta.Body) != test.want {
+			t.Errorf("max %d: captured %s %q; want POST %q", test.max, meta.Method, meta.Body, test.want)
+		}
+	}
+}
+
+func TestCaptureOnlyCachedBodies(t *testing.T) {
+	var failing atomic.Bool
+	origin := failingOrigin(&failing, http.Header{"Cache-Control": {"max-age=60"}})
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).
+		UseCacheableMethods("GET", "POST").CaptureRequestBodies(1024)
+
+	// Cached; its metadata, with the body in it, only for the owner.
+	readBody(t, serve(proxy, newRequest("POST", origin.URL+"/ok", "a secret")))
+	entries := entryFiles(t, root)
+	if len(entries) != 1 {
+		t.Fatalf("cache entries = %q; want 1", entries)
+	}
+
+	meta, _ := metaName(root, entries[0])
+	if info, err := os.Stat(meta); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("stat %s: %v, %v; want mode 0600", meta, info, err)
+	}
+
+	// Failed upstream; not cached, so its body isn't kept either.
+	failing.Store(true)
+	readBody(t, serve(proxy, newRequest("POST", origin.URL+"/failed", "another secret")))
+	if entries := entryFiles(t, root); len(entries) != 1 {
+		t.Errorf("cache entries = %q; want only the one cached", entries)
+	}
+}
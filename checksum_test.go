@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentMD5Verified(t *testing.T) {
+	sum := md5.Sum([]byte("hello"))
+	for _, test := range []struct {
+		md5    string
+		status int
+	}{
+		{base64.StdEncoding.EncodeToString(sum[:]), http.StatusOK},
+		{base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), http.StatusBadGateway},
+	} {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Content-MD5", test.md5)
+			w.Write([]byte("hello"))
+		}))
+
+		root := t.TempDir()
+		response := get(NewProxy().UseCachePath(root).VerifyChecksums(true), origin.URL+"/a")
+		body := readBody(t, response)
+		origin.Close()
+
+		if response.StatusCode != test.status {
+			t.Errorf("Content-MD5 %s: status %d; want %d", test.md5, response.StatusCode, test.status)
+		}
+		if test.status != http.StatusOK && (body == "hello" || len(entryFiles(t, root)) != 0) {
+			t.Errorf("Content-MD5 %s: mismatched body was served or cached", test.md5)
+		}
+	}
+}
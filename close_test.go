@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// connOrigin counts the connections the origin accepts and closes.
+func connOrigin(opened, closed *atomic.Int32) *httptest.Server {
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("hello"))
+	}))
+	origin.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			opened.Add(1)
+		case http.StateClosed:
+			closed.Add(1)
+		}
+	}
+
+	origin.Start()
+	return origin
+}
+
+func TestRespectConnectionClose(t *testing.T) {
+	for _, respect := range []bool{false, true} {
+		var opened, closed atomic.Int32
+		origin := connOrigin(&opened, &closed)
+
+		proxy := NewProxy(new(http.Transport)).UseCachePath(t.TempDir()).
+			RespectConnectionClose(respect)
+
+		for i := 0; i < 3; i++ {
+			request := newRequest("GET", origin.URL+"/a", "")
+			request.Close = true
+			readBody(t, serve(proxy, request))
+		}
+
+		// Closed after each response; else the one connection is reused.
+		want := int32(1)
+		if respect {
+			want = 3
+			waitFor(t, "the upstream connections to close", func() bool { return closed.Load() == 3 })
+		}
+
+		if opened.Load() != want {
+			t.Errorf("respect %v: origin accepted %d connections; want %d", respect, opened.Load(), want)
+		}
+
+		origin.Close()
+	}
+}
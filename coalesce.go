@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// coalescesMiss reports if, under CoalesceMisses, the request is a
+// plain GET of a name the cache index doesn't have; so concurrent ones
+// share a single fetch. Conditional, ranged and directed requests each
+// fetch their own.
+func (request *Request) coalescesMiss() bool {
+	index := request.proxy.index
+	if !request.proxy.coalesceMisses || index == nil || request.proxied.Method != "GET" ||
+		!request.proxy.cacheableMethod("GET") || !request.bodyCacheable() {
+		return false
+	}
+
+	for _, key := range append([]string{"Cache-Control", "Pragma"}, conditionalHeaders...) {
+		if request.proxied.Header.Get(key) != "" {
+			return false
+		}
+	}
+
+	return !index.Has(request.CachePath(), request.FullCacheName())
+}
+
+// fetchMiss fetches the request once for all those of its cache name
+// missing concurrently; each is served a duplicate of the response.
+// Only the first stores it; those not fit to be shared (see shareable)
+// are fetched again by each of the others.
+func (request *Request) fetchMiss(transport ...http.RoundTripper) *Response {
+	var own *Response
+	response, shared := request.proxy.misses.Do(request.FullCacheName(), func() *Response {
+		own = request.fetch(false, transport...)
+		if !own.shareable() {
+			return nil
+		}
+
+		own.copyBody()
+		return own
+	})
+
+	if response == nil {
+		if shared {
+			return request.fetch(false, transport...)
+		}
+
+		return own
+	}
+
+	duplicate := response.duplicate()
+	duplicate.coalesced = shared
+	if shared {
+		request.proxy.hits.record(false)
+		duplicate.requestID = request.requestID
+	}
+
+	return duplicate
+}
+
+// shareable reports if the response can be served to more than the
+// one client it was fetched for; fetched whole, free for a shared cache
+// to store, setting no cookie of its own and not varying by the request
+// headers (which those of the others may not match). Streams, and
+// bodies over the UseStreamThreshold or of an unknown length under one,
+// can be read only once.
+func (response *Response) shareable() bool {
+	if response.err != nil || response.Streaming() ||
+		response.proxied.StatusCode == http.StatusPartialContent ||
+		response.GetHeader("Set-Cookie") != "" || response.GetHeader("Vary") != "" {
+		return false
+	}
+
+	if threshold := response.proxy.streamThreshold; threshold > 0 && !response.cached {
+		if length := response.proxied.ContentLength; length < 0 || length > threshold {
+			return false
+		}
+	}
+
+	for _, key := range []string{"private", "no-cache", "no-store"} {
+		if _, yes := response.HasHeaderValue("Cache-Control", key); yes {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCoalescedMissesNotShareable(t *testing.T) {
+	const n = 4
+
+	for _, header := range []http.Header{
+		{"Cache-Control": {"no-store"}},
+		{"Cache-Control": {"private, max-age=60"}},
+		{"Cache-Control": {"max-age=60"}, "Content-Type": {"text/event-stream"}},
+		{"Cache-Control": {"max-age=60"}, "Vary": {"*"}},
+	} {
+		var fetches atomic.Int32
+		release := make(chan struct{})
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetch := fetches.Add(1)
+			if fetch == 1 {
+				<-release
+			}
+
+			CopyHeaders(header, w.Header())
+			w.Write([]byte(strconv.Itoa(int(fetch))))
+		}))
+		defer origin.Close()
+
+		proxy := NewProxy().UseCachePath(t.TempDir()).CoalesceMisses(true)
+
+		var wg sync.WaitGroup
+		bodies := make(chan string, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				bodies <- readBody(t, get(proxy, origin.URL+"/page"))
+			}()
+		}
+
+		waitFor(t, "the misses to join", func() bool { return proxy.Stats().Coalesced == n-1 })
+		close(release)
+		wg.Wait()
+		close(bodies)
+
+		// Each fetched its own; none was served another's.
+		seen := make(map[string]bool)
+		for body := range bodies {
+			if seen[body] {
+				t.Errorf("%v: body %q served twice", header, body)
+			}
+			seen[body] = true
+		}
+
+		if got := fetches.Load(); got != n {
+			t.Errorf("%v: origin fetched %d times; want %d", header, got, n)
+		}
+	}
+}
+
+func TestShareableVary(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/varies" {
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).CoalesceMisses(true)
+
+	// Another's Accept-Language may not match; so it's not theirs to share.
+	for path, want := range map[string]bool{"/varies": false, "/same": true} {
+		response := proxy.Fetch(newRequest("GET", origin.URL+path, ""))
+		if shareable := response.shareable(); shareable != want {
+			t.Errorf("%s shareable = %v; want %v", path, shareable, want)
+		}
+		response.proxied.Body.Close()
+	}
+}
+
+func TestMissesNotCoalescedByDefault(t *testing.T) {
+	const n = 4
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readBody(t, get(proxy, origin.URL+"/cold"))
+		}()
+	}
+
+	// Each reaches the origin; none waits on another.
+	waitFor(t, "each miss to be fetched", func() bool { return fetches.Load() == n })
+	close(release)
+	wg.Wait()
+
+	if stats := proxy.Stats(); stats.Coalesced != 0 {
+		t.Errorf("Coalesced = %d; want none without CoalesceMisses", stats.Coalesced)
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheNameCollisionIsMiss(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+	readBody(t, get(proxy, origin.URL+"/first"))
+
+	files := entryFiles(t, root)
+	if len(files) != 1 {
+		t.Fatalf("cache entries = %v; want the first", files)
+	}
+
+	messages, restore := captureLogs()
+	defer restore()
+
+	// Another URL forced onto the name of the first.
+	response := proxy.prepareRequest(newRequest("GET", origin.URL+"/second", "")).
+		SetCacheName(strings.TrimPrefix(files[0], root)).
+		Fetch()
+
+	if line := findLog(messages(), "Cache Name Collision"); !strings.Contains(line, "/second") {
+		t.Errorf("collision log = %q; want it naming the request", line)
+	}
+
+	var body bytes.Buffer
+	response.WriteBodyTo(&body)
+	if body.String() != "/second" {
+		t.Errorf("colliding request served %q; want its own response", body.String())
+	}
+	if response.cached {
+		t.Error("colliding request served from cache")
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want the collision fetched", n)
+	}
+}
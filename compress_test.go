@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func compressOrigin(fetches *atomic.Int32, contentType string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(strings.Repeat("compressible "+r.URL.Path+" ", 2048)))
+	}))
+}
+
+// cacheFileOf returns the one cache file under root.
+func cacheFileOf(t *testing.T, root string) []byte {
+	t.Helper()
+
+	files := entryFiles(t, root)
+	if len(files) != 1 {
+		t.Fatalf("cache entries = %v; want one", files)
+	}
+
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("reading cache file: %v", err)
+	}
+
+	return data
+}
+
+func TestCompressCacheFiles(t *testing.T) {
+	var fetches atomic.Int32
+	origin := compressOrigin(&fetches, "text/plain")
+	defer origin.Close()
+
+	want := strings.Repeat("compressible /c ", 2048)
+
+	plainRoot, gzipRoot := t.TempDir(), t.TempDir()
+	readBody(t, get(NewProxy().UseCachePath(plainRoot), origin.URL+"/c"))
+
+	proxy := NewProxy().UseCachePath(gzipRoot).CompressCacheFiles(true)
+	readBody(t, get(proxy, origin.URL+"/c"))
+
+	plain, gzipped := cacheFileOf(t, plainRoot), cacheFileOf(t, gzipRoot)
+	if !bytes.HasPrefix(gzipped, []byte{0x1f, 0x8b}) {
+		t.Error("cache file is not gzipped")
+	}
+	if len(gzipped)*4 > len(plain) {
+		t.Errorf("gzipped cache file is %d bytes; plain %d", len(gzipped), len(plain))
+	}
+
+	// Served from the gzipped file; and read even once compression is off.
+	for _, proxy := range []*Proxy{proxy, proxy.CompressCacheFiles(false)} {
+		if got := readBody(t, get(proxy, origin.URL+"/c")); got != want {
+			t.Errorf("body from the gzipped cache is %d bytes; want %d", len(got), len(want))
+		}
+	}
+
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want once for each cache", n)
+	}
+}
+
+func TestCompressCacheFilesExcept(t *testing.T) {
+	var fetches atomic.Int32
+	origin := compressOrigin(&fetches, "image/png")
+	defer origin.Close()
+
+	root := t.TempDir()
+	readBody(t, get(NewProxy().UseCachePath(root).CompressCacheFiles(true), origin.URL+"/p"))
+
+	if bytes.HasPrefix(cacheFileOf(t, root), []byte{0x1f, 0x8b}) {
+		t.Error("already compressed image/png was gzipped")
+	}
+}
+
+func TestCompressCacheExceptTypes(t *testing.T) {
+	gzipped := func(proxy *Proxy, contentType string) bool {
+		var fetches atomic.Int32
+		origin := compressOrigin(&fetches, contentType)
+		defer origin.Close()
+
+		root := t.TempDir()
+		readBody(t, get(proxy.UseCachePath(root), origin.URL+"/e"))
+		return bytes.HasPrefix(cacheFileOf(t, root), []byte{0x1f, 0x8b})
+	}
+
+	for _, test := range []struct {
+		except      []string
+		contentType string
+		want        bool
+	}{
+		{nil, "image/jpeg", false},
+		{nil, "text/html; charset=utf-8", true},
+		{[]string{"text/"}, "text/html; charset=utf-8", false},
+		{[]string{"text/"}, "image/jpeg", true},
+		{[]string{"Application/JSON"}, "application/json", false},
+	} {
+		proxy := NewProxy().CompressCacheFiles(true)
+		if test.except != nil {
+			proxy.CompressCacheExcept(test.except...)
+		}
+
+		if got := gzipped(proxy, test.contentType); got != test.want {
+			t.Errorf("except %q: %s gzipped = %v; want %v", test.except, test.contentType, got, test.want)
+		}
+	}
+}
+
+func TestRangeFromCompressedCache(t *testing.T) {
+	var fetches atomic.Int32
+	origin := compressOrigin(&fetches, "text/plain")
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).CompressCacheFiles(true)
+	whole := readBody(t, get(proxy, origin.URL+"/r"))
+
+	if data := cacheFileOf(t, root); !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		t.Fatal("cache file is not gzipped")
+	}
+
+	for _, test := range []struct {
+		ranges       string
+		start, end   int
+		contentRange string
+	}{
+		{"bytes=100-199", 100, 200, "bytes 100-199/"},
+		{"bytes=10000-", 10000, len(whole), "bytes 10000-"},
+		{"bytes=-50", len(whole) - 50, len(whole), "bytes "},
+	} {
+		response := getRange(proxy, origin.URL+"/r", test.ranges)
+		got := readBody(t, response)
+		if response.StatusCode != http.StatusPartialContent || got != whole[test.start:test.end] {
+			t.Errorf("%s = %d %q; want 206 of the decompressed body", test.ranges, response.StatusCode, got)
+		}
+
+		if value := response.Header.Get("Content-Range"); !strings.HasPrefix(value, test.contentRange) ||
+			!strings.HasSuffix(value, "/"+strconv.Itoa(len(whole))) {
+			t.Errorf("%s: Content-Range = %q", test.ranges, value)
+		}
+
+		if value := response.Header.Get("Content-Encoding"); value != "" {
+			t.Errorf("%s: Content-Encoding = %q; want the body as the origin sent it", test.ranges, value)
+		}
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want the ranges served from the cache", fetches.Load())
+	}
+}
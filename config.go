@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DumpConfig returns the effective settings of the Proxy, for
+// troubleshooting; functions are only reported as being set.
+func (proxy *Proxy) DumpConfig() map[string]interface{} {
+	proxy = proxy.snapshot()
+
+	style := "sha1"
+	if proxy.cacheNameStyle == CacheNameURI {
+		style = "uri"
+	}
+
+	transport := "*http.Transport (http.DefaultTransport)"
+	if proxy.transport != nil {
+		transport = fmt.Sprintf("%T", proxy.transport)
+	}
+
+	http2 := map[http2Setting]string{
+		http2Default:  "default",
+		http2Forced:   "forced",
+		http2Disabled: "disabled",
+	}[proxy.http2]
+
+	ttls := make(map[string]time.Duration)
+	for prefix, ttl := range proxy.ttlByContentType {
+		ttls[prefix] = ttl
+	}
+
+	sockets := make(map[string]string)
+	for host, socket := range proxy.unixSockets {
+		sockets[host] = socket
+	}
+
+	methods := []string{"GET"}
+	if proxy.cacheableMethods != nil {
+		methods = methods[:0]
+		for method := range proxy.cacheableMethods {
+			methods = append(methods, method)
+		}
+
+		sort.Strings(methods)
+	}
+
+	compressExcept := proxy.compressExcept
+	if compressExcept == nil {
+		compressExcept = DefaultCompressCacheExcept
+	}
+
+	rewriters := []string{}
+	for _, rewriter := range proxy.rewriters {
+		rewriters = append(rewriters, rewriter.prefix)
+	}
+
+	config := map[string]interface{}{
+		"cache-path":          cacheRoot(proxy.cachePath),
+		"cache-name-style":    style,
+		"cache-sharding":      proxy.cacheSharding,
+		"vary-on-accept":      proxy.varyOnAccept,
+		"cache-partition":     proxy.partition != nil,
+		"compress-cache":      proxy.compressCache,
+		"compress-except":     compressExcept,
+		"dedupe-bodies":       proxy.dedupeBodies,
+		"metadata-codec":      fmt.Sprintf("%T", proxy.metadataCodec()),
+		"capture-bodies":      proxy.captureBodies,
+		"redirect-bodies":     proxy.redirectBodies,
+		"cacheable-methods":   methods,
+		"cache-body-limit":    proxy.cacheBodyLimit,
+		"cache-key-headers":   proxy.cacheKeyHeaders,
+		"cache-poison-guard":  proxy.poisonGuard,
+		"private-cache":       proxy.privateCache,
+		"default-file":        proxy.defaultFile,
+		"ignore-query-params": proxy.ignoreParams,
+		"only-query-params":   proxy.onlyParams,
+		"max-cache-entries":   proxy.maxCacheEntries,
+		"retention-ttl":       proxy.retentionTTL(),
+		"ttl-by-content-type": ttls,
+		"max-ttl":             proxy.maxTTL,
+		"custom-ttl-header":   proxy.customTTLHeader,
+		"stale-on-error":      proxy.staleOnError,
+		"refresh-date":        proxy.refreshDate,
+		"fallback-status":     0,
+		"validator":           proxy.validator != nil,
+		"keep-set-cookie":     proxy.keepSetCookie,
+		"verify-checksums":    proxy.verifyChecksums,
+		"verify-integrity":    proxy.verifyIntegrity,
+		"add-content-sha1":    proxy.addContentSHA1,
+		"sniff-content-type":  proxy.sniffType,
+		"body-rewriters":      rewriters,
+		"answer-expect":       proxy.answerExpect,
+		"forward-tls-info":    proxy.forwardTLS,
+		"respect-close":       proxy.respectClose,
+		"collapse-slashes":    proxy.collapseSlashes,
+		"transport":           transport,
+		"middleware":          len(proxy.middleware),
+		"http2":               http2,
+		"auto-decompress":     !proxy.noDecompress,
+		"accept-encoding":     proxy.acceptEncoding,
+		"preserve-proto":      proxy.preserveProto,
+		"upstream-scheme":     proxy.upstreamScheme,
+		"unix-sockets":        sockets,
+		"keep-alive":          proxy.keepAlive,
+		"write-timeout":       proxy.writeTimeout,
+		"body-read-timeout":   proxy.bodyReadTimeout,
+		"slow-request-log":    proxy.slowThreshold,
+		"max-header-bytes":    proxy.maxHeaderBytes,
+		"stream-threshold":    proxy.streamThreshold,
+		"async-cache-writes":  proxy.asyncCache,
+		"coalesce-misses":     proxy.coalesceMisses,
+		"via-name":            proxy.viaName,
+		"request-id-header":   proxy.requestIDHeader,
+		"status-page":         proxy.statusPath,
+		"server-timing":       proxy.serverTiming,
+		"allow-hosts":         proxy.allowHosts,
+		"deny-hosts":          proxy.denyHosts,
+		"har":                 "",
+		"basic-auth-realm":    "",
+		"max-fetches":         0,
+		"max-queued-fetches":  0,
+		"retry-max":           0,
+		"retry-base":          time.Duration(0),
+		"idempotency-key":     "",
+		"idempotency-window":  time.Duration(0),
+	}
+
+	if proxy.har != nil {
+		config["har"] = proxy.har.path
+	}
+
+	if proxy.fallback != nil {
+		config["fallback-status"] = proxy.fallback.status
+	}
+
+	if proxy.auth != nil {
+		config["basic-auth-realm"] = proxy.auth.realm
+	}
+
+	if fetches := proxy.fetches; fetches != nil {
+		config["max-fetches"] = cap(fetches.running)
+		config["max-queued-fetches"] = cap(fetches.admitted) - cap(fetches.running)
+	}
+
+	if keys := proxy.idempotency; keys != nil {
+		config["idempotency-key"] = keys.header
+		config["idempotency-window"] = keys.window
+	}
+
+	if retry := proxy.retry; retry != nil {
+		config["retry-max"] = retry.max
+		config["retry-base"] = retry.base
+	}
+
+	return config
+}
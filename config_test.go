@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDumpConfig(t *testing.T) {
+	root := t.TempDir()
+	proxy := NewProxy().
+		UseCachePath(root).
+		UseCacheNameStyle(CacheNameURI).
+		UseMaxCacheEntries(10).
+		UseTTLByContentType(map[string]time.Duration{"text/html": time.Minute}).
+		UseCacheableMethods("GET", "POST").
+		UseMaxConcurrentFetches(4, 2).
+		UseWriteTimeout(time.Second).
+		UseViaName("edge")
+
+	config := proxy.DumpConfig()
+	for key, want := range map[string]interface{}{
+		"cache-path":          cacheRoot(root),
+		"cache-name-style":    "uri",
+		"max-cache-entries":   10,
+		"ttl-by-content-type": map[string]time.Duration{"text/html": time.Minute},
+		"cacheable-methods":   []string{"GET", "POST"},
+		"max-fetches":         4,
+		"max-queued-fetches":  2,
+		"write-timeout":       time.Second,
+		"via-name":            "edge",
+		"validator":           false,
+		"transport":           "*http.Transport (http.DefaultTransport)",
+	} {
+		if got := config[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v; want %#v", key, got, want)
+		}
+	}
+}
+
+func TestDumpConfigReadOnly(t *testing.T) {
+	proxy := NewProxy().UseTTLByContentType(map[string]time.Duration{"text/html": time.Minute})
+
+	proxy.DumpConfig()["ttl-by-content-type"].(map[string]time.Duration)["text/html"] = time.Hour
+	if got := proxy.DumpConfig()["ttl-by-content-type"]; !reflect.DeepEqual(got, map[string]time.Duration{"text/html": time.Minute}) {
+		t.Errorf("ttl-by-content-type after changing a dump = %v", got)
+	}
+}
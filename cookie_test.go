@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetCookieStrippedFromCache(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Add("Set-Cookie", "session=1")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	for _, strip := range []bool{true, false} {
+		proxy := NewProxy().UseCachePath(t.TempDir()).StripSetCookieOnCache(strip)
+
+		fresh := get(proxy, origin.URL+"/a")
+		readBody(t, fresh)
+		if fresh.Header.Get("Set-Cookie") != "session=1" {
+			t.Errorf("strip %v: fresh fetch lacks its cookie: %v", strip, fresh.Header)
+		}
+
+		cached := get(proxy, origin.URL+"/a")
+		if body := readBody(t, cached); body != "hello" {
+			t.Fatalf("strip %v: cached body = %q", strip, body)
+		}
+		if got := cached.Header.Get("Set-Cookie"); (got == "") != strip {
+			t.Errorf("strip %v: cached copy has Set-Cookie %q", strip, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCustomTTLHeader(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("X-Cache-TTL", "60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseCustomTTLHeader("x-cache-ttl")
+
+	for i := 0; i < 2; i++ {
+		response := get(proxy, origin.URL+"/a")
+		if value := response.Header.Get("X-Cache-TTL"); value != "" {
+			t.Errorf("get %d: X-Cache-TTL = %q reached the client", i, value)
+		}
+		readBody(t, response)
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want the entry fresh over max-age=0", fetches.Load())
+	}
+}
+
+func TestCustomTTLFreshness(t *testing.T) {
+	for _, test := range []struct {
+		resident time.Duration
+		expired  bool
+	}{
+		{0, false},
+		{50 * time.Second, false},
+		{70 * time.Second, true},
+	} {
+		storedAt := time.Now().Add(-test.resident)
+		response := LoadResponse(&http.Response{Header: http.Header{
+			"X-Cache-Ttl": {"60"},
+			"Date":        {storedAt.UTC().Format(http.TimeFormat)},
+		}}, nil).MarkAsCached().SetStoredAt(storedAt)
+		response.proxy = NewProxy().UseCustomTTLHeader("X-Cache-TTL").snapshot()
+
+		expired := response.CacheExpired(func() *Response {
+			t.Fatalf("resident %v: revalidated a custom TTL", test.resident)
+			return nil
+		})
+		if expired != test.expired {
+			t.Errorf("resident %v: expired = %v; want %v", test.resident, expired, test.expired)
+		}
+	}
+}
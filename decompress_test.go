@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// gzipOrigin sends a gzipped body to requests accepting gzip;
+// recording the Accept-Encoding of the last one.
+func gzipOrigin(acceptEncoding *atomic.Value, body string) *httptest.Server {
+	var compressed bytes.Buffer
+	gzwrite := gzip.NewWriter(&compressed)
+	gzwrite.Write([]byte(body))
+	gzwrite.Close()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding.Store(r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Cache-Control", "max-age=60")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(compressed.Bytes())
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestDisableAutoDecompress(t *testing.T) {
+	var acceptEncoding atomic.Value
+	body := strings.Repeat("kept compressed ", 512)
+	origin := gzipOrigin(&acceptEncoding, body)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DisableAutoDecompress(true)
+
+	// From the origin; then from the cache.
+	for i := 0; i < 2; i++ {
+		httpRequest := newRequest("GET", origin.URL+"/z", "")
+		httpRequest.Header.Set("Accept-Encoding", "gzip")
+		response := serve(proxy, httpRequest)
+
+		if got := response.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("served %d Content-Encoding = %q; want gzip", i, got)
+		}
+
+		gzread, err := gzip.NewReader(response.Body)
+		if err != nil {
+			t.Fatalf("served %d body is not gzipped: %v", i, err)
+		}
+		if uncompressed, _ := ioutil.ReadAll(gzread); string(uncompressed) != body {
+			t.Errorf("served %d body ungzips to %d bytes; want %d", i, len(uncompressed), len(body))
+		}
+	}
+
+	if got := acceptEncoding.Load(); got != "gzip" {
+		t.Errorf("origin saw Accept-Encoding %q; want the client's", got)
+	}
+
+	cached := cacheFileOf(t, root)
+	if !bytes.Contains(cached, []byte("Content-Encoding: gzip")) || bytes.Contains(cached, []byte("kept compressed")) {
+		t.Error("cache file does not hold the gzipped body")
+	}
+}
+
+func TestAutoDecompressByDefault(t *testing.T) {
+	var acceptEncoding atomic.Value
+	body := strings.Repeat("ungzipped ", 512)
+	origin := gzipOrigin(&acceptEncoding, body)
+	defer origin.Close()
+
+	// The transport asks for gzip itself; and ungzips it.
+	response := get(NewProxy().UseCachePath(t.TempDir()), origin.URL+"/z")
+	if got := readBody(t, response); got != body || response.Header.Get("Content-Encoding") != "" {
+		t.Errorf("served %d bytes with Content-Encoding %q; want them ungzipped", len(got), response.Header.Get("Content-Encoding"))
+	}
+	if got := acceptEncoding.Load(); got != "gzip" {
+		t.Errorf("origin saw Accept-Encoding %q; want the transport's gzip", got)
+	}
+}
+
+func TestUpstreamAcceptEncoding(t *testing.T) {
+	var acceptEncoding atomic.Value
+	body := strings.Repeat("cached compressed ", 512)
+	origin := gzipOrigin(&acceptEncoding, body)
+	defer origin.Close()
+
+	// Over the client's gzip; and cached as the origin sent it.
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DisableAutoDecompress(true).
+		UseUpstreamAcceptEncoding("gzip, br")
+
+	httpRequest := newRequest("GET", origin.URL+"/z", "")
+	httpRequest.Header.Set("Accept-Encoding", "br;q=0.5, gzip")
+	response := serve(proxy, httpRequest)
+
+	if got := acceptEncoding.Load(); got != "gzip, br" {
+		t.Errorf("origin saw Accept-Encoding %q; want gzip, br", got)
+	}
+	if got := response.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("served Content-Encoding = %q; want gzip", got)
+	}
+
+	cached := cacheFileOf(t, root)
+	if !bytes.Contains(cached, []byte("Content-Encoding: gzip")) || bytes.Contains(cached, []byte("cached compressed")) {
+		t.Error("cache file does not hold the gzipped body")
+	}
+}
+
+func TestUpstreamAcceptEncodingUnaccepted(t *testing.T) {
+	var acceptEncoding atomic.Value
+	body := strings.Repeat("served plain ", 512)
+	origin := gzipOrigin(&acceptEncoding, body)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).DisableAutoDecompress(true).
+		UseUpstreamAcceptEncoding("gzip, br")
+
+	// The client's is kept; it can't read what it didn't ask for.
+	for path, accept := range map[string]string{"/identity": "identity", "/gzip": "gzip", "/refused": "gzip, br;q=0"} {
+		httpRequest := newRequest("GET", origin.URL+path, "")
+		httpRequest.Header.Set("Accept-Encoding", accept)
+		response := serve(proxy, httpRequest)
+
+		if got := acceptEncoding.Load(); got != accept {
+			t.Errorf("%s: origin saw Accept-Encoding %q; want the client's %q", path, got, accept)
+		}
+		if got := readBody(t, response); path == "/identity" && got != body {
+			t.Errorf("%s: served %d bytes; want the %d plain", path, len(got), len(body))
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// cacheBodyDir holds the bodies stored once by DedupeBodies
+// under the cache path; each named by its hex SHA-256.
+const cacheBodyDir = ".bodies"
+
+// cacheBodyHeader names the stored body of a deduplicated cache entry;
+// which is written without a body of its own. Any sent by the origin
+// is dropped before it is cached (see cacheHeader).
+const cacheBodyHeader = "X-Go-Proxy-Body"
+
+// DedupeBodies sets whether cached bodies are stored by their SHA-256
+// under the cache path, with the entries only referencing them; so the
+// byte identical bodies of different URLs are stored once. Bodies no
+// longer referenced are deleted with the last entry referencing them
+// (as counted by the cache index), and by LoadCacheIndex. Streamed bodies
+// (see UseStreamThreshold) are stored with their entries as before.
+func (proxy *Proxy) DedupeBodies(dedupe bool) *Proxy {
+	defer proxy.configure()()
+	proxy.dedupeBodies = dedupe
+	return proxy
+}
+
+// cacheBodyName returns the name the body of the sum is stored
+// under in the cache path root; if the sum is a SHA-256 at all.
+func cacheBodyName(root string, sum string) (string, bool) {
+	if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != 32 {
+		return "", false
+	}
+
+	return filepath.Join(root, cacheBodyDir, sum), true
+}
+
+// cacheSkipDir reports if the directory under the cache path root
+// holds something other than cache entries; for walking it.
+func cacheSkipDir(root string, name string) bool {
+	return name == filepath.Join(root, cacheMetaDir) ||
+		name == filepath.Join(root, cacheBodyDir)
+}
+
+// storeBody writes the buffered body to the cache path by its sum;
+// unless it is already stored. The stored response is made to
+// reference it instead of carrying the body itself.
+func (response *Response) storeBody(stored *http.Response) error {
+	name, ok := cacheBodyName(response.cachePath, response.sum)
+	if !ok {
+		return nil
+	}
+
+	if _, err := os.Stat(name); os.IsNotExist(err) {
+		response.traced(cacheLog).WithFields(Fields{"name": name}).Debug("Storing Cached Body")
+
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			return err
+		}
+
+		// Written aside and renamed; so a partial body is never referenced.
+		temp, err := ioutil.TempFile(filepath.Dir(name), cacheTempPrefix)
+		if err != nil {
+			return err
+		}
+
+		_, err = temp.Write(response.body.Bytes())
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err == nil {
+			err = os.Rename(temp.Name(), name)
+		}
+
+		if err != nil {
+			os.Remove(temp.Name())
+			return err
+		}
+	} else {
+		response.traced(cacheLog).WithFields(Fields{"name": name}).Debug("Cached Body Already Stored")
+	}
+
+	stored.Body = http.NoBody
+	stored.ContentLength = 0
+	stored.Header.Set(cacheBodyHeader, response.sum)
+	response.storedBody = response.sum
+	return nil
+}
+
+// bodyStoredFor reports if the body of the sum was stored for the
+// cache entry of the metadata by storeBody; which records it as the
+// Sum. A reference the entry has otherwise is never honoured.
+func bodyStoredFor(meta *CacheMetadata, sum string) bool {
+	return meta != nil && meta.Sum == sum
+}
+
+// openBody opens the stored body the deduplicated cached response
+// references; setting its length. It returns nil if the body is gone,
+// or wasn't stored for the entry of the metadata.
+func (request *Request) openBody(httpResponse *http.Response, meta *CacheMetadata) *os.File {
+	sum := httpResponse.Header.Get(cacheBodyHeader)
+	name, ok := cacheBodyName(request.CachePath(), sum)
+	if !ok {
+		return nil
+	}
+
+	if !bodyStoredFor(meta, sum) {
+		request.traced(cacheLog).WithFields(Fields{"name": name}).Warning("Cached Body Not Stored For Entry")
+		return nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		request.traced(cacheLog).WithFields(Fields{"name": name}).WithError(err).Warning("Could Not Open Cached Body")
+		return nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil
+	}
+
+	httpResponse.Header.Del(cacheBodyHeader)
+	httpResponse.ContentLength = info.Size()
+	httpResponse.Header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	return file
+}
+
+// entryBody returns the sum of the stored body the named cache
+// file references under DedupeBodies; empty if it has none.
+func entryBody(name string) string {
+	file, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+
+	defer file.Close()
+
+	reader, _, err := cacheReader(file)
+	if err != nil {
+		return ""
+	}
+
+	httpResponse, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return ""
+	}
+
+	httpResponse.Body.Close()
+	return httpResponse.Header.Get(cacheBodyHeader)
+}
+
+// release deletes the stored bodies of the sums under root that no
+// entry of the index references any longer; as counted by the index,
+// so only once it is loaded.
+func (index *cacheIndex) release(root string, sums ...string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if index.entries == nil {
+		return
+	}
+
+	for _, sum := range sums {
+		name, ok := cacheBodyName(root, sum)
+		if !ok || index.bodies[sum] > 0 {
+			continue
+		}
+
+		cacheLog.WithFields(Fields{"name": name}).Debug("Pruning Unreferenced Cached Body")
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			cacheLog.WithError(err).Error("Could Not Prune Cached Body")
+		}
+	}
+}
+
+// pruneBodies deletes the stored bodies under the cache path root
+// that are not among those referenced; returning how many were.
+func pruneBodies(root string, referenced map[string]bool) (pruned int) {
+	infos, err := ioutil.ReadDir(filepath.Join(root, cacheBodyDir))
+	if err != nil {
+		return
+	}
+
+	for _, info := range infos {
+		if info.IsDir() || referenced[info.Name()] {
+			continue
+		}
+
+		name := filepath.Join(root, cacheBodyDir, info.Name())
+		cacheLog.WithFields(Fields{"name": name}).Debug("Pruning Unreferenced Cached Body")
+
+		if err := os.Remove(name); err != nil {
+			cacheLog.WithError(err).Error("Could Not Prune Cached Body")
+			continue
+		}
+
+		pruned++
+	}
+
+	return
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dedupeOrigin answers any path with the body of its query; so the
+// bodies of different URLs are identical when their queries are.
+func dedupeOrigin() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+}
+
+// bodyFiles returns the bodies stored under the cache path by DedupeBodies.
+func bodyFiles(t *testing.T, root string) (bodies []string) {
+	t.Helper()
+
+	infos, err := ioutil.ReadDir(filepath.Join(root, cacheBodyDir))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("reading stored bodies: %v", err)
+	}
+
+	for _, info := range infos {
+		data, err := ioutil.ReadFile(filepath.Join(root, cacheBodyDir, info.Name()))
+		if err != nil {
+			t.Fatalf("reading stored body: %v", err)
+		}
+
+		bodies = append(bodies, string(data))
+	}
+
+	return bodies
+}
+
+func TestDedupeBodies(t *testing.T) {
+	origin := dedupeOrigin()
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DedupeBodies(true)
+
+	for _, path := range []string{"/a?shared", "/b?shared", "/a?shared", "/b?shared"} {
+		if body := readBody(t, get(proxy, origin.URL+path)); body != "shared" {
+			t.Errorf("%s: body = %q; want %q", path, body, "shared")
+		}
+	}
+
+	if entries := entryFiles(t, root); len(entries) != 2 {
+		t.Errorf("cache entries = %q; want 2", entries)
+	}
+	if bodies := bodyFiles(t, root); len(bodies) != 1 || bodies[0] != "shared" {
+		t.Errorf("stored bodies = %q; want the one shared", bodies)
+	}
+}
+
+func TestDedupeBodiesEvicted(t *testing.T) {
+	origin := dedupeOrigin()
+	defer origin.Close()
+
+	// Evicting /a leaves its body to /b; evicting /b deletes it.
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DedupeBodies(true).UseMaxCacheEntries(2)
+	for _, path := range []string{"/a?shared", "/b?shared", "/c?own"} {
+		readBody(t, get(proxy, origin.URL+path))
+	}
+
+	waitFor(t, "the eviction of /a", func() bool { return len(entryFiles(t, root)) == 2 })
+	if bodies := bodyFiles(t, root); len(bodies) != 2 {
+		t.Errorf("stored bodies = %q; want the shared body kept", bodies)
+	}
+
+	readBody(t, get(proxy, origin.URL+"/d?own"))
+	waitFor(t, "the eviction of /b", func() bool { return len(bodyFiles(t, root)) == 1 })
+	if bodies := bodyFiles(t, root); bodies[0] != "own" {
+		t.Errorf("stored bodies = %q; want only %q", bodies, "own")
+	}
+}
+
+func TestDedupeBodiesRemoved(t *testing.T) {
+	origin := dedupeOrigin()
+	defer origin.Close()
+
+	for _, test := range []struct {
+		name   string
+		remove func(proxy *Proxy, url string)
+	}{
+		{"swept", func(proxy *Proxy, url string) {
+			proxy.UseRetentionTTL(time.Nanosecond)
+			defer proxy.UseRetentionTTL(0)
+			proxy.SweepCache()
+		}},
+		{"invalidated", func(proxy *Proxy, url string) {
+			readBody(t, serve(proxy, newRequest("POST", url, "a write")))
+		}},
+	} {
+		root := t.TempDir()
+		proxy := NewProxy().UseCachePath(root).DedupeBodies(true)
+
+		url := origin.URL + "/a?body"
+		readBody(t, get(proxy, url))
+		if bodies := bodyFiles(t, root); len(bodies) != 1 {
+			t.Fatalf("%s: stored bodies = %q; want 1", test.name, bodies)
+		}
+
+		test.remove(proxy, url)
+		if entries := entryFiles(t, root); len(entries) != 0 {
+			t.Errorf("%s: cache entries = %q; want none", test.name, entries)
+		}
+		if bodies := bodyFiles(t, root); len(bodies) != 0 {
+			t.Errorf("%s: stored bodies = %q; want none", test.name, bodies)
+		}
+	}
+}
+
+func TestDedupeBodiesCountedOnLoad(t *testing.T) {
+	origin := dedupeOrigin()
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DedupeBodies(true)
+	for _, path := range []string{"/a?shared", "/b?shared"} {
+		readBody(t, get(proxy, origin.URL+path))
+	}
+
+	// Another proxy counts the references of what is already stored.
+	proxy = NewProxy().UseCachePath(root).DedupeBodies(true)
+	if err := proxy.LoadCacheIndex(); err != nil {
+		t.Fatalf("LoadCacheIndex: %v", err)
+	}
+
+	readBody(t, serve(proxy, newRequest("POST", origin.URL+"/a?shared", "a write")))
+	if bodies := bodyFiles(t, root); len(bodies) != 1 {
+		t.Errorf("stored bodies = %q; want the shared body kept for /b", bodies)
+	}
+
+	readBody(t, serve(proxy, newRequest("POST", origin.URL+"/b?shared", "a write")))
+	if bodies := bodyFiles(t, root); len(bodies) != 0 {
+		t.Errorf("stored bodies = %q; want none", bodies)
+	}
+}
+
+func TestDedupeCorruptBodyOnHead(t *testing.T) {
+	origin := dedupeOrigin()
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DedupeBodies(true).VerifyCacheIntegrity(true)
+	readBody(t, get(proxy, origin.URL+"/a?intact"))
+
+	infos, _ := ioutil.ReadDir(filepath.Join(root, cacheBodyDir))
+	if len(infos) != 1 {
+		t.Fatalf("stored bodies = %d; want 1", len(infos))
+	}
+	stored := filepath.Join(root, cacheBodyDir, infos[0].Name())
+	if err := ioutil.WriteFile(stored, []byte("rotted"), 0644); err != nil {
+		t.Fatalf("corrupting stored body: %v", err)
+	}
+
+	// A HEAD finds it corrupt too; it isn't left for a GET to reference.
+	readBody(t, serve(proxy, newRequest("HEAD", origin.URL+"/a?intact", "")))
+	for _, body := range bodyFiles(t, root) {
+		if body == "rotted" {
+			t.Errorf("corrupt stored body kept")
+		}
+	}
+
+	if body := readBody(t, get(proxy, origin.URL+"/b?intact")); body != "intact" {
+		t.Errorf("body = %q; want %q", body, "intact")
+	}
+}
+
+func TestDedupeBodyHeaderFromOrigin(t *testing.T) {
+	secret := "secret body of /private"
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/private" {
+			w.Write([]byte(secret))
+			return
+		}
+
+		// Naming the stored body of another entry as its own.
+		w.Header().Set(cacheBodyHeader, bodySum([]byte(secret)))
+		w.Write([]byte("probe"))
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).DedupeBodies(true)
+	readBody(t, get(proxy, origin.URL+"/private"))
+
+	// Cached with a body of its own; from the origin, then the cache.
+	proxy = NewProxy().UseCachePath(root)
+	for i := 0; i < 2; i++ {
+		if body := readBody(t, get(proxy, origin.URL+"/probe")); body != "probe" {
+			t.Errorf("served %d = %q; want the probe's own body", i, body)
+		}
+	}
+
+	// An entry referencing it, as one cached before the header was
+	// dropped would; it isn't the body stored for it, so isn't served.
+	for _, name := range entryFiles(t, root) {
+		meta, err := proxy.ReadCacheMetadata(name)
+		if err != nil || meta.URL != origin.URL+"/probe" {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte(cacheBodyHeader)) {
+			t.Errorf("probe cached with the %s of the origin", cacheBodyHeader)
+		}
+
+		header := "\r\n" + cacheBodyHeader + ": " + bodySum([]byte(secret)) + "\r\n"
+		data = bytes.Replace(data, []byte("\r\n"), []byte(header), 1)
+		if err := ioutil.WriteFile(name, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if body := readBody(t, get(proxy, origin.URL+"/probe")); body != "probe" {
+		t.Errorf("served %q; want the probe's own body", body)
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoOrigin answers with the method, a header and the body of requests.
+func echoOrigin() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + r.Header.Get("X-Test") + " " + string(body)))
+	}))
+}
+
+func TestDoGet(t *testing.T) {
+	origin := echoOrigin()
+	defer origin.Close()
+
+	response, err := NewProxy().UseCachePath(t.TempDir()).Do(
+		"GET", origin.URL+"/a", nil, http.Header{"X-Test": {"get"}},
+	)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	var body bytes.Buffer
+	response.WriteBodyTo(&body)
+	if body.String() != "GET get " {
+		t.Errorf("body = %q", body.String())
+	}
+}
+
+func TestDoPostWithBody(t *testing.T) {
+	origin := echoOrigin()
+	defer origin.Close()
+
+	response, err := NewProxy().UseCachePath(t.TempDir()).Do(
+		"POST", origin.URL+"/a", strings.NewReader("payload"), http.Header{"X-Test": {"post"}},
+	)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	var body bytes.Buffer
+	response.WriteBodyTo(&body)
+	if body.String() != "POST post payload" {
+		t.Errorf("body = %q", body.String())
+	}
+}
+
+func TestDoBadURL(t *testing.T) {
+	if _, err := NewProxy().Do("GET", "http://[::1", nil, nil); err == nil {
+		t.Error("Do of an invalid url did not fail")
+	}
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaxCacheEntriesEvictsOldest(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseMaxCacheEntries(3)
+
+	names := make(map[string]string)
+	for _, path := range []string{"/1", "/2", "/3", "/4", "/5"} {
+		readBody(t, get(proxy, origin.URL+path))
+		names[path] = proxy.prepareRequest(httptest.NewRequest("GET", origin.URL+path, nil)).FullCacheName()
+
+		if n := len(entryFiles(t, root)); n > 3 {
+			t.Fatalf("%d entries cached after %s; want at most 3", n, path)
+		}
+	}
+
+	cached := make(map[string]bool)
+	for _, name := range entryFiles(t, root) {
+		cached[filepath.Clean(name)] = true
+	}
+
+	for path, want := range map[string]bool{"/1": false, "/2": false, "/3": true, "/4": true, "/5": true} {
+		if got := cached[filepath.Clean(names[path])]; got != want {
+			t.Errorf("%s cached = %v; want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// statusBody returns the Content-Type and body of a response of the
+// status from the proxy itself; JSON when the request accepts it over
+// HTML (as API clients do), HTML otherwise (as browsers want).
+func statusBody(httpRequest *http.Request, status int) (string, string) {
+	text := http.StatusText(status)
+
+	var accept string
+	if httpRequest != nil {
+		accept = httpRequest.Header.Get("Accept")
+	}
+
+	jsonQuality := acceptQuality(accept, func(mediaType string) bool {
+		return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	})
+	htmlQuality := acceptQuality(accept, func(mediaType string) bool {
+		return mediaType == "text/html"
+	})
+
+	if jsonQuality > 0 && jsonQuality >= htmlQuality {
+		body, _ := json.Marshal(struct {
+			Status int    `json:"status"`
+			Error  string `json:"error"`
+		}{status, text})
+
+		return "application/json; charset=utf-8", string(body) + "\n"
+	}
+
+	return "text/html; charset=utf-8", fmt.Sprintf(
+		"<!DOCTYPE html>\n<html>\n<head><title>%[1]d %[2]s</title></head>\n"+
+			"<body><h1>%[1]d %[2]s</h1></body>\n</html>\n",
+		status, text,
+	)
+}
+
+// acceptQuality returns the highest q of the media types of the Accept
+// header that match; zero when none do. Wildcards are not matched.
+func acceptQuality(accept string, match func(mediaType string) bool) (quality float64) {
+	for _, value := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err != nil || !match(mediaType) {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		if q > quality {
+			quality = q
+		}
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorBodyNegotiated(t *testing.T) {
+	origin := httptest.NewServer(http.NotFoundHandler())
+	origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+
+	for _, test := range []struct {
+		accept string
+		cached bool
+		status int
+		json   bool
+	}{
+		{"application/json", false, http.StatusBadGateway, true},
+		{"application/problem+json, */*;q=0.1", false, http.StatusBadGateway, true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false, http.StatusBadGateway, false},
+		{"text/html, application/json;q=0.5", false, http.StatusBadGateway, false},
+		{"", false, http.StatusBadGateway, false},
+		{"application/json", true, http.StatusGatewayTimeout, true},
+	} {
+		request := newRequest("GET", origin.URL+"/a", "")
+		request.Header.Set("Accept", test.accept)
+		if test.cached {
+			request.Header.Set("Cache-Control", "only-if-cached")
+		}
+
+		response := serve(proxy, request)
+		body := readBody(t, response)
+		if response.StatusCode != test.status {
+			t.Errorf("Accept %q: status = %d; want %d", test.accept, response.StatusCode, test.status)
+		}
+
+		contentType := response.Header.Get("Content-Type")
+		if !test.json {
+			if !strings.HasPrefix(contentType, "text/html") || !strings.Contains(body, "<h1>") {
+				t.Errorf("Accept %q: %q body %q; want HTML", test.accept, contentType, body)
+			}
+			continue
+		}
+
+		var decoded struct {
+			Status int
+			Error  string
+		}
+		if !strings.HasPrefix(contentType, "application/json") || json.Unmarshal([]byte(body), &decoded) != nil ||
+			decoded.Status != test.status || decoded.Error != http.StatusText(test.status) {
+			t.Errorf("Accept %q: %q body %q; want JSON of the %d", test.accept, contentType, body, test.status)
+		}
+	}
+}
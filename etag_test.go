@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestETagComparison(t *testing.T) {
+	for _, test := range []struct {
+		a, b         string
+		weak, strong bool
+	}{
+		{`"x"`, `"x"`, true, true},
+		{`W/"x"`, `"x"`, true, false},
+		{`W/"x"`, `W/"x"`, true, false},
+		{`"x"`, `"y"`, false, false},
+		{`W/"x"`, `W/"y"`, false, false},
+	} {
+		if got := WeakETagMatch(test.a, test.b); got != test.weak {
+			t.Errorf("WeakETagMatch(%s, %s) = %v", test.a, test.b, got)
+		}
+		if got := StrongETagMatch(test.a, test.b); got != test.strong {
+			t.Errorf("StrongETagMatch(%s, %s) = %v", test.a, test.b, got)
+		}
+	}
+}
+
+func TestCacheExpiredWeakETag(t *testing.T) {
+	for _, test := range []struct {
+		cached, latest string
+		expired        bool
+	}{
+		{`"x"`, `W/"x"`, false},
+		{`W/"x"`, `"x"`, false},
+		{`"x"`, `W/"y"`, true},
+	} {
+		cached := LoadResponse(&http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Etag": {test.cached}},
+		}, nil).MarkAsCached()
+
+		expired := cached.CacheExpired(func() *Response {
+			return LoadResponse(&http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Etag": {test.latest}},
+			}, nil)
+		})
+
+		if expired != test.expired {
+			t.Errorf("cached %s, latest %s: expired %v; want %v", test.cached, test.latest, expired, test.expired)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// eventBuffer is how many events Events holds for a slow consumer.
+const eventBuffer = 1024
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	EventHit EventType = iota
+	EventMiss
+	EventStore
+	EventEvict
+	EventError
+)
+
+func (eventType EventType) String() string {
+	switch eventType {
+	case EventHit:
+		return "hit"
+	case EventMiss:
+		return "miss"
+	case EventStore:
+		return "store"
+	case EventEvict:
+		return "evict"
+	case EventError:
+		return "error"
+	}
+
+	return "unknown"
+}
+
+// Event is a cache or fetch event sent to the channel of Events; keyed
+// by the cache name of the response. Size is only set when it is stored
+// and Err only for errors.
+type Event struct {
+	Type EventType
+	Time time.Time
+	Key  string
+	Size int64
+	Err  error
+}
+
+// cacheEvents holds the optional cache lifecycle callbacks;
+// and the channel of Events once it is asked for.
+type cacheEvents struct {
+	store func(key string, size int64)
+	hit   func(key string)
+	evict func(key string)
+
+	*eventStream
+}
+
+// eventStream is the channel of Events; the same
+// whichever settings of the Proxy emit to it.
+type eventStream struct {
+	once    sync.Once
+	channel atomic.Value
+	dropped atomic.Int64
+}
+
+// OnCacheStore sets a function called with the cache name and size of
+// each response written to the cache. Like OnCacheHit and OnCacheEvict
+// it is called synchronously; so it should hand off any slow work.
+func (proxy *Proxy) OnCacheStore(store func(key string, size int64)) *Proxy {
+	defer proxy.configure()()
+	proxy.events.store = store
+	return proxy
+}
+
+// OnCacheHit sets a function called with the cache name
+// of each cached response served to a request.
+func (proxy *Proxy) OnCacheHit(hit func(key string)) *Proxy {
+	defer proxy.configure()()
+	proxy.events.hit = hit
+	return proxy
+}
+
+// OnCacheEvict sets a function called with the cache name of
+// each response evicted to stay within UseMaxCacheEntries.
+func (proxy *Proxy) OnCacheEvict(evict func(key string)) *Proxy {
+	defer proxy.configure()()
+	proxy.events.evict = evict
+	return proxy
+}
+
+// Events returns a channel of the hits, misses, stores, evictions and
+// errors of the Proxy. It is buffered so requests never wait on it; the
+// events that don't fit are dropped and counted by DroppedEvents. Each
+// call returns the same channel, and no events are sent before the first.
+func (proxy *Proxy) Events() <-chan Event {
+	proxy = proxy.snapshot()
+
+	proxy.events.once.Do(func() {
+		proxy.events.channel.Store(make(chan Event, eventBuffer))
+	})
+
+	return proxy.events.channel.Load().(chan Event)
+}
+
+// DroppedEvents returns how many events were dropped
+// because the channel of Events was full.
+func (proxy *Proxy) DroppedEvents() int64 {
+	proxy = proxy.snapshot()
+
+	return proxy.events.dropped.Load()
+}
+
+// emit sends the event to the channel of Events, if it was asked for;
+// dropping it rather than blocking when the channel is full.
+func (events *cacheEvents) emit(event Event) {
+	channel, _ := events.channel.Load().(chan Event)
+	if channel == nil {
+		return
+	}
+
+	event.Time = time.Now()
+
+	select {
+	case channel <- event:
+	default:
+		events.dropped.Add(1)
+	}
+}
+
+func (events *cacheEvents) cacheStored(key string, size int64) {
+	if events.store != nil {
+		events.store(key, size)
+	}
+
+	events.emit(Event{Type: EventStore, Key: key, Size: size})
+}
+
+func (events *cacheEvents) cacheHit(key string) {
+	if events.hit != nil {
+		events.hit(key)
+	}
+
+	events.emit(Event{Type: EventHit, Key: key})
+}
+
+func (events *cacheEvents) cacheMissed(key string) {
+	events.emit(Event{Type: EventMiss, Key: key})
+}
+
+func (events *cacheEvents) cacheEvicted(key string) {
+	if events.evict != nil {
+		events.evict(key)
+	}
+
+	events.emit(Event{Type: EventEvict, Key: key})
+}
+
+func (events *cacheEvents) failed(key string, err error) {
+	events.emit(Event{Type: EventError, Key: key, Err: err})
+}
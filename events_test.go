@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+// eventLog keeps the calls of the cache callbacks; which may
+// come from the goroutine writing the cache.
+type eventLog struct {
+	mutex sync.Mutex
+	calls []string
+	sizes map[string]int64
+}
+
+func (log *eventLog) add(kind, key string) {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	log.calls = append(log.calls, kind+" "+key)
+}
+
+func (log *eventLog) has(call string) bool {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+	for _, seen := range log.calls {
+		if seen == call {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestCacheCallbacks(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	log := &eventLog{sizes: map[string]int64{}}
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseMaxCacheEntries(1).
+		OnCacheStore(func(key string, size int64) {
+			log.add("store", key)
+			log.mutex.Lock()
+			log.sizes[key] = size
+			log.mutex.Unlock()
+		}).
+		OnCacheHit(func(key string) { log.add("hit", key) }).
+		OnCacheEvict(func(key string) { log.add("evict", key) })
+
+	name := func(path string) string {
+		return LoadRequest(newRequest("GET", origin.URL+path, "")).
+			SetCachePath(proxy.cachePath).FullCacheName()
+	}
+
+	readBody(t, get(proxy, origin.URL+"/a"))
+	waitFor(t, "the store of /a", func() bool { return log.has("store " + name("/a")) })
+
+	log.mutex.Lock()
+	size := log.sizes[name("/a")]
+	log.mutex.Unlock()
+	if info, err := os.Stat(name("/a")); err != nil || size != info.Size() {
+		t.Errorf("stored size of /a = %d; want the size of its cache file", size)
+	}
+
+	readBody(t, get(proxy, origin.URL+"/a"))
+	if !log.has("hit " + name("/a")) {
+		t.Errorf("no hit for /a; calls = %v", log.calls)
+	}
+
+	// Only one entry is kept; /b evicts /a.
+	readBody(t, get(proxy, origin.URL+"/b"))
+	waitFor(t, "the eviction of /a", func() bool { return log.has("evict " + name("/a")) })
+
+	if log.has("hit " + name("/b")) {
+		t.Errorf("hit for the first fetch of /b; calls = %v", log.calls)
+	}
+}
+
+func TestEventsChannel(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	events := proxy.Events()
+
+	readBody(t, get(proxy, origin.URL+"/a"))
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	var seen []Event
+	waitFor(t, "the events of a miss then a hit", func() bool {
+		select {
+		case event := <-events:
+			seen = append(seen, event)
+		default:
+		}
+		return len(seen) == 3
+	})
+
+	for i, want := range []EventType{EventMiss, EventStore, EventHit} {
+		if seen[i].Type != want {
+			t.Errorf("event %d is a %v; want a %v", i, seen[i].Type, want)
+		}
+		if seen[i].Key != seen[0].Key || seen[i].Key == "" {
+			t.Errorf("event %d is of %q; want all of %q", i, seen[i].Key, seen[0].Key)
+		}
+		if i > 0 && seen[i].Time.Before(seen[i-1].Time) {
+			t.Errorf("event %d at %v is before the one preceding it", i, seen[i].Time)
+		}
+	}
+
+	if seen[1].Size <= 0 {
+		t.Errorf("store event size = %d", seen[1].Size)
+	}
+
+	if proxy.Events() != events {
+		t.Error("Events returned another channel")
+	}
+}
+
+func TestEventsDropped(t *testing.T) {
+	proxy := NewProxy()
+	events := proxy.Events()
+
+	// Nobody reading; so the overflow is dropped rather than waited on.
+	for i := 0; i < eventBuffer+10; i++ {
+		proxy.events.emit(Event{Type: EventMiss})
+	}
+
+	if len(events) != eventBuffer || proxy.DroppedEvents() != 10 {
+		t.Errorf("buffered %d and dropped %d; want %d and 10", len(events), proxy.DroppedEvents(), eventBuffer)
+	}
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpectContinueBodyAccepted(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte("got " + string(body)))
+	}))
+	defer origin.Close()
+
+	for _, answer := range []bool{false, true} {
+		client := proxyClient(t, NewProxy().UseCachePath(t.TempDir()).AnswerExpectContinue(answer))
+
+		// Longer than the test would take; the body waits on the 100 Continue.
+		client.Transport.(*http.Transport).ExpectContinueTimeout = 5 * time.Second
+
+		request, _ := http.NewRequest("POST", origin.URL+"/upload", strings.NewReader("payload"))
+		request.Header.Set("Expect", "100-continue")
+
+		started := time.Now()
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("answer %v: POST: %v", answer, err)
+		}
+
+		if body := readBody(t, response); body != "got payload" {
+			t.Errorf("answer %v: body = %q", answer, body)
+		}
+		if elapsed := time.Since(started); elapsed > 2*time.Second {
+			t.Errorf("answer %v: took %v; the 100 Continue was not sent", answer, elapsed)
+		}
+	}
+}
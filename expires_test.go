@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExpiresFromFreshness(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	stored := time.Now()
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	response := get(proxy, origin.URL+"/a")
+	if body := readBody(t, response); body != "hello" {
+		t.Fatalf("cached body = %q", body)
+	}
+
+	expires, err := http.ParseTime(response.Header.Get("Expires"))
+	if err != nil {
+		t.Fatalf("Expires %q: %v", response.Header.Get("Expires"), err)
+	}
+
+	deadline := stored.Add(60 * time.Second)
+	if diff := expires.Sub(deadline); diff < -2*time.Second || diff > time.Second {
+		t.Errorf("Expires = %v; want about %v", expires, deadline.UTC())
+	}
+}
+
+func TestFreshnessLifetimeSeconds(t *testing.T) {
+	for control, want := range map[string]time.Duration{
+		"max-age=120":              120 * time.Second,
+		"max-age=120, s-maxage=30": 30 * time.Second,
+	} {
+		response := LoadResponse(&http.Response{Header: http.Header{
+			"Cache-Control": {control},
+		}}, nil)
+
+		if lifetime, yes := response.freshnessLifetime(); !yes || lifetime != want {
+			t.Errorf("freshnessLifetime(%q) = %v, %v; want %v", control, lifetime, yes, want)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// fallbackResponse is served when the origin can't be reached.
+type fallbackResponse struct {
+	status int
+	body   []byte
+	header http.Header
+}
+
+// UseFallbackResponse sets a static response, like a maintenance page,
+// served in place of the 502 Bad Gateway when the origin can't be
+// reached and there is no cached response to serve instead. It keeps
+// the error of the fetch; so it is never cached itself.
+func (proxy *Proxy) UseFallbackResponse(
+	status int, body []byte, headers http.Header,
+) *Proxy {
+	defer proxy.configure()()
+	fallback := &fallbackResponse{
+		status: status,
+		body:   append([]byte(nil), body...),
+		header: make(http.Header),
+	}
+
+	CopyHeaders(headers, fallback.header)
+	fallback.header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	proxy.fallback = fallback
+	return proxy
+}
+
+// fallbackResponse returns the UseFallbackResponse response to
+// the request with the error of the fetch; nil if none is set.
+func (request *Request) fallbackResponse(err error) *Response {
+	fallback := request.proxy.fallback
+	if fallback == nil {
+		return nil
+	}
+
+	request.traced(requestLog).WithFields(Fields{"status": fallback.status}).Warning("Serving Fallback Response")
+
+	header := make(http.Header)
+	CopyHeaders(fallback.header, header)
+
+	response := LoadResponse(&http.Response{
+		Status:        fmt.Sprintf("%d %s", fallback.status, http.StatusText(fallback.status)),
+		StatusCode:    fallback.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(fallback.body)),
+		ContentLength: int64(len(fallback.body)),
+		Request:       request.proxied,
+	}, err)
+
+	response.proxy = request.proxy
+	response.requestID = request.requestID
+	return response
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFallbackResponse(t *testing.T) {
+	origin := httptest.NewServer(http.NotFoundHandler())
+	origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+
+	if response := get(proxy, origin.URL+"/a"); response.StatusCode != http.StatusBadGateway {
+		t.Fatalf("without a fallback: status = %d; want 502", response.StatusCode)
+	}
+
+	proxy.UseFallbackResponse(http.StatusServiceUnavailable, []byte("down for maintenance"), http.Header{
+		"Content-Type": {"text/plain"},
+		"Retry-After":  {"120"},
+	})
+
+	// Twice; the fallback is never cached in place of the origin.
+	for i := 0; i < 2; i++ {
+		response := get(proxy, origin.URL+"/a")
+		if response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("status = %d; want 503", response.StatusCode)
+		}
+
+		if value := response.Header.Get("Retry-After"); value != "120" {
+			t.Errorf("Retry-After = %q; want 120", value)
+		}
+
+		if body := readBody(t, response); body != "down for maintenance" {
+			t.Errorf("body = %q", body)
+		}
+	}
+
+	if entries := entryFiles(t, root); len(entries) != 0 {
+		t.Errorf("cache entries = %q; want none", entries)
+	}
+}
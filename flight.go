@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// flightGroup coalesces concurrent calls sharing a
+// key so that only the first one does the work and
+// the rest wait for and share its *Response.
+type flightGroup struct {
+	mutex   sync.Mutex
+	flights map[string]*flight
+
+	// joined counts the callers that shared a response.
+	joined atomic.Int64
+}
+
+type flight struct {
+	wait     sync.WaitGroup
+	response *Response
+}
+
+// Do runs fn once for all concurrent callers of key; shared
+// reports whether the response came from another caller.
+func (group *flightGroup) Do(
+	key string, fn func() *Response,
+) (response *Response, shared bool) {
+	group.mutex.Lock()
+
+	if group.flights == nil {
+		group.flights = make(map[string]*flight)
+	}
+
+	if inflight, ok := group.flights[key]; ok {
+		group.mutex.Unlock()
+		proxyLog.WithFields(Fields{"key": key}).Debug("Joining In-Flight Call")
+		group.joined.Add(1)
+		inflight.wait.Wait()
+		return inflight.response, true
+	}
+
+	inflight := new(flight)
+	inflight.wait.Add(1)
+	group.flights[key] = inflight
+	group.mutex.Unlock()
+
+	defer func() {
+		group.mutex.Lock()
+		delete(group.flights, key)
+		group.mutex.Unlock()
+		inflight.wait.Done()
+	}()
+
+	inflight.response = fn()
+	return inflight.response, false
+}
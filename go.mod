@@ -0,0 +1,5 @@
+module github.com/KellyLSB/go.proxy
+
+go 1.24
+
+require github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
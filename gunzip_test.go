@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// truncatedGzip returns a gzip stream of body cut off partway.
+func truncatedGzip(body string) []byte {
+	var compressed bytes.Buffer
+	gzwrite := gzip.NewWriter(&compressed)
+	gzwrite.Write([]byte(body))
+	gzwrite.Close()
+
+	return compressed.Bytes()[:compressed.Len()/2]
+}
+
+func gzipResponse(body []byte) *Response {
+	return LoadResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}, nil)
+}
+
+func TestGunzipTruncatedReturnsError(t *testing.T) {
+	body := strings.Repeat("lorem ipsum ", 4096)
+
+	var written bytes.Buffer
+	if err := gzipResponse(truncatedGzip(body)).GunzipBodyToErr(&written); err == nil {
+		t.Error("GunzipBodyToErr of a truncated stream returned no error")
+	}
+
+	// Uncompressed as it is read; so only what came before the cut.
+	if !strings.HasPrefix(body, written.String()) {
+		t.Error("written bytes are not a prefix of the uncompressed body")
+	}
+	if written.Len() >= len(body) {
+		t.Errorf("wrote %d bytes of a truncated stream; want fewer than %d", written.Len(), len(body))
+	}
+}
+
+func TestGunzipInvalidFallsBackToRaw(t *testing.T) {
+	raw := []byte("not gzip at all")
+
+	var written bytes.Buffer
+	if err := gzipResponse(raw).GunzipBodyToErr(&written); err == nil {
+		t.Error("GunzipBodyToErr of an invalid stream returned no error")
+	}
+	if !bytes.Equal(written.Bytes(), raw) {
+		t.Errorf("wrote %q; want the raw body", written.Bytes())
+	}
+
+	// GunzipBodyTo falls back the same; only logging the error.
+	written.Reset()
+	gzipResponse(raw).GunzipBodyTo(&written)
+	if !bytes.Equal(written.Bytes(), raw) {
+		t.Errorf("GunzipBodyTo wrote %q; want the raw body", written.Bytes())
+	}
+}
+
+func TestGunzipStreamTruncatedReturnsError(t *testing.T) {
+	body := strings.Repeat("lorem ipsum ", 4096)
+
+	var written bytes.Buffer
+	if err := gzipResponse(truncatedGzip(body)).GunzipBodyStreamTo(&written); err == nil {
+		t.Error("GunzipBodyStreamTo of a truncated stream returned no error")
+	}
+	if !strings.HasPrefix(body, written.String()) {
+		t.Error("streamed bytes are not a prefix of the uncompressed body")
+	}
+}
+
+// flushCounter is an http.ResponseWriter counting its flushes; and
+// the bytes written before each one.
+type flushCounter struct {
+	*httptest.ResponseRecorder
+	flushedAt []int
+}
+
+func (writer *flushCounter) Flush() {
+	writer.flushedAt = append(writer.flushedAt, writer.Body.Len())
+}
+
+func TestGunzipStreamFlushes(t *testing.T) {
+	body := strings.Repeat("a large decompressed stream ", 16<<10)
+
+	var compressed bytes.Buffer
+	gzwrite := gzip.NewWriter(&compressed)
+	gzwrite.Write([]byte(body))
+	gzwrite.Close()
+
+	writer := &flushCounter{ResponseRecorder: httptest.NewRecorder()}
+	if err := gzipResponse(compressed.Bytes()).GunzipBodyStreamTo(writer); err != nil {
+		t.Fatalf("GunzipBodyStreamTo: %v", err)
+	}
+
+	if writer.Body.String() != body {
+		t.Errorf("streamed %d bytes; want the %d uncompressed", writer.Body.Len(), len(body))
+	}
+
+	// Flushed as it went; not only once at the end.
+	if len(writer.flushedAt) < len(body)/gunzipFlushBytes {
+		t.Errorf("%d flushes for %d bytes; want one every %d", len(writer.flushedAt), len(body), gunzipFlushBytes)
+	}
+	if len(writer.flushedAt) > 0 && writer.flushedAt[0] >= len(body) {
+		t.Error("first flush came after the whole body was written")
+	}
+}
@@ -0,0 +1,381 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// harBodyLimit caps the bytes of each body kept in the HAR file.
+const harBodyLimit = 64 << 10
+
+// harRecorder appends request/response pairs to a HAR (HTTP Archive)
+// file; each entry is written over the closing brackets, which are then
+// written again after it, so the file is always a complete JSON document
+// and no entries are kept in memory.
+type harRecorder struct {
+	mutex  sync.Mutex
+	path   string
+	offset int64 // where the closing brackets start
+	count  int
+	err    error // from opening the file; nothing is recorded
+}
+
+// harHead and harTail enclose the entries written by a harRecorder.
+const (
+	harHead = `{"log":{"version":"1.2","creator":{"name":"go.proxy","version":"1.0"},"entries":[`
+	harTail = "\n]}}\n"
+)
+
+type harArchive struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harBody keeps up to harBodyLimit bytes of what is written to it;
+// it never fails a write so it can Tee a body being served.
+type harBody struct {
+	data []byte
+	size int64
+}
+
+func (body *harBody) Write(data []byte) (int, error) {
+	n := len(data)
+	body.size += int64(n)
+
+	if room := harBodyLimit - len(body.data); room > 0 {
+		if len(data) > room {
+			data = data[:room]
+		}
+
+		body.data = append(body.data, data...)
+	}
+
+	return n, nil
+}
+
+// text returns the kept bytes; base64 encoded when not UTF-8.
+func (body *harBody) text() (text string, encoding string) {
+	if utf8.Valid(body.data) {
+		return string(body.data), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(body.data), "base64"
+}
+
+// harReadCloser tees a request body into a harBody as it is sent.
+type harReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func newHARRecorder(path string) *harRecorder {
+	recorder := &harRecorder{path: path}
+	if recorder.err = recorder.open(); recorder.err != nil {
+		proxyLog.WithError(recorder.err).Error("Could Not Write HAR File")
+	}
+
+	return recorder
+}
+
+// open starts the HAR file; the entries of an existing archive
+// are carried over one at a time.
+func (recorder *harRecorder) open() error {
+	temp, err := ioutil.TempFile(filepath.Dir(recorder.path), ".har")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	written, _ := io.WriteString(temp, harHead)
+	recorder.offset = int64(written)
+
+	if existing, err := os.Open(recorder.path); err == nil {
+		err := readHAREntries(existing, func(entry json.RawMessage) error {
+			return recorder.append(temp, entry)
+		})
+
+		existing.Close()
+		if err != nil {
+			proxyLog.WithError(err).Warning("Could Not Read HAR File")
+		}
+	}
+
+	if _, err := temp.WriteAt([]byte(harTail), recorder.offset); err != nil {
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), recorder.path)
+}
+
+// readHAREntries calls found with each entry of the archive in reader.
+func readHAREntries(reader io.Reader, found func(json.RawMessage) error) error {
+	decoder := json.NewDecoder(reader)
+
+	// Into {"log":{... "entries":[
+	for _, path := range []string{"log", "entries"} {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+
+		for {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+
+			if key == path {
+				break
+			}
+
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		var entry json.RawMessage
+		if err := decoder.Decode(&entry); err != nil {
+			return err
+		}
+
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, entry); err != nil {
+			return err
+		}
+
+		if err := found(compact.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// append writes the entry at the offset; over the closing brackets.
+func (recorder *harRecorder) append(file *os.File, entry []byte) error {
+	var data []byte
+	if recorder.count > 0 {
+		data = append(data, ',')
+	}
+
+	data = append(append(data, '\n'), entry...)
+	if _, err := file.WriteAt(data, recorder.offset); err != nil {
+		return err
+	}
+
+	recorder.offset += int64(len(data))
+	recorder.count++
+	return nil
+}
+
+// Record appends the exchange to the HAR file.
+func (recorder *harRecorder) Record(
+	httpRequest *http.Request,
+	response *Response,
+	started time.Time,
+	wait, receive time.Duration,
+	requestBody, responseBody *harBody,
+) {
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            milliseconds(wait + receive),
+		Request: harRequest{
+			Method:      httpRequest.Method,
+			URL:         httpRequest.URL.String(),
+			HTTPVersion: httpRequest.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(httpRequest.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    requestBody.size,
+		},
+		Response: harResponse{
+			Status:      response.proxied.StatusCode,
+			StatusText:  http.StatusText(response.proxied.StatusCode),
+			HTTPVersion: response.proxied.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(response.proxied.Header),
+			Content: harContent{
+				Size:     responseBody.size,
+				MimeType: response.GetHeader("Content-Type"),
+			},
+			RedirectURL: response.GetHeader("Location"),
+			HeadersSize: -1,
+			BodySize:    responseBody.size,
+		},
+		Timings: harTimings{
+			Wait:    milliseconds(wait),
+			Receive: milliseconds(receive),
+		},
+	}
+
+	for name, values := range httpRequest.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(
+				entry.Request.QueryString, harNameValue{name, value},
+			)
+		}
+	}
+
+	if requestBody.size > 0 {
+		text, _ := requestBody.text()
+		entry.Request.PostData = &harPostData{
+			MimeType: httpRequest.Header.Get("Content-Type"),
+			Text:     text,
+		}
+	}
+
+	entry.Response.Content.Text, entry.Response.Content.Encoding = responseBody.text()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		proxyLog.WithError(err).Error("Could Not Write HAR File")
+		return
+	}
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if err := recorder.write(data); err != nil {
+		proxyLog.WithError(err).Error("Could Not Write HAR File")
+	}
+}
+
+// write appends the entry and the closing brackets after it.
+func (recorder *harRecorder) write(entry []byte) error {
+	if recorder.err != nil {
+		return recorder.err
+	}
+
+	file, err := os.OpenFile(recorder.path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	offset, count := recorder.offset, recorder.count
+	if err = recorder.append(file, entry); err == nil {
+		_, err = file.WriteAt([]byte(harTail), recorder.offset)
+	}
+
+	// Put the closing brackets back after the last whole entry.
+	if err != nil {
+		recorder.offset, recorder.count = offset, count
+		file.WriteAt([]byte(harTail), offset)
+		file.Truncate(offset + int64(len(harTail)))
+		return err
+	}
+
+	return file.Close()
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			headers = append(headers, harNameValue{name, value})
+		}
+	}
+
+	return headers
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
+
+// RecordHAR records every exchange served by ServeHTTP to the HAR
+// (HTTP Archive) file at path; bodies are capped at 64KiB each.
+func (proxy *Proxy) RecordHAR(path string) *Proxy {
+	defer proxy.configure()()
+	proxy.har = newHARRecorder(path)
+	return proxy
+}
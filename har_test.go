@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func readHAR(t *testing.T, path string) harArchive {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading HAR: %v", err)
+	}
+
+	var archive harArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		t.Fatalf("HAR does not parse: %v\n%s", err, data)
+	}
+
+	return archive
+}
+
+func TestRecordHAR(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer origin.Close()
+
+	path := filepath.Join(t.TempDir(), "proxy.har")
+	proxy := NewProxy().UseCachePath(t.TempDir()).RecordHAR(path)
+
+	for _, target := range []string{"/one?q=1", "/missing"} {
+		proxy.ServeHTTP(httptest.NewRecorder(), newRequest("GET", origin.URL+target, ""))
+	}
+
+	archive := readHAR(t, path)
+	if archive.Log.Version != "1.2" || archive.Log.Creator.Name != "go.proxy" {
+		t.Errorf("log = %+v; want version 1.2 by go.proxy", archive.Log)
+	}
+
+	entries := archive.Log.Entries
+	if len(entries) != 2 {
+		t.Fatalf("%d entries; want 2", len(entries))
+	}
+
+	if entry := entries[0]; entry.Request.URL != origin.URL+"/one?q=1" ||
+		entry.Response.Status != http.StatusOK ||
+		entry.Response.Content.Text != "hello /one" {
+		t.Errorf("first entry = %s %d %q", entry.Request.URL, entry.Response.Status, entry.Response.Content.Text)
+	}
+
+	if query := entries[0].Request.QueryString; len(query) != 1 || query[0] != (harNameValue{"q", "1"}) {
+		t.Errorf("query string = %v; want q=1", query)
+	}
+
+	if entry := entries[1]; entry.Request.URL != origin.URL+"/missing" ||
+		entry.Response.Status != http.StatusNotFound {
+		t.Errorf("second entry = %s %d", entry.Request.URL, entry.Response.Status)
+	}
+
+	// Recording again to the same file carries the entries over.
+	proxy = NewProxy().UseCachePath(t.TempDir()).RecordHAR(path)
+	proxy.ServeHTTP(httptest.NewRecorder(), newRequest("GET", origin.URL+"/two", ""))
+
+	entries = readHAR(t, path).Log.Entries
+	if len(entries) != 3 {
+		t.Fatalf("%d entries after reopening; want 3", len(entries))
+	}
+
+	if entries[2].Request.URL != origin.URL+"/two" {
+		t.Errorf("appended entry = %s; want /two", entries[2].Request.URL)
+	}
+}
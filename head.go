@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// conditionalHeaders make a request conditional on the cached
+// response; they are not part of the name of the GET it is.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since", "Range", "If-Range"}
+
+// notModifiedHeaders are those a 304 Not Modified is
+// sent with; as the 200 would be (RFC 7232 4.1).
+var notModifiedHeaders = []string{
+	"Cache-Control", "Content-Location", "Date",
+	"ETag", "Expires", "Last-Modified", "Vary",
+}
+
+// fetchCachedHead answers the HEAD request from the fresh cached GET of
+// its URL; the headers are the same (RFC 7231 4.3.2). It is a 304 Not
+// Modified when the If-None-Match of the request matches the ETag. It
+// returns nil without a fresh GET cached; so the HEAD goes upstream.
+func (request *Request) fetchCachedHead() *Response {
+	name := request.headCacheName()
+	response := request.loadCache(name)
+	if response == nil {
+		return nil
+	}
+
+	if request.cacheExpired(response) {
+		response.proxied.Body.Close()
+		response.release()
+		return nil
+	}
+
+	request.traced(cacheLog).WithFields(Fields{"name": name}).Debug("Serving HEAD From Cached GET")
+	request.proxy.hits.record(true)
+	request.proxy.events.cacheHit(response.cacheName)
+
+	if request.noneMatch(response) {
+		return response
+	}
+
+	return response.notModified()
+}
+
+// headCacheName returns the name of the GET the HEAD request
+// would be; without the headers making it conditional.
+func (request *Request) headCacheName() string {
+	if request.cacheNameStyle == CacheNameURI {
+		return filepath.Join(request.CachePath(), request.proxy.uriCacheName(request.original))
+	}
+
+	method := request.proxied.Method
+	request.proxied.Method = "GET"
+	defer func() { request.proxied.Method = method }()
+
+	return request.cacheNameWithout(conditionalHeaders...)
+}
+
+// noneMatch reports if the If-None-Match of the request matches none
+// of the ETag of the cached response; by weak comparison, as the
+// request has no If-None-Match, or "*" which matches any.
+func (request *Request) noneMatch(cached *Response) bool {
+	values := request.proxied.Header.Values("If-None-Match")
+	if len(values) == 0 {
+		return true
+	}
+
+	etag := strings.TrimPrefix(cached.GetHeader("ETag"), "W/")
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || etag != "" && strings.TrimPrefix(tag, "W/") == etag {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// notModified turns the cached response into a bodiless 304 Not
+// Modified; keeping only the notModifiedHeaders.
+func (response *Response) notModified() *Response {
+	response.traced(cacheLog).WithFields(Fields{"etag": response.GetHeader("ETag")}).Debug("Not Modified")
+
+	header := make(http.Header)
+	for _, key := range notModifiedHeaders {
+		if values := response.proxied.Header.Values(key); len(values) > 0 {
+			header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+
+	response.proxied.Body.Close()
+	response.release()
+
+	response.proxied.StatusCode = http.StatusNotModified
+	response.proxied.Status = "304 Not Modified"
+	response.proxied.Header = header
+	response.proxied.Body = http.NoBody
+	response.proxied.ContentLength = 0
+	return response
+}
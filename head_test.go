@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConditionalHeadFromCache(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/page"))
+
+	for _, test := range []struct {
+		noneMatch string
+		status    int
+	}{
+		{`"v1"`, http.StatusNotModified},
+		{`W/"v1"`, http.StatusNotModified},
+		{`"v0", "v1"`, http.StatusNotModified},
+		{`*`, http.StatusNotModified},
+		{`"v2"`, http.StatusOK},
+		{"", http.StatusOK},
+	} {
+		request := newRequest("HEAD", origin.URL+"/page", "")
+		if test.noneMatch != "" {
+			request.Header.Set("If-None-Match", test.noneMatch)
+		}
+
+		response := serve(proxy, request)
+		if body := readBody(t, response); body != "" {
+			t.Errorf("%s: body = %q; want none", test.noneMatch, body)
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("%s: status = %d; want %d", test.noneMatch, response.StatusCode, test.status)
+		}
+		if etag := response.Header.Get("ETag"); etag != `"v1"` {
+			t.Errorf("%s: ETag = %q; want %q", test.noneMatch, etag, `"v1"`)
+		}
+		if control := response.Header.Get("Cache-Control"); control != "max-age=60" {
+			t.Errorf("%s: Cache-Control = %q; want max-age=60", test.noneMatch, control)
+		}
+
+		// Only the 200 has the entity headers of the GET.
+		if kind := response.Header.Get("Content-Type"); (kind != "") != (test.status == http.StatusOK) {
+			t.Errorf("%s: Content-Type = %q", test.noneMatch, kind)
+		}
+	}
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("fetches = %d; want the HEADs answered from cache", got)
+	}
+
+	// Without the GET cached, the HEAD goes upstream.
+	request := newRequest("HEAD", origin.URL+"/other", "")
+	request.Header.Set("If-None-Match", `"v1"`)
+	readBody(t, serve(proxy, request))
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d; want the uncached HEAD fetched", got)
+	}
+}
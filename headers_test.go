@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCopyHeadersKeepsSetCookieOrder(t *testing.T) {
+	src := http.Header{"Set-Cookie": {"a=1; Path=/", "b=2; Path=/"}}
+	dst := http.Header{"Set-Cookie": {"z=0"}}
+
+	CopyHeaders(src, dst)
+	if got := strings.Join(dst["Set-Cookie"], "|"); got != "z=0|a=1; Path=/|b=2; Path=/" {
+		t.Errorf("CopyHeaders Set-Cookie = %q", got)
+	}
+
+	ReplaceHeaders(src, dst)
+	if got := strings.Join(dst["Set-Cookie"], "|"); got != "a=1; Path=/|b=2; Path=/" {
+		t.Errorf("ReplaceHeaders Set-Cookie = %q", got)
+	}
+
+	// Replaced values are dst's own; not shared with src.
+	dst["Set-Cookie"][0] = "changed"
+	if src["Set-Cookie"][0] != "a=1; Path=/" {
+		t.Error("ReplaceHeaders shares its values with src")
+	}
+}
+
+func TestServeKeepsSetCookieOrder(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "first=1")
+		w.Header().Add("Set-Cookie", "second=2")
+		w.Write([]byte("cookies"))
+	}))
+	defer origin.Close()
+
+	response, err := proxyClient(t, NewProxy().UseCachePath(t.TempDir())).Get(origin.URL + "/cookies")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	readBody(t, response)
+
+	if got := strings.Join(response.Header["Set-Cookie"], "|"); got != "first=1|second=2" {
+		t.Errorf("served Set-Cookie = %q; want both in order", got)
+	}
+}
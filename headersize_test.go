@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxHeaderBytes(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte("ok"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseMaxHeaderBytes(1024)
+
+	small := newRequest("GET", origin.URL+"/small", "")
+	small.Header.Set("X-Small", "fits")
+	if response := serve(proxy, small); readBody(t, response) != "ok" {
+		t.Errorf("small headers status = %d; want 200", response.StatusCode)
+	}
+
+	large := newRequest("GET", origin.URL+"/large", "")
+	for i := 0; i < 8; i++ {
+		large.Header.Add("X-Bomb", strings.Repeat("b", 200))
+	}
+
+	response := serve(proxy, large)
+	readBody(t, response)
+	if response.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("oversized headers status = %d; want 431", response.StatusCode)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want the oversized request never forwarded", n)
+	}
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHasHeaderValue(t *testing.T) {
+	response := LoadResponse(&http.Response{Header: http.Header{
+		"Cache-Control": {`public, max-age=120, no-cache="Set-Cookie"`},
+	}}, nil)
+
+	for directive, want := range map[string]string{
+		"public":   "",
+		"max-age":  "120",
+		"no-cache": "Set-Cookie",
+	} {
+		if value, yes := response.HasHeaderValue("Cache-Control", directive); !yes || value != want {
+			t.Errorf("HasHeaderValue(%q) = %q, %v; want %q", directive, value, yes, want)
+		}
+	}
+
+	if _, yes := response.HasHeaderValue("Cache-Control", "private"); yes {
+		t.Error("HasHeaderValue found an absent directive")
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeuristicLifetime(t *testing.T) {
+	date := time.Now().UTC()
+	for _, test := range []struct {
+		modified time.Duration
+		maxTTL   time.Duration
+		want     time.Duration
+		known    bool
+	}{
+		{10 * time.Hour, 0, time.Hour, true},
+		{100 * 24 * time.Hour, 0, 24 * time.Hour, true},
+		{100 * 24 * time.Hour, 48 * time.Hour, 48 * time.Hour, true},
+		{10 * time.Hour, 30 * time.Minute, 30 * time.Minute, true},
+		{-time.Hour, 0, 0, false},
+	} {
+		response := LoadResponse(&http.Response{Header: http.Header{
+			"Date":          {date.Format(http.TimeFormat)},
+			"Last-Modified": {date.Add(-test.modified).Format(http.TimeFormat)},
+		}}, nil)
+		response.proxy = NewProxy().UseMaxTTL(test.maxTTL).snapshot()
+
+		if lifetime, known := response.heuristicLifetime(); known != test.known || lifetime != test.want {
+			t.Errorf("modified %v before, max %v: %v, %v; want %v, %v",
+				test.modified, test.maxTTL, lifetime, known, test.want, test.known)
+		}
+	}
+}
+
+func TestHeuristicFreshnessServed(t *testing.T) {
+	var gets, heads atomic.Int32
+	modified := time.Now().Add(-10 * 24 * time.Hour).UTC().Format(http.TimeFormat)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			heads.Add(1)
+		} else {
+			gets.Add(1)
+		}
+		w.Header().Set("Last-Modified", modified)
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	// Modified ten days ago; so fresh for a day without revalidating.
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	for i := 0; i < 3; i++ {
+		if body := readBody(t, get(proxy, origin.URL+"/a")); body != "hello" {
+			t.Fatalf("body = %q", body)
+		}
+	}
+
+	if gets.Load() != 1 || heads.Load() != 0 {
+		t.Errorf("origin saw %d GETs and %d HEADs; want 1 and 0", gets.Load(), heads.Load())
+	}
+}
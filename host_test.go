@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetHostKeepsURL(t *testing.T) {
+	var host string
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+		w.Write([]byte("routed"))
+	}))
+	defer origin.Close()
+
+	httpRequest, _ := http.NewRequest("GET", origin.URL+"/vhost", nil)
+	response := LoadRequest(httpRequest).
+		SetCachePath(t.TempDir()).
+		SetHost("virtual.example").
+		Fetch()
+
+	if err := response.Err(); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	// Connected to the origin's address; routed by the overridden Host.
+	if host != "virtual.example" {
+		t.Errorf("origin saw Host %q; want virtual.example", host)
+	}
+
+	var body bytes.Buffer
+	response.WriteBodyTo(&body)
+	if body.String() != "routed" {
+		t.Errorf("body = %q; want routed", body.String())
+	}
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ErrHostForbidden is the error of the 403 Forbidden answered
+// for requests to a host excluded by AllowHosts or DenyHosts.
+var ErrHostForbidden = errors.New("proxy: host is not allowed")
+
+// AllowHosts restricts the proxy to the hosts matching the patterns;
+// with "*" and "?" wildcards as in path.Match, like "*.example.com".
+// Without any allowed patterns every host not denied is proxied.
+func (proxy *Proxy) AllowHosts(patterns ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.allowHosts = lowerPatterns(patterns)
+	return proxy
+}
+
+// DenyHosts refuses the hosts matching the patterns; before those
+// of AllowHosts, so a denied host is refused even if it is allowed.
+func (proxy *Proxy) DenyHosts(patterns ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.denyHosts = lowerPatterns(patterns)
+	return proxy
+}
+
+// lowerPatterns lowers the patterns and strips a trailing dot;
+// so a pattern matches the host whether or not it is fully qualified.
+func lowerPatterns(patterns []string) (lowered []string) {
+	for _, pattern := range patterns {
+		lowered = append(lowered, strings.TrimSuffix(strings.ToLower(pattern), "."))
+	}
+
+	return
+}
+
+// hostAllowed reports if the host (without its port or a trailing
+// dot) may be proxied under AllowHosts and DenyHosts.
+func (proxy *Proxy) hostAllowed(host string) bool {
+	host = strings.ToLower((&url.URL{Host: host}).Hostname())
+	host = strings.TrimSuffix(host, ".")
+
+	if matchHost(proxy.denyHosts, host) {
+		return false
+	}
+
+	return len(proxy.allowHosts) == 0 || matchHost(proxy.allowHosts, host)
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forbidden answers a 403 Forbidden if the host of the
+// proxied request may not be proxied; else it returns nil.
+func (request *Request) forbidden() *Response {
+	host := request.proxied.URL.Host
+	if host == "" {
+		host = request.proxied.Host
+	}
+
+	if request.proxy.hostAllowed(host) {
+		return nil
+	}
+
+	request.traced(requestLog).WithFields(Fields{"host": host}).Warning("Refusing Forbidden Host")
+	return request.statusResponse(http.StatusForbidden, ErrHostForbidden)
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	proxy := NewProxy().
+		AllowHosts("*.example.com", "example.com").
+		DenyHosts("admin.example.com")
+
+	for host, want := range map[string]bool{
+		"example.com":          true,
+		"www.example.com":      true,
+		"WWW.Example.COM:8080": true,
+		"admin.example.com":    false,
+		"admin.example.com.":   false,
+		"www.example.com.":     true,
+		"example.org":          false,
+		"evil-example.com":     false,
+	} {
+		if got := proxy.snapshot().hostAllowed(host); got != want {
+			t.Errorf("hostAllowed(%q) = %v; want %v", host, got, want)
+		}
+	}
+}
+
+func TestHostsForbiddenBeforeFetch(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, "http://denied.example/", http.StatusFound)
+			return
+		}
+		w.Write([]byte("allowed"))
+	}))
+	defer origin.Close()
+
+	allowed := NewProxy().UseCachePath(t.TempDir()).AllowHosts("127.0.0.1").DenyHosts("denied.example")
+	if got := readBody(t, get(allowed, origin.URL+"/ok")); got != "allowed" {
+		t.Errorf("allowed host = %q; want it proxied", got)
+	}
+
+	for name, proxy := range map[string]*Proxy{
+		"denied":      NewProxy().UseCachePath(t.TempDir()).DenyHosts("127.0.0.*"),
+		"not allowed": NewProxy().UseCachePath(t.TempDir()).AllowHosts("*.example.com"),
+	} {
+		before := fetches.Load()
+		response := get(proxy, origin.URL+"/ok")
+		readBody(t, response)
+		if response.StatusCode != http.StatusForbidden {
+			t.Errorf("%s host status = %d; want 403", name, response.StatusCode)
+		}
+		if fetches.Load() != before {
+			t.Errorf("%s host was fetched", name)
+		}
+	}
+
+	// Nor is a denied host reached by its fully qualified name.
+	denied := NewProxy().UseCachePath(t.TempDir()).DenyHosts("denied.example.com")
+	response := get(denied, "http://denied.example.com./")
+	readBody(t, response)
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("fully qualified denied host = %d; want 403", response.StatusCode)
+	}
+
+	// Nor is a denied host reached by a redirect.
+	response = get(allowed, origin.URL+"/away")
+	readBody(t, response)
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("redirect to a denied host = %d; want 403", response.StatusCode)
+	}
+}
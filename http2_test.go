@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// protoOrigin answers with the protocol the request arrived over.
+func protoOrigin(h2c bool) *httptest.Server {
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+
+	if h2c {
+		origin.Config.Protocols = new(http.Protocols)
+		origin.Config.Protocols.SetHTTP1(true)
+		origin.Config.Protocols.SetUnencryptedHTTP2(true)
+		origin.Start()
+		return origin
+	}
+
+	origin.EnableHTTP2 = true
+	origin.StartTLS()
+	return origin
+}
+
+func TestForceHTTP2(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		h2c   bool
+		force bool
+		proto string
+	}{
+		{"tls forced", false, true, "HTTP/2.0"},
+		{"tls disabled", false, false, "HTTP/1.1"},
+		{"h2c forced", true, true, "HTTP/2.0"},
+		{"h2c disabled", true, false, "HTTP/1.1"},
+	} {
+		origin := protoOrigin(test.h2c)
+
+		// The client of the origin trusts its certificate.
+		proxy := NewProxy(origin.Client().Transport).
+			UseCachePath(t.TempDir()).ForceHTTP2(test.force)
+
+		if proto := readBody(t, get(proxy, origin.URL+"/a")); proto != test.proto {
+			t.Errorf("%s: origin saw %q; want %q", test.name, proto, test.proto)
+		}
+
+		// HTTP() agrees with the transport on the protocol.
+		if proto := proxy.snapshot().prepareRequest(newRequest("GET", origin.URL+"/a", "")).HTTP().proxied.Proto; proto != test.proto {
+			t.Errorf("%s: proxied Proto = %q; want %q", test.name, proto, test.proto)
+		}
+
+		origin.Close()
+	}
+}
+
+func TestPreserveProto(t *testing.T) {
+	request := func(url string, major int) *http.Request {
+		httpRequest := newRequest("GET", url, "")
+		httpRequest.Proto = fmt.Sprintf("HTTP/%d.%d", major, 2-major)
+		httpRequest.ProtoMajor, httpRequest.ProtoMinor = major, 2-major
+		return httpRequest
+	}
+
+	for _, test := range []struct {
+		name     string
+		h2c      bool
+		preserve bool
+		major    int
+		proto    string
+	}{
+		// Without it the transport negotiates h2 over TLS; and
+		// sends http:// URLs as HTTP/1.1, whatever the client's.
+		{"tls h1 negotiated", false, false, 1, "HTTP/2.0"},
+		{"tls h2 negotiated", false, false, 2, "HTTP/2.0"},
+		{"h2c h2 negotiated", true, false, 2, "HTTP/1.1"},
+		{"tls h1 preserved", false, true, 1, "HTTP/1.1"},
+		{"tls h2 preserved", false, true, 2, "HTTP/2.0"},
+		{"h2c h1 preserved", true, true, 1, "HTTP/1.1"},
+		{"h2c h2 preserved", true, true, 2, "HTTP/2.0"},
+	} {
+		origin := protoOrigin(test.h2c)
+		proxy := NewProxy(origin.Client().Transport).UseCachePath(t.TempDir()).PreserveProto(test.preserve)
+
+		if proto := readBody(t, serve(proxy, request(origin.URL+"/a", test.major))); proto != test.proto {
+			t.Errorf("%s: origin saw %q; want %q", test.name, proto, test.proto)
+		}
+
+		origin.Close()
+	}
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// idempotency shares the response of a request among the requests
+// sent with the same idempotency key while it is in flight; and
+// for the window after, unless that is 0.
+type idempotency struct {
+	header string
+	window time.Duration
+
+	flights flightGroup
+
+	mutex   sync.Mutex
+	results map[string]*idempotentResult
+}
+
+type idempotentResult struct {
+	response *Response
+	expires  time.Time
+}
+
+// UseIdempotencyKey shares one upstream response among the uncacheable
+// requests with the same value of the header (and method and URL); those
+// in flight together, and any within the window after. Unlike the cache
+// nothing is stored; buffered responses are kept in memory meanwhile.
+func (proxy *Proxy) UseIdempotencyKey(
+	header string, window ...time.Duration,
+) *Proxy {
+	defer proxy.configure()()
+	if header == "" {
+		proxy.idempotency = nil
+		return proxy
+	}
+
+	proxy.idempotency = &idempotency{
+		header:  header,
+		results: make(map[string]*idempotentResult),
+	}
+
+	if len(window) == 1 {
+		proxy.idempotency.window = window[0]
+	}
+
+	return proxy
+}
+
+// fetchShared fetches the request traced by the id; unless
+// its idempotency key is shared with another request.
+func (proxy *Proxy) fetchShared(httpRequest *http.Request, id string) *Response {
+	fetch := func() *Response {
+		request := proxy.prepareRequest(httpRequest)
+		request.setRequestID(id)
+		return request.HTTP().Fetch()
+	}
+
+	// Cacheable requests are already shared through the cache.
+	keys := proxy.idempotency
+	if keys == nil || httpRequest.Header.Get(keys.header) == "" ||
+		proxy.cacheableMethod(httpRequest.Method) {
+		return fetch()
+	}
+
+	key := httpRequest.Method + " " + httpRequest.URL.String() +
+		" " + httpRequest.Header.Get(keys.header)
+
+	if response := keys.recent(key); response != nil {
+		proxyLog.WithFields(Fields{"key": key}).Debug("Sharing Recent Idempotent Response")
+		return response.duplicate()
+	}
+
+	response, shared := keys.flights.Do(key, func() *Response {
+		response := fetch()
+		if !response.Streaming() {
+			response.copyBody()
+		}
+
+		return response
+	})
+
+	// A stream can only be read by the one request.
+	if response.Streaming() {
+		if shared {
+			return fetch()
+		}
+
+		return response
+	}
+
+	if !shared && keys.window > 0 {
+		keys.mutex.Lock()
+		keys.results[key] = &idempotentResult{response, time.Now().Add(keys.window)}
+		keys.mutex.Unlock()
+	}
+
+	return response.duplicate()
+}
+
+// recent returns the response shared for the key within the
+// window; forgetting those whose window has passed.
+func (keys *idempotency) recent(key string) *Response {
+	keys.mutex.Lock()
+	defer keys.mutex.Unlock()
+
+	now := time.Now()
+	for stored, result := range keys.results {
+		if now.After(result.expires) {
+			delete(keys.results, stored)
+		}
+	}
+
+	if result, ok := keys.results[key]; ok {
+		return result.response
+	}
+
+	return nil
+}
+
+// duplicate returns a copy of the buffered response with a body and
+// headers of its own; so it can be served alongside the others.
+func (response *Response) duplicate() *Response {
+	duplicate := new(Response)
+	*duplicate = *response
+	duplicate.body, duplicate.tees = nil, nil
+
+	duplicate.proxied = new(http.Response)
+	*duplicate.proxied = *response.proxied
+	duplicate.proxied.Header = make(http.Header)
+	CopyHeaders(response.proxied.Header, duplicate.proxied.Header)
+	duplicate.proxied.Body = ioutil.NopCloser(bytes.NewReader(response.body.Bytes()))
+
+	return duplicate
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookOrigin numbers the requests it gets; holding
+// each until release is closed, if it is given.
+func webhookOrigin(hits *atomic.Int32, release chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		if release != nil {
+			<-release
+		}
+		fmt.Fprintf(w, "result %d", n)
+	}))
+}
+
+func keyedPost(proxy *Proxy, url, key string) *http.Response {
+	httpRequest := newRequest("POST", url, "event")
+	httpRequest.Header.Set("Idempotency-Key", key)
+	return serve(proxy, httpRequest)
+}
+
+func TestIdempotencyKeyInFlight(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	origin := webhookOrigin(&hits, release)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseIdempotencyKey("Idempotency-Key")
+
+	var wg sync.WaitGroup
+	bodies := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies <- readBody(t, keyedPost(proxy, origin.URL+"/hook", "retry-1"))
+		}()
+	}
+
+	// The others join the flight of the first while it is held.
+	waitFor(t, "the first to reach the origin", func() bool {
+		return hits.Load() == 1
+	})
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(bodies)
+
+	for body := range bodies {
+		if body != "result 1" {
+			t.Errorf("duplicate got %q; want the shared result 1", body)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("origin hit %d times; want 1 for the keyed burst", n)
+	}
+}
+
+func TestIdempotencyKeyWindow(t *testing.T) {
+	var hits atomic.Int32
+	origin := webhookOrigin(&hits, nil)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseIdempotencyKey("Idempotency-Key", time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if got := readBody(t, keyedPost(proxy, origin.URL+"/hook", "retry-1")); got != "result 1" {
+			t.Errorf("retry %d = %q; want result 1 within the window", i, got)
+		}
+	}
+
+	// Another key is another request.
+	if got := readBody(t, keyedPost(proxy, origin.URL+"/hook", "retry-2")); got != "result 2" {
+		t.Errorf("other key = %q; want result 2", got)
+	}
+}
+
+func TestIdempotencyKeyNoWindow(t *testing.T) {
+	var hits atomic.Int32
+	origin := webhookOrigin(&hits, nil)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseIdempotencyKey("Idempotency-Key")
+	readBody(t, keyedPost(proxy, origin.URL+"/hook", "retry-1"))
+	readBody(t, keyedPost(proxy, origin.URL+"/hook", "retry-1"))
+
+	if n := hits.Load(); n != 2 {
+		t.Errorf("origin hit %d times; want requests after the flight sent again", n)
+	}
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIfRangeRevalidation(t *testing.T) {
+	var etag, ifRange atomic.Value
+	etag.Store(`"v1"`)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifRange.Store(r.Header.Get("If-Range"))
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("ETag", etag.Load().(string))
+		http.ServeContent(w, r, "a.txt", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer origin.Close()
+
+	// Stale at once; so each Range request goes to the origin.
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	ranged := func() *http.Response {
+		request := newRequest("GET", origin.URL+"/a", "")
+		request.Header.Set("Range", "bytes=2-4")
+		return serve(proxy, request)
+	}
+
+	response := ranged()
+	if body := readBody(t, response); response.StatusCode != http.StatusPartialContent || body != "234" {
+		t.Errorf("matching validator: %d %q; want 206 %q", response.StatusCode, body, "234")
+	}
+	if got := ifRange.Load(); got != `"v1"` {
+		t.Errorf("origin saw If-Range %q; want the cached ETag", got)
+	}
+
+	etag.Store(`"v2"`)
+	response = ranged()
+	if body := readBody(t, response); response.StatusCode != http.StatusOK || body != "0123456789" {
+		t.Errorf("changed validator: %d %q; want 200 and the full body", response.StatusCode, body)
+	}
+	if got := ifRange.Load(); got != `"v1"` {
+		t.Errorf("origin saw If-Range %q; want the cached ETag", got)
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+)
+
+// VerifyCacheIntegrity sets whether cached bodies are checked against
+// the SHA-256 stored in their CacheMetadata before they are served; a
+// body changed on disk, by bit rot or tampering, is removed and fetched
+// again as a miss. Entries stored without a sum are served as they are.
+func (proxy *Proxy) VerifyCacheIntegrity(enable bool) *Proxy {
+	defer proxy.configure()()
+	proxy.verifyIntegrity = enable
+	return proxy
+}
+
+// bodySum returns the hex SHA-256 of the body.
+func bodySum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// intactCache reports if the body of the named cache file still has
+// the Sum of its CacheMetadata; or can't be checked for lack of one.
+func (request *Request) intactCache(name string, meta *CacheMetadata) bool {
+	if meta == nil || meta.Sum == "" {
+		return true
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+
+	defer file.Close()
+
+	reader, _, err := cacheReader(file)
+	if err != nil {
+		return false
+	}
+
+	httpResponse, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return false
+	}
+
+	defer httpResponse.Body.Close()
+
+	// Or the body it references under DedupeBodies.
+	var body io.Reader = httpResponse.Body
+	if httpResponse.Header.Get(cacheBodyHeader) != "" {
+		stored := request.openBody(httpResponse, meta)
+		if stored == nil {
+			return false
+		}
+
+		defer stored.Close()
+		body = stored
+	}
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, body); err != nil {
+		request.traced(cacheLog).WithFields(Fields{"name": name}).WithError(err).Warning("Could Not Read Cached Body")
+		return false
+	}
+
+	if actual := hex.EncodeToString(sum.Sum(nil)); actual != meta.Sum {
+		request.traced(cacheLog).WithFields(Fields{
+			"name":     name,
+			"expected": meta.Sum,
+			"actual":   actual,
+		}).Warning("Cached Body Failed Integrity Check")
+		return false
+	}
+
+	return true
+}
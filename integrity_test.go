@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheIntegrity(t *testing.T) {
+	for _, test := range []struct {
+		verify  bool
+		fetches int32
+		body    string
+	}{
+		{true, 2, "/page"},
+		{false, 1, "/pXge"},
+	} {
+		var fetches atomic.Int32
+		origin := cacheOrigin(&fetches)
+		defer origin.Close()
+
+		root := t.TempDir()
+		proxy := NewProxy().UseCachePath(root).VerifyCacheIntegrity(test.verify)
+		readBody(t, get(proxy, origin.URL+"/page"))
+
+		// Rot a byte of the cached body; its length is unchanged.
+		data := cacheFileOf(t, root)
+		if !bytes.HasSuffix(data, []byte("/page")) {
+			t.Fatalf("cache file does not end with the body: %q", data)
+		}
+		data[len(data)-3] = 'X'
+		if err := ioutil.WriteFile(entryFiles(t, root)[0], data, 0644); err != nil {
+			t.Fatalf("corrupting cache file: %v", err)
+		}
+
+		if body := readBody(t, get(proxy, origin.URL+"/page")); body != test.body {
+			t.Errorf("verify %t: body = %q; want %q", test.verify, body, test.body)
+		}
+		if got := fetches.Load(); got != test.fetches {
+			t.Errorf("verify %t: fetches = %d; want %d", test.verify, got, test.fetches)
+		}
+	}
+
+	// The refetched body is cached again intact.
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).VerifyCacheIntegrity(true)
+	readBody(t, get(proxy, origin.URL+"/page"))
+
+	data := cacheFileOf(t, root)
+	data[len(data)-1] = 'X'
+	ioutil.WriteFile(entryFiles(t, root)[0], data, 0644)
+
+	for i := 0; i < 3; i++ {
+		readBody(t, get(proxy, origin.URL+"/page"))
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("fetches = %d; want the corrupt entry refetched once", got)
+	}
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+)
+
+// invalidatingHeaders are the headers of a write left out of the GET
+// naming the cached response it invalidates; the GET wouldn't have them.
+var invalidatingHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Encoding", "Content-Md5",
+	"If-Match", "If-Unmodified-Since", "Expect",
+}
+
+// invalidates reports if a response of the status to the request
+// method changed the resource; so its cached GET is stale.
+func invalidates(method string, status int) bool {
+	switch method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	}
+
+	return status >= http.StatusOK && status < http.StatusMultipleChoices
+}
+
+// invalidateCache removes the cached GET response of the URL of the
+// request; after a successful PUT, POST or DELETE (RFC 7234 4.4). The
+// GET is named as FetchCache would name it, from the request sent
+// upstream less the headers of the write; so CacheNameSHA1 names only
+// match if the headers telling them apart are in CacheKeyHeaders.
+func (request *Request) invalidateCache() {
+	get := &Request{
+		cachePath:      request.cachePath,
+		cacheNameStyle: request.cacheNameStyle,
+		cacheSharding:  request.cacheSharding,
+		proxy:          request.proxy,
+		original:       request.invalidatedGet(request.original),
+		proxied:        request.invalidatedGet(request.proxied),
+		copiedHeaders:  true,
+		requestID:      request.requestID,
+	}
+
+	// Named up front by prepareRequest; as the GET would have been.
+	if get.cacheNameStyle == CacheNameURI {
+		get.SetCacheName(request.proxy.uriCacheName(get.original))
+	}
+
+	name := get.FullCacheName()
+	if err := request.proxy.removeCacheEntry(name); err != nil {
+		if !os.IsNotExist(err) {
+			request.traced(cacheLog).WithError(err).Error("Could Not Invalidate Cache")
+		}
+
+		return
+	}
+
+	request.traced(cacheLog).WithFields(Fields{
+		"method": request.proxied.Method,
+		"name":   name,
+	}).Debug("Invalidated Cached Response")
+}
+
+// invalidatedGet returns a bodiless GET copy of the write request;
+// without the headers a GET of the resource wouldn't have.
+func (request *Request) invalidatedGet(httpRequest *http.Request) *http.Request {
+	get := httpRequest.Clone(httpRequest.Context())
+	get.Method, get.Body, get.GetBody, get.ContentLength = "GET", nil, nil, 0
+	for _, header := range invalidatingHeaders {
+		get.Header.Del(header)
+	}
+
+	if keys := request.proxy.idempotency; keys != nil {
+		get.Header.Del(keys.header)
+	}
+
+	return get
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// versionedOrigin serves a resource a PUT bumps the version of; when
+// its If-Match is of the current version, else 412 Precondition Failed.
+func versionedOrigin(gets *atomic.Int32) *httptest.Server {
+	var version atomic.Int32
+	version.Store(1)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		switch r.Method {
+		case "PUT":
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			version.Add(1)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			gets.Add(1)
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", etag)
+			w.Write([]byte(etag))
+		}
+	}))
+}
+
+func TestWriteInvalidatesCachedGet(t *testing.T) {
+	for _, style := range []CacheNameStyle{CacheNameSHA1, CacheNameURI} {
+		var gets atomic.Int32
+		origin := versionedOrigin(&gets)
+
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseCacheNameStyle(style)
+		put := func(ifMatch string) int {
+			request := newRequest("PUT", origin.URL+"/r", "updated")
+			request.Header.Set("Content-Type", "text/plain")
+			request.Header.Set("If-Match", ifMatch)
+			response := serve(proxy, request)
+			readBody(t, response)
+			return response.StatusCode
+		}
+
+		for i := 0; i < 2; i++ {
+			if body := readBody(t, get(proxy, origin.URL+"/r")); body != `"v1"` {
+				t.Errorf("style %v: get %d = %s; want \"v1\"", style, i, body)
+			}
+		}
+
+		// Forwarded with its If-Match; and the GET is refetched after.
+		if status := put(`"v1"`); status != http.StatusNoContent {
+			t.Fatalf("style %v: PUT = %d; want 204", style, status)
+		}
+		if body := readBody(t, get(proxy, origin.URL+"/r")); body != `"v2"` {
+			t.Errorf("style %v: get after PUT = %s; want \"v2\"", style, body)
+		}
+
+		// A failed write changed nothing; the GET stays cached.
+		if status := put(`"v1"`); status != http.StatusPreconditionFailed {
+			t.Fatalf("style %v: stale PUT = %d; want 412", style, status)
+		}
+		readBody(t, get(proxy, origin.URL+"/r"))
+
+		if gets.Load() != 2 {
+			t.Errorf("style %v: origin served %d GETs; want 2", style, gets.Load())
+		}
+
+		origin.Close()
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// keepAliveOptions returns whether the connection sends TCP keep-alive
+// probes and the seconds it idles before the first.
+func keepAliveOptions(t *testing.T, conn net.Conn) (enabled bool, idle int) {
+	t.Helper()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn: %v", err)
+	}
+
+	var keepAlive int
+	raw.Control(func(fd uintptr) {
+		keepAlive, _ = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_KEEPALIVE)
+		idle, _ = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE)
+	})
+
+	return keepAlive != 0, idle
+}
+
+func TestKeepAliveDialer(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	for _, test := range []struct {
+		name      string
+		transport []http.RoundTripper
+		period    time.Duration
+		enabled   bool
+		idle      int
+	}{
+		{"default", nil, 7 * time.Second, true, 7},
+		{"default disabled", nil, 0, false, 0},
+		{"without dialer", []http.RoundTripper{new(http.Transport)}, 9 * time.Second, true, 9},
+	} {
+		proxy := NewProxy(test.transport...).UseKeepAlive(test.period)
+
+		transport, ok := proxy.Transport().(*http.Transport)
+		if !ok || transport.DialContext == nil {
+			t.Fatalf("%s: transport has no dialer", test.name)
+		}
+
+		conn, err := transport.DialContext(context.Background(), "tcp", origin.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: dial: %v", test.name, err)
+		}
+
+		enabled, idle := keepAliveOptions(t, conn)
+		conn.Close()
+
+		if enabled != test.enabled || test.enabled && idle != test.idle {
+			t.Errorf("%s: keep-alive %t after %ds; want %t after %ds",
+				test.name, enabled, idle, test.enabled, test.idle)
+		}
+	}
+}
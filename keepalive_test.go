@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepAliveKeepsTransportDialer(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	var dials atomic.Int32
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials.Add(1)
+			return new(net.Dialer).DialContext(ctx, network, addr)
+		},
+	}
+
+	proxy := NewProxy(transport).UseCachePath(t.TempDir()).UseKeepAlive(time.Minute)
+	if body := readBody(t, get(proxy, origin.URL+"/page")); body != "/page" {
+		t.Errorf("body = %q; want %q", body, "/page")
+	}
+
+	if got := dials.Load(); got != 1 {
+		t.Errorf("dials = %d; want the dialer of the transport used", got)
+	}
+}
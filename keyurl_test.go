@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheKeyFragment(t *testing.T) {
+	for _, style := range []CacheNameStyle{CacheNameSHA1, CacheNameURI} {
+		var fetches atomic.Int32
+		origin := cacheOrigin(&fetches)
+
+		root := t.TempDir()
+		proxy := NewProxy().UseCachePath(root).UseCacheNameStyle(style)
+		// Built as URL objects; a fragment never reaches a server.
+		for _, path := range []string{"/a", "/a#section", "/a#other"} {
+			httpRequest, err := http.NewRequest("GET", origin.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			proxy.Fetch(httpRequest).WriteTo(recorder)
+			if body := recorder.Body.String(); body != "/a" {
+				t.Errorf("style %v: %s: body = %q", style, path, body)
+			}
+		}
+
+		if fetches.Load() != 1 || len(entryFiles(t, root)) != 1 {
+			t.Errorf("style %v: %d fetches of %d entries; want the fragments keyed as none",
+				style, fetches.Load(), len(entryFiles(t, root)))
+		}
+
+		origin.Close()
+	}
+}
+
+func TestCacheKeyDefaultFile(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseDefaultFile("index.html")
+	readBody(t, get(proxy, origin.URL+"/docs/index.html"))
+	readBody(t, get(proxy, origin.URL+"/docs/"))
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want /docs/ served as /docs/index.html", fetches.Load())
+	}
+
+	for uri, want := range map[string]string{
+		"http://example.com":           "http://example.com/index.html",
+		"http://example.com/docs/#top": "http://example.com/docs/index.html",
+		"http://example.com/docs?q=1":  "http://example.com/docs?q=1",
+		"http://example.com/a%2Fb/":    "http://example.com/a%2Fb/index.html",
+	} {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := proxy.snapshot().keyURL(parsed).String(); got != want {
+			t.Errorf("keyURL(%s) = %s; want %s", uri, got, want)
+		}
+	}
+}
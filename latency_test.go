@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpstreamLatency(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+
+	response := proxy.Fetch(newRequest("GET", origin.URL+"/a", ""))
+	if latency := response.UpstreamLatency(); latency < delay {
+		t.Errorf("live latency = %v; want at least %v", latency, delay)
+	}
+	response.WriteTo(httptest.NewRecorder())
+
+	response = proxy.Fetch(newRequest("GET", origin.URL+"/a", ""))
+	if !response.cached {
+		t.Fatal("second fetch was not served from the cache")
+	}
+	if latency := response.UpstreamLatency(); latency != 0 {
+		t.Errorf("cached latency = %v; want 0", latency)
+	}
+	response.WriteTo(httptest.NewRecorder())
+}
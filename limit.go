@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ErrTooManyFetches is returned once the fetches queued
+// for UseMaxConcurrentFetches are already at their limit.
+var ErrTooManyFetches = errors.New("proxy: too many upstream fetches")
+
+// fetchLimiter bounds the upstream fetches in progress; the
+// others wait for a slot while there is room in the queue.
+type fetchLimiter struct {
+	// admitted holds a token for each fetch running or queued.
+	admitted chan struct{}
+	running  chan struct{}
+}
+
+// acquire waits for a slot to fetch in; unless the queue is full
+// already, or the request is canceled while it waits.
+func (limiter *fetchLimiter) acquire(httpRequest *http.Request) error {
+	select {
+	case limiter.admitted <- struct{}{}:
+	default:
+		return ErrTooManyFetches
+	}
+
+	select {
+	case limiter.running <- struct{}{}:
+		return nil
+	case <-httpRequest.Context().Done():
+		<-limiter.admitted
+		return httpRequest.Context().Err()
+	}
+}
+
+func (limiter *fetchLimiter) release() {
+	<-limiter.running
+	<-limiter.admitted
+}
+
+// limitedBody holds the fetch slot until the body is closed;
+// the connection stays in use for as long as it is read.
+type limitedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	limiter *fetchLimiter
+}
+
+func (body *limitedBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.limiter.release)
+	return err
+}
+
+// UseMaxConcurrentFetches limits the upstream fetches in progress to
+// max; with up to queued more waiting for one to finish (max unless
+// given). Beyond that requests are answered with 503 Service
+// Unavailable. A fetch lasts until its response body is closed.
+func (proxy *Proxy) UseMaxConcurrentFetches(max int, queued ...int) *Proxy {
+	defer proxy.configure()()
+	if max <= 0 {
+		proxy.fetches = nil
+		return proxy
+	}
+
+	queue := max
+	if len(queued) == 1 {
+		queue = queued[0]
+	}
+
+	proxy.fetches = &fetchLimiter{
+		admitted: make(chan struct{}, max+queue),
+		running:  make(chan struct{}, max),
+	}
+
+	return proxy
+}
+
+// limitedRoundTrip sends the request through the transport within
+// the fetch limits of the Proxy; holding the slot until the body
+// of the response is closed.
+func (proxy *Proxy) limitedRoundTrip(
+	transport http.RoundTripper, httpRequest *http.Request,
+) (*http.Response, error) {
+	limiter := proxy.fetches
+	if limiter == nil {
+		return transport.RoundTrip(httpRequest)
+	}
+
+	if err := limiter.acquire(httpRequest); err == ErrTooManyFetches {
+		requestLog.Warning("Fetch Queue is Full")
+		return nil, err
+	} else if err != nil {
+		requestLog.WithError(err).Debug("Canceled Waiting For Fetch")
+		return nil, err
+	}
+
+	httpResponse, err := transport.RoundTrip(httpRequest)
+	if err != nil || httpRequest.Method == "HEAD" ||
+		httpResponse.Body == nil || httpResponse.Body == http.NoBody {
+		limiter.release()
+		return httpResponse, err
+	}
+
+	httpResponse.Body = &limitedBody{
+		ReadCloser: httpResponse.Body,
+		limiter:    limiter,
+	}
+
+	return httpResponse, nil
+}
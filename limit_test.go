@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatedOrigin holds each request until release is closed; counting
+// those in progress at once.
+func gatedOrigin(release chan struct{}, running, peak *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := running.Add(1)
+		defer running.Add(-1)
+		for {
+			seen := peak.Load()
+			if now <= seen || peak.CompareAndSwap(seen, now) {
+				break
+			}
+		}
+
+		<-release
+		w.Write([]byte("done"))
+	}))
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !done(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxConcurrentFetches(t *testing.T) {
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	origin := gatedOrigin(release, &running, &peak)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseMaxConcurrentFetches(2, 8)
+
+	var wg sync.WaitGroup
+	statuses := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response := serve(proxy, newRequest("POST", origin.URL+"/burst", ""))
+			readBody(t, response)
+			statuses <- response.StatusCode
+		}()
+	}
+
+	// Two fetching, eight queued; the rest of the burst is turned away.
+	waitFor(t, "the fetch slots to fill", func() bool { return running.Load() == 2 })
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+
+	if n := peak.Load(); n > 2 {
+		t.Errorf("%d upstream fetches at once; want at most 2", n)
+	}
+	if counts[http.StatusOK] != 10 {
+		t.Errorf("statuses = %v; want all 10 served within the queue", counts)
+	}
+}
+
+func TestMaxConcurrentFetchesQueueFull(t *testing.T) {
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	origin := gatedOrigin(release, &running, &peak)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseMaxConcurrentFetches(1, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readBody(t, serve(proxy, newRequest("POST", origin.URL+"/held", "")))
+	}()
+	waitFor(t, "the fetch slot to fill", func() bool { return running.Load() == 1 })
+
+	response := serve(proxy, newRequest("POST", origin.URL+"/turned-away", ""))
+	readBody(t, response)
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status with the queue full = %d; want 503", response.StatusCode)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestMaxConcurrentFetchesCanceledWaiterLeavesQueue(t *testing.T) {
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	origin := gatedOrigin(release, &running, &peak)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseMaxConcurrentFetches(1, 1)
+
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		readBody(t, serve(proxy, newRequest("POST", origin.URL+"/held", "")))
+	}()
+	waitFor(t, "the fetch slot to fill", func() bool { return running.Load() == 1 })
+
+	// Queued; then canceled before it gets a slot.
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan struct{})
+	go func() {
+		defer close(canceled)
+		readBody(t, serve(proxy, newRequest("POST", origin.URL+"/canceled", "").WithContext(ctx)))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled request still waiting for a fetch slot")
+	}
+
+	// Its place in the queue was given up; so this one queues.
+	queued := make(chan int, 1)
+	go func() {
+		response := serve(proxy, newRequest("POST", origin.URL+"/queued", ""))
+		readBody(t, response)
+		queued <- response.StatusCode
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if status := <-queued; status != http.StatusOK {
+		t.Errorf("status after the canceled waiter left = %d; want 200", status)
+	}
+	<-held
+}
@@ -1,18 +1,39 @@
 package proxy
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/op/go-logging"
 )
 
-var log = logging.MustGetLogger("proxy")
+var logger = logging.MustGetLogger("proxy")
 
 var logFormat = logging.MustStringFormatter(
 	"%{color}%{time:15:04:05.000} %{shortfunc:10s} ▶ " +
 		"%{level:.4s} %{id:03x}%{color:reset} %{message}",
 )
 
+// Fields are the key-value pairs attached to a structured log message.
+type Fields map[string]interface{}
+
+// logEntry writes log messages followed by its Fields as key=value pairs.
+type logEntry struct {
+	fields Fields
+}
+
+var (
+	log         = new(logEntry)
+	proxyLog    = log.WithFields(Fields{"subsystem": "proxy"})
+	requestLog  = log.WithFields(Fields{"subsystem": "request"})
+	responseLog = log.WithFields(Fields{"subsystem": "response"})
+	cacheLog    = log.WithFields(Fields{"subsystem": "cache"})
+)
+
 func init() {
 	backendStdout := logging.NewBackendFormatter(
 		logging.NewLogBackend(os.Stdout, "", 0),
@@ -29,4 +50,82 @@ func init() {
 	backendStderr.SetLevel(logging.ERROR, "")
 
 	logging.SetBackend(backendStdout, backendStderr)
+
+	// Report the caller of the logEntry rather than the logEntry itself.
+	logger.ExtraCalldepth = 1
+}
+
+// WithFields returns a logEntry carrying both its own and the given fields.
+func (entry *logEntry) WithFields(fields Fields) *logEntry {
+	merged := make(Fields, len(entry.fields)+len(fields))
+
+	for key, value := range entry.fields {
+		merged[key] = value
+	}
+
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	return &logEntry{merged}
+}
+
+// WithError is shorthand for WithFields(Fields{"error": err}).
+func (entry *logEntry) WithError(err error) *logEntry {
+	return entry.WithFields(Fields{"error": err})
+}
+
+func (entry *logEntry) Debug(message string) {
+	if logger.IsEnabledFor(logging.DEBUG) {
+		logger.Debugf("%s", entry.format(message))
+	}
+}
+
+func (entry *logEntry) Info(message string) {
+	if logger.IsEnabledFor(logging.INFO) {
+		logger.Infof("%s", entry.format(message))
+	}
+}
+
+func (entry *logEntry) Notice(message string) {
+	if logger.IsEnabledFor(logging.NOTICE) {
+		logger.Noticef("%s", entry.format(message))
+	}
+}
+
+func (entry *logEntry) Warning(message string) {
+	if logger.IsEnabledFor(logging.WARNING) {
+		logger.Warningf("%s", entry.format(message))
+	}
+}
+
+func (entry *logEntry) Error(message string) {
+	if logger.IsEnabledFor(logging.ERROR) {
+		logger.Errorf("%s", entry.format(message))
+	}
+}
+
+// format appends the fields sorted by key; values
+// with spaces, quotes or newlines are quoted.
+func (entry *logEntry) format(message string) string {
+	keys := make([]string, 0, len(entry.fields))
+	for key := range entry.fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(message)
+
+	for _, key := range keys {
+		value := fmt.Sprint(entry.fields[key])
+		if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+			value = strconv.Quote(value)
+		}
+
+		fmt.Fprintf(&buffer, " %s=%s", key, value)
+	}
+
+	return buffer.String()
 }
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/op/go-logging"
+)
+
+// captureLogs records the messages logged until the returned func is called.
+func captureLogs() (messages func() []string, restore func()) {
+	memory := logging.NewMemoryBackend(1024)
+	leveled := logging.AddModuleLevel(memory)
+	leveled.SetLevel(logging.DEBUG, "")
+	logger.SetBackend(leveled)
+
+	messages = func() (lines []string) {
+		for node := memory.Head(); node != nil; node = node.Next() {
+			lines = append(lines, node.Record.Message())
+		}
+		return lines
+	}
+
+	restore = func() {
+		logger = logging.MustGetLogger("proxy")
+		logger.ExtraCalldepth = 1
+	}
+
+	return messages, restore
+}
+
+func findLog(lines []string, prefix string) string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestLogFields(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	messages, restore := captureLogs()
+	defer restore()
+
+	request := newRequest("GET", origin.URL+"/page", "")
+	request.Header.Set("Authorization", "Basic c2VjcmV0")
+	request.Header.Set("Cookie", "session=secret")
+	readBody(t, serve(NewProxy().UseCachePath(t.TempDir()), request))
+
+	lines := messages()
+	for _, line := range lines {
+		if strings.HasPrefix(line, "%") {
+			t.Errorf("message has a format verb prefix: %q", line)
+		}
+	}
+
+	miss := findLog(lines, "No Valid Cached Response")
+	if !strings.Contains(miss, " subsystem=cache") {
+		t.Errorf("miss message lacks the cache subsystem: %q", miss)
+	}
+
+	fetch := findLog(lines, "Fetching Response From Request")
+	if !strings.Contains(fetch, " method=GET") || !strings.Contains(fetch, " subsystem=request") {
+		t.Errorf("fetch message lacks its fields: %q", fetch)
+	}
+	if !strings.Contains(fetch, " url="+origin.URL+"/page") {
+		t.Errorf("fetch message lacks the url: %q", fetch)
+	}
+	if strings.Contains(fetch, "secret") {
+		t.Errorf("fetch message logs credentials: %q", fetch)
+	}
+}
+
+func TestLogFieldsQuoted(t *testing.T) {
+	messages, restore := captureLogs()
+	defer restore()
+
+	proxyLog.WithFields(Fields{"path": "/a b", "count": 2}).Warning("Field Check")
+
+	want := `Field Check count=2 path="/a b" subsystem=proxy`
+	if line := findLog(messages(), "Field Check"); line != want {
+		t.Errorf("message = %q; want %q", line, want)
+	}
+}
+
+func TestLogLevelDisabled(t *testing.T) {
+	messages, restore := captureLogs()
+	defer restore()
+
+	defer logging.SetLevel(logging.GetLevel("proxy"), "proxy")
+	logging.SetLevel(logging.INFO, "proxy")
+
+	formatted := false
+	proxyLog.WithFields(Fields{"value": stringer(func() string {
+		formatted = true
+		return "x"
+	})}).Debug("Disabled")
+
+	if formatted || findLog(messages(), "Disabled") != "" {
+		t.Error("a disabled level formatted or logged its message")
+	}
+}
+
+type stringer func() string
+
+func (s stringer) String() string { return s() }
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMalformedCacheFileIsMiss(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+	name := LoadRequest(newRequest("GET", origin.URL+"/m", "")).
+		SetCachePath(root).FullCacheName()
+
+	for i, contents := range []string{
+		"HTTP/1.1 000 Zero\r\nContent-Length: 7\r\n\r\ngarbage",
+		"HTTP/1.1 42 Low\r\n\r\n",
+		"not a response at all",
+		"",
+	} {
+		readBody(t, get(proxy, origin.URL+"/m"))
+		if err := ioutil.WriteFile(name, []byte(contents), 0600); err != nil {
+			t.Fatalf("corrupting the cache file: %v", err)
+		}
+
+		before := fetches.Load()
+		response := get(proxy, origin.URL+"/m")
+		if got := readBody(t, response); response.StatusCode != 200 || got != "/m" {
+			t.Errorf("file %d: served %d %q; want the origin's response", i, response.StatusCode, got)
+		}
+		if fetches.Load() != before+1 {
+			t.Errorf("file %d: malformed cache file served as a hit", i)
+		}
+	}
+}
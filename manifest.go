@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// manifestEntry is a JSON line of a warming manifest.
+type manifestEntry struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// ManifestError is the error of a line of a warming manifest.
+type ManifestError struct {
+	Line  int
+	Entry string
+	Err   error
+}
+
+func (err *ManifestError) Error() string {
+	return fmt.Sprintf("proxy: manifest line %d (%s): %v", err.Line, err.Entry, err.Err)
+}
+
+// ManifestErrors are the errors of the lines of a warming manifest.
+type ManifestErrors []*ManifestError
+
+func (errs ManifestErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// WarmFromManifest fetches the URLs listed in the manifest file through
+// the proxy so they are cached; a few at a time. Each line is a URL, or
+// a JSON object with a "url" and optional "headers"; blank lines and
+// those starting with "#" are skipped.
+//
+// Lines that can't be parsed or fetched are returned as ManifestErrors;
+// after the rest of the manifest has been warmed.
+func (proxy *Proxy) WarmFromManifest(path string) error {
+	proxy = proxy.snapshot()
+
+	file, err := os.Open(path)
+	if err != nil {
+		proxyLog.WithFields(Fields{"manifest": path}).WithError(err).Error("Could Not Open Manifest")
+		return err
+	}
+
+	defer file.Close()
+
+	var errs ManifestErrors
+	var lines []int
+	var httpRequests []*http.Request
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		httpRequest, err := manifestRequest(line)
+		if err != nil {
+			errs = append(errs, &ManifestError{number, line, err})
+			continue
+		}
+
+		lines = append(lines, number)
+		httpRequests = append(httpRequests, httpRequest)
+	}
+
+	if err := scanner.Err(); err != nil {
+		proxyLog.WithFields(Fields{"manifest": path}).WithError(err).Error("Could Not Read Manifest")
+		return err
+	}
+
+	proxyLog.WithFields(Fields{
+		"manifest": path,
+		"entries":  len(httpRequests),
+	}).Info("Warming Cache From Manifest")
+
+	for i, err := range proxy.warm(httpRequests) {
+		if err != nil {
+			errs = append(errs, &ManifestError{lines[i], httpRequests[i].URL.String(), err})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	proxyLog.WithFields(Fields{"manifest": path, "errors": len(errs)}).Warning("Manifest Entries Failed")
+	return errs
+}
+
+// manifestRequest returns the GET request of a manifest line.
+func manifestRequest(line string) (*http.Request, error) {
+	entry := manifestEntry{URL: line}
+
+	if strings.HasPrefix(line, "{") {
+		entry = manifestEntry{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, err
+		}
+	}
+
+	uri, err := url.Parse(entry.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if uri.Scheme != "http" && uri.Scheme != "https" || uri.Host == "" {
+		return nil, fmt.Errorf("proxy: not an absolute http URL: %q", entry.URL)
+	}
+
+	httpRequest, err := http.NewRequest("GET", uri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for header, value := range entry.Headers {
+		httpRequest.Header.Set(header, value)
+	}
+
+	return httpRequest, nil
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWarmFromManifest(t *testing.T) {
+	var mutex sync.Mutex
+	seen := make(map[string]string)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		seen[r.URL.Path] = r.Header.Get("X-Tenant")
+		mutex.Unlock()
+
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	if err := ioutil.WriteFile(manifest, []byte(strings.Join([]string{
+		"# warmed on deploy",
+		origin.URL + "/a",
+		"",
+		`{"url": "` + origin.URL + `/b", "headers": {"X-Tenant": "acme"}}`,
+		`{"url": `,
+		"/relative",
+		origin.URL + "/c",
+		origin.URL + "/missing",
+	}, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+	err := proxy.WarmFromManifest(manifest)
+
+	var errs ManifestErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v; want ManifestErrors", err)
+	}
+
+	var lines []int
+	for _, err := range errs {
+		lines = append(lines, err.Line)
+	}
+	sort.Ints(lines)
+	if len(lines) != 3 || lines[0] != 5 || lines[1] != 6 || lines[2] != 8 {
+		t.Errorf("failed lines = %v; want [5 6 8]", lines)
+	}
+
+	if tenant, ok := seen["/b"]; !ok || tenant != "acme" {
+		t.Errorf("origin saw /b with X-Tenant %q; want acme", tenant)
+	}
+
+	// Served from the cache; as the manifest requested them.
+	for _, line := range []string{
+		origin.URL + "/a",
+		`{"url": "` + origin.URL + `/b", "headers": {"X-Tenant": "acme"}}`,
+		origin.URL + "/c",
+	} {
+		httpRequest, err := manifestRequest(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if response := proxy.Fetch(httpRequest); !response.cached {
+			t.Errorf("%s was not warmed", line)
+		} else {
+			response.proxied.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// CacheMetadata is the request a cache entry is named by; stored
+// under the cache meta directory by the Proxy MetadataCodec. Body is
+// the start of the request body under CaptureRequestBodies. Sum is the
+// hex SHA-256 of the cached response body; see VerifyCacheIntegrity.
+// FreshUntil is when the response stopped being fresh as it was stored,
+// if it had a lifetime; RetainUntil when UseRetentionTTL deletes it.
+type CacheMetadata struct {
+	Method      string
+	URL         string
+	Host        string
+	Header      http.Header
+	Body        []byte    `json:",omitempty"`
+	Sum         string    `json:",omitempty"`
+	FreshUntil  time.Time `json:",omitzero"`
+	RetainUntil time.Time `json:",omitzero"`
+}
+
+// The headers carrying the Sum, FreshUntil and
+// RetainUntil of a CacheMetadata in the HTTPMetadataCodec.
+const (
+	metaSumHeader    = "X-Go-Proxy-Body-Sha256"
+	metaFreshHeader  = "X-Go-Proxy-Fresh-Until"
+	metaRetainHeader = "X-Go-Proxy-Retain-Until"
+)
+
+// MetadataCodec encodes the CacheMetadata stored with the cache
+// entries; the cached responses themselves are unaffected.
+type MetadataCodec interface {
+	Encode(writer io.Writer, meta *CacheMetadata) error
+	Decode(reader io.Reader) (*CacheMetadata, error)
+}
+
+var (
+	// HTTPMetadataCodec stores the request as it would be sent
+	// to a proxy; without a body. It is the default.
+	HTTPMetadataCodec MetadataCodec = httpMetadataCodec{}
+
+	// JSONMetadataCodec stores the CacheMetadata as JSON; for
+	// inspecting the cache with other tools.
+	JSONMetadataCodec MetadataCodec = jsonMetadataCodec{}
+
+	// GobMetadataCodec stores the CacheMetadata compactly with gob.
+	GobMetadataCodec MetadataCodec = gobMetadataCodec{}
+)
+
+// UseMetadataCodec sets how the requests of the cache entries are
+// encoded; HTTPMetadataCodec unless one is set. Those stored by the
+// other built in codecs before are still read.
+func (proxy *Proxy) UseMetadataCodec(codec MetadataCodec) *Proxy {
+	defer proxy.configure()()
+	proxy.metaCodec = codec
+	return proxy
+}
+
+func (proxy *Proxy) metadataCodec() MetadataCodec {
+	if proxy.metaCodec == nil {
+		return HTTPMetadataCodec
+	}
+
+	return proxy.metaCodec
+}
+
+// newCacheMetadata returns the CacheMetadata of the request.
+func newCacheMetadata(httpRequest *http.Request) *CacheMetadata {
+	meta := &CacheMetadata{
+		Method: httpRequest.Method,
+		URL:    httpRequest.URL.String(),
+		Host:   httpRequest.Host,
+		Header: make(http.Header),
+	}
+
+	CopyHeaders(httpRequest.Header, meta.Header)
+	return meta
+}
+
+// Request returns the bodiless *http.Request of the CacheMetadata.
+func (meta *CacheMetadata) Request() (*http.Request, error) {
+	uri, err := url.Parse(meta.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest := &http.Request{
+		Method:     meta.Method,
+		URL:        uri,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Host:       meta.Host,
+	}
+
+	CopyHeaders(meta.Header, httpRequest.Header)
+	return httpRequest, nil
+}
+
+// ReadCacheMetadata returns the CacheMetadata stored with the named
+// cache entry; as named by CacheEntry, OnCacheStore and Events.
+func (proxy *Proxy) ReadCacheMetadata(name string) (*CacheMetadata, error) {
+	proxy = proxy.snapshot()
+
+	meta, ok := metaName(cacheRoot(proxy.cachePath), name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return proxy.decodeMeta(meta)
+}
+
+// entryMeta decodes the CacheMetadata stored with the named cache
+// entry once, for the checks of a hit; nil if it has none readable.
+func (proxy *Proxy) entryMeta(root string, name string) *CacheMetadata {
+	meta, ok := metaName(root, name)
+	if !ok {
+		return nil
+	}
+
+	stored, err := proxy.decodeMeta(meta)
+	if err != nil {
+		return nil
+	}
+
+	return stored
+}
+
+// readMeta decodes the request stored in the named meta file.
+func (proxy *Proxy) readMeta(name string) (*http.Request, error) {
+	meta, err := proxy.decodeMeta(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta.Request()
+}
+
+// decodeMeta decodes the named meta file; by the Proxy
+// MetadataCodec, else by any of the built in codecs.
+func (proxy *Proxy) decodeMeta(name string) (meta *CacheMetadata, err error) {
+	stored, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	codec := proxy.metadataCodec()
+	for _, codec := range []MetadataCodec{
+		codec, HTTPMetadataCodec, JSONMetadataCodec, GobMetadataCodec,
+	} {
+		if meta, err = codec.Decode(bytes.NewReader(stored)); err == nil {
+			return meta, nil
+		}
+	}
+
+	return nil, err
+}
+
+type httpMetadataCodec struct{}
+
+func (httpMetadataCodec) Encode(writer io.Writer, meta *CacheMetadata) error {
+	httpRequest, err := meta.Request()
+	if err != nil {
+		return err
+	}
+
+	// Without the User-Agent WriteProxy would make up.
+	if _, ok := httpRequest.Header["User-Agent"]; !ok {
+		httpRequest.Header["User-Agent"] = []string{""}
+	}
+
+	// Only ours are decoded; never any the client sent.
+	for _, header := range []string{metaSumHeader, metaFreshHeader, metaRetainHeader} {
+		httpRequest.Header.Del(header)
+	}
+
+	if meta.Sum != "" {
+		httpRequest.Header.Set(metaSumHeader, meta.Sum)
+	}
+
+	for header, deadline := range map[string]time.Time{
+		metaFreshHeader:  meta.FreshUntil,
+		metaRetainHeader: meta.RetainUntil,
+	} {
+		if !deadline.IsZero() {
+			httpRequest.Header.Set(header, deadline.Format(time.RFC3339Nano))
+		}
+	}
+
+	if len(meta.Body) > 0 {
+		httpRequest.Body = ioutil.NopCloser(bytes.NewReader(meta.Body))
+		httpRequest.ContentLength = int64(len(meta.Body))
+		httpRequest.Header.Del("Transfer-Encoding")
+	}
+
+	return httpRequest.WriteProxy(writer)
+}
+
+func (httpMetadataCodec) Decode(reader io.Reader) (*CacheMetadata, error) {
+	httpRequest, err := http.ReadRequest(bufio.NewReader(reader))
+	if err != nil {
+		return nil, err
+	}
+
+	meta := newCacheMetadata(httpRequest)
+	meta.Sum = meta.Header.Get(metaSumHeader)
+	meta.Header.Del(metaSumHeader)
+
+	for header, deadline := range map[string]*time.Time{
+		metaFreshHeader:  &meta.FreshUntil,
+		metaRetainHeader: &meta.RetainUntil,
+	} {
+		if value := meta.Header.Get(header); value != "" {
+			if *deadline, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return nil, err
+			}
+		}
+
+		meta.Header.Del(header)
+	}
+
+	if meta.Body, err = ioutil.ReadAll(httpRequest.Body); err != nil {
+		return nil, err
+	}
+
+	if len(meta.Body) == 0 {
+		meta.Body = nil
+	}
+
+	return meta, nil
+}
+
+type jsonMetadataCodec struct{}
+
+func (jsonMetadataCodec) Encode(writer io.Writer, meta *CacheMetadata) error {
+	return json.NewEncoder(writer).Encode(meta)
+}
+
+func (jsonMetadataCodec) Decode(reader io.Reader) (*CacheMetadata, error) {
+	meta := new(CacheMetadata)
+	return meta, json.NewDecoder(reader).Decode(meta)
+}
+
+type gobMetadataCodec struct{}
+
+func (gobMetadataCodec) Encode(writer io.Writer, meta *CacheMetadata) error {
+	return gob.NewEncoder(writer).Encode(meta)
+}
+
+func (gobMetadataCodec) Decode(reader io.Reader) (*CacheMetadata, error) {
+	meta := new(CacheMetadata)
+	return meta, gob.NewDecoder(reader).Decode(meta)
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetadataCodecRoundTrip(t *testing.T) {
+	meta := &CacheMetadata{
+		Method: "POST",
+		URL:    "http://example.com/search?q=go",
+		Host:   "example.com",
+		Header: http.Header{
+			"Accept":     {"text/html"},
+			"User-Agent": {"go.proxy"},
+			"X-Multi":    {"a", "b"},
+		},
+		Body:        []byte("q=go"),
+		Sum:         strings.Repeat("ab", 32),
+		FreshUntil:  time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC),
+		RetainUntil: time.Date(2026, 2, 3, 4, 5, 6, 7000, time.UTC),
+	}
+
+	for name, codec := range map[string]MetadataCodec{
+		"json": JSONMetadataCodec,
+		"gob":  GobMetadataCodec,
+	} {
+		var encoded bytes.Buffer
+		if err := codec.Encode(&encoded, meta); err != nil {
+			t.Fatalf("%s: encode: %v", name, err)
+		}
+
+		decoded, err := codec.Decode(&encoded)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", name, err)
+		}
+
+		if !reflect.DeepEqual(decoded, meta) {
+			t.Errorf("%s: round trip = %+v; want %+v", name, decoded, meta)
+		}
+	}
+
+	// Written as a request; so only what it has headers for.
+	var encoded bytes.Buffer
+	if err := HTTPMetadataCodec.Encode(&encoded, meta); err != nil {
+		t.Fatalf("http: encode: %v", err)
+	}
+
+	decoded, err := HTTPMetadataCodec.Decode(&encoded)
+	if err != nil {
+		t.Fatalf("http: decode: %v", err)
+	}
+
+	if decoded.Sum != meta.Sum || !decoded.FreshUntil.Equal(meta.FreshUntil) ||
+		!decoded.RetainUntil.Equal(meta.RetainUntil) || decoded.Header.Get(metaRetainHeader) != "" {
+		t.Errorf("http: round trip = %+v; want %+v", decoded, meta)
+	}
+}
+
+func TestMetadataCodecStored(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseMetadataCodec(JSONMetadataCodec)
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	metas := cacheFiles(t, filepath.Join(root, cacheMetaDir))
+	if len(metas) != 1 {
+		t.Fatalf("meta files = %q; want 1", metas)
+	}
+
+	// Readable by other tools as plain JSON.
+	stored, err := ioutil.ReadFile(metas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded CacheMetadata
+	if err := json.Unmarshal(stored, &decoded); err != nil || decoded.URL != origin.URL+"/a" {
+		t.Errorf("stored meta = %q, %v; want JSON of the request", stored, err)
+	}
+
+	// And by a Proxy set to another codec.
+	name := entryFiles(t, root)[0]
+	meta, err := NewProxy().UseCachePath(root).UseMetadataCodec(GobMetadataCodec).ReadCacheMetadata(name)
+	if err != nil || meta.Method != "GET" || meta.URL != origin.URL+"/a" {
+		t.Errorf("ReadCacheMetadata = %+v, %v", meta, err)
+	}
+}
+
+// countingCodec is JSONMetadataCodec counting its decodes.
+type countingCodec struct{ decodes *atomic.Int32 }
+
+func (codec countingCodec) Encode(writer io.Writer, meta *CacheMetadata) error {
+	return JSONMetadataCodec.Encode(writer, meta)
+}
+
+func (codec countingCodec) Decode(reader io.Reader) (*CacheMetadata, error) {
+	codec.decodes.Add(1)
+	return JSONMetadataCodec.Decode(reader)
+}
+
+func TestMetadataDecodedOncePerHit(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	var decodes atomic.Int32
+	proxy := NewProxy().UseCachePath(t.TempDir()).
+		UseMetadataCodec(countingCodec{&decodes}).
+		UseRetentionTTL(time.Hour).
+		VerifyCacheIntegrity(true)
+	readBody(t, get(proxy, origin.URL+"/page"))
+
+	// The collision, retention and integrity checks share it.
+	decodes.Store(0)
+	readBody(t, get(proxy, origin.URL+"/page"))
+	if n := decodes.Load(); n != 1 {
+		t.Errorf("metadata decoded %d times for one hit; want 1", n)
+	}
+}
+
+func TestMetadataWithoutCredentials(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+
+	httpRequest := newRequest("GET", origin.URL+"/a", "")
+	httpRequest.Header.Set("Authorization", "Bearer secret")
+	httpRequest.Header.Set("Cookie", "session=secret")
+	httpRequest.Header.Set("Accept", "text/plain")
+	readBody(t, serve(proxy, httpRequest))
+
+	metas := cacheFiles(t, filepath.Join(root, cacheMetaDir))
+	if len(metas) != 1 {
+		t.Fatalf("meta files = %q; want 1", metas)
+	}
+
+	stored, err := ioutil.ReadFile(metas[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte("secret")) {
+		t.Errorf("stored meta has the credentials:\n%s", stored)
+	}
+	if !bytes.Contains(stored, []byte("text/plain")) {
+		t.Errorf("stored meta lost the other headers:\n%s", stored)
+	}
+
+	if info, err := os.Stat(metas[0]); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("meta file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// AllowedMethods are answered in the Allow header of an
+// OPTIONS request the proxy answers itself.
+var AllowedMethods = "GET, HEAD, POST, PUT, DELETE, OPTIONS, TRACE"
+
+// asteriskForm targets OPTIONS at the server as a whole; as asked
+// by "*", or by the absolute-form without a path (RFC 7230 5.3.4).
+func (request *Request) asteriskForm() bool {
+	uri := request.proxied.URL
+	return request.proxied.Method == "OPTIONS" &&
+		(uri.Path == "*" || uri.Path == "" && uri.Host != "")
+}
+
+// setAsteriskForm forwards the request with the "*" target; to
+// the Host of the request unless the absolute-form named one.
+func (request *Request) setAsteriskForm() {
+	uri := *request.proxied.URL
+	uri.Path, uri.RawPath = "*", ""
+
+	if uri.Host == "" {
+		uri.Host = request.proxied.Host
+	}
+
+	if uri.Scheme == "" {
+		uri.Scheme = "http"
+	}
+
+	request.traced(requestLog).WithFields(Fields{"host": uri.Host}).Debug("Forwarding Asterisk-Form Request")
+	request.proxied.URL = &uri
+}
+
+// maxForwards answers TRACE and OPTIONS requests with a Max-Forwards
+// of 0 from the proxy itself; otherwise decrementing it to forward.
+func (request *Request) maxForwards() *Response {
+	value := request.proxied.Header.Get("Max-Forwards")
+	if value == "" {
+		return nil
+	}
+
+	forwards, err := strconv.Atoi(value)
+	if err != nil || forwards < 0 {
+		request.traced(requestLog).WithFields(Fields{"max-forwards": value}).Warning("Ignoring Invalid Max-Forwards")
+		return nil
+	}
+
+	if forwards > 0 {
+		request.copyHeaders()
+		request.proxied.Header.Set("Max-Forwards", strconv.Itoa(forwards-1))
+		return nil
+	}
+
+	request.traced(requestLog).WithFields(Fields{"method": request.proxied.Method}).Debug("Answering At Max-Forwards")
+	response := request.statusResponse(http.StatusOK, nil)
+	header := response.proxied.Header
+
+	switch request.proxied.Method {
+	case "TRACE":
+		// Echo the request as received; less its credentials.
+		var buffer bytes.Buffer
+		echo := *request.original
+		echo.Body, echo.ContentLength = nil, 0
+		echo.Header = make(http.Header)
+		CopyHeaders(request.original.Header, echo.Header)
+		for key := range credentialHeaders {
+			echo.Header.Del(key)
+		}
+		echo.Write(&buffer)
+
+		header.Set("Content-Type", "message/http")
+		response.proxied.Body = ioutil.NopCloser(&buffer)
+		response.proxied.ContentLength = int64(buffer.Len())
+	default:
+		header.Set("Allow", AllowedMethods)
+		header.Del("Content-Type")
+		response.proxied.Body = http.NoBody
+		response.proxied.ContentLength = 0
+	}
+
+	header.Set("Content-Length", fmt.Sprint(response.proxied.ContentLength))
+	return response
+}
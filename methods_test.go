@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// postOrigin echoes request bodies as fresh for a minute.
+func postOrigin(fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Method + " " + string(body)))
+	}))
+}
+
+func TestCacheablePOST(t *testing.T) {
+	var fetches atomic.Int32
+	origin := postOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseCacheableMethods("GET", "POST")
+	for _, body := range []string{"query", "query", "other"} {
+		response := serve(proxy, newRequest("POST", origin.URL+"/api", body))
+		if got := readBody(t, response); got != "POST "+body {
+			t.Errorf("body = %q; want %q", got, "POST "+body)
+		}
+	}
+
+	// The identical POST from cache; the other body is another entry.
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want 2", n)
+	}
+}
+
+func TestCacheablePOSTBodyOverLimit(t *testing.T) {
+	var fetches atomic.Int32
+	origin := postOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).
+		UseCacheableMethods("GET", "POST").
+		UseCacheBodyLimit(16)
+
+	body := strings.Repeat("x", 64)
+	for i := 0; i < 2; i++ {
+		response := serve(proxy, newRequest("POST", origin.URL+"/api", body))
+		if got := readBody(t, response); got != "POST "+body {
+			t.Errorf("body = %q; want the whole body forwarded", got)
+		}
+	}
+
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want bodies over the limit never cached", n)
+	}
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// roundTripFunc is a http.RoundTripper of a func.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripFunc) RoundTrip(httpRequest *http.Request) (*http.Response, error) {
+	return fn(httpRequest)
+}
+
+func TestTransportMiddleware(t *testing.T) {
+	var mutex sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls = append(calls, call)
+	}
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record("origin " + strings.Join(r.Header.Values("X-Chain"), ","))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	middleware := func(name string) func(http.RoundTripper) http.RoundTripper {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(httpRequest *http.Request) (*http.Response, error) {
+				record("before " + name)
+				httpRequest = httpRequest.Clone(httpRequest.Context())
+				httpRequest.Header.Add("X-Chain", name)
+
+				response, err := next.RoundTrip(httpRequest)
+				record("after " + name)
+				return response, err
+			})
+		}
+	}
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).
+		UseTransportMiddleware(middleware("outer"), middleware("inner"))
+	if body := readBody(t, get(proxy, origin.URL+"/a")); body != "hello" {
+		t.Fatalf("body = %q", body)
+	}
+
+	want := []string{"before outer", "before inner", "origin outer,inner", "after inner", "after outer"}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %q; want %q", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("calls = %q; want %q", calls, want)
+			break
+		}
+	}
+}
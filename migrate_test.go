@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMigrateCacheSHA1ToURI(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	paths := []string{"/a", "/docs/", "/docs/page"}
+
+	proxy := NewProxy().UseCachePath(root).UseCacheNameStyle(CacheNameSHA1)
+	for _, path := range paths {
+		readBody(t, get(proxy, origin.URL+path))
+	}
+
+	if err := proxy.MigrateCache(CacheNameSHA1, CacheNameURI); err != nil {
+		t.Fatalf("MigrateCache: %v", err)
+	}
+
+	host, _ := url.Parse(origin.URL)
+	for _, path := range paths {
+		uri, _ := url.Parse(origin.URL + path)
+		name := filepath.Join(root, uriCacheName(uri))
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s not migrated to %s: %v", path, name, err)
+		}
+	}
+
+	if files := entryFiles(t, root); len(files) != len(paths) {
+		t.Errorf("cache entries after migrating = %v; want %d under %s", files, len(paths), host.Host)
+	}
+
+	proxy.UseCacheNameStyle(CacheNameURI)
+	for _, path := range paths {
+		if got := readBody(t, get(proxy, origin.URL+path)); got != path {
+			t.Errorf("body of %s = %q", path, got)
+		}
+	}
+
+	if n := fetches.Load(); n != int32(len(paths)) {
+		t.Errorf("origin fetched %d times; want the migrated entries served from cache", n)
+	}
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func onlyIfCached(proxy *Proxy, url string) *http.Response {
+	httpRequest := newRequest("GET", url, "")
+	httpRequest.Header.Set("Cache-Control", "only-if-cached")
+	return serve(proxy, httpRequest)
+}
+
+func TestOnlyIfCached(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+
+	// A miss never reaches the origin.
+	miss := onlyIfCached(proxy, origin.URL+"/a")
+	readBody(t, miss)
+	if miss.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("miss status = %d; want 504", miss.StatusCode)
+	}
+	if n := fetches.Load(); n != 0 {
+		t.Fatalf("origin fetched %d times for an only-if-cached miss", n)
+	}
+
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	hit := onlyIfCached(proxy, origin.URL+"/a")
+	if got := readBody(t, hit); hit.StatusCode != http.StatusOK || got != "/a" {
+		t.Errorf("hit = %d %q; want 200 /a", hit.StatusCode, got)
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want only the priming GET", n)
+	}
+}
+
+func TestOnlyIfCachedMaxStale(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Write([]byte("stale"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/s"))
+
+	for directive, want := range map[string]int{
+		"only-if-cached":                 http.StatusGatewayTimeout,
+		"only-if-cached, max-stale":      http.StatusOK,
+		"only-if-cached, max-stale=3600": http.StatusOK,
+	} {
+		httpRequest := newRequest("GET", origin.URL+"/s", "")
+		httpRequest.Header.Set("Cache-Control", directive)
+
+		response := serve(proxy, httpRequest)
+		readBody(t, response)
+		if response.StatusCode != want {
+			t.Errorf("%q of a stale entry = %d; want %d", directive, response.StatusCode, want)
+		}
+	}
+}
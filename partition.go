@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+)
+
+// UseCachePartition isolates the cache by the token the partition func
+// returns for each request, like a user id or a session cookie; so the
+// entries of one partition are never served to another. Requests with
+// an empty token share the default partition, named as without one.
+//
+// Note: the token is given the request as the client sent it; though
+// only the headers forwarded upstream are kept for MigrateCache.
+func (proxy *Proxy) UseCachePartition(
+	partition func(httpRequest *http.Request) string,
+) *Proxy {
+	defer proxy.configure()()
+	proxy.partition = partition
+	return proxy
+}
+
+// partitionDir returns the directory under the cache path of the
+// partition of the request; empty for the default partition. The
+// token is hashed so it can neither be read nor climb the path.
+func (proxy *Proxy) partitionDir(httpRequest *http.Request) string {
+	if proxy.partition == nil || httpRequest == nil {
+		return ""
+	}
+
+	token := proxy.partition(httpRequest)
+	if token == "" {
+		return ""
+	}
+
+	// Hosts can't hold an "@"; so partitions never meet URI names.
+	return fmt.Sprintf("@%x", sha1.Sum([]byte(token)))
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCachePartition(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	// Named by the URI alone; so only the partition tells the users apart.
+	proxy := NewProxy().UseCachePath(root).UseCacheNameStyle(CacheNameURI)
+	proxy.UseCachePartition(func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	})
+
+	fetchAs := func(user string) {
+		request := newRequest("GET", origin.URL+"/a", "")
+		if user != "" {
+			request.Header.Set("X-User", user)
+		}
+
+		if body := readBody(t, serve(proxy, request)); body != "/a" {
+			t.Fatalf("user %q: body = %q", user, body)
+		}
+	}
+
+	// Each token fetches its own; the users without one share theirs.
+	for _, user := range []string{"alice", "bob", "alice", "", "bob", ""} {
+		fetchAs(user)
+	}
+
+	if fetches.Load() != 3 {
+		t.Errorf("origin fetched %d times; want 3", fetches.Load())
+	}
+
+	if entries := entryFiles(t, root); len(entries) != 3 {
+		t.Errorf("cache entries = %q; want 3", entries)
+	}
+}
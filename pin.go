@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+)
+
+// cachePins holds the cache names of the pinned entries.
+type cachePins struct {
+	mutex sync.RWMutex
+	names map[string]bool
+}
+
+// Pin marks the cache entry of the request as pinned; it is always
+// fresh, so never revalidated, and never evicted by UseMaxCacheEntries
+// until it is unpinned. Pins are kept in memory only.
+func (proxy *Proxy) Pin(httpRequest *http.Request) *Proxy {
+	current := proxy.snapshot()
+	name := current.cacheNameOf(httpRequest, current.cacheNameStyle)
+	cacheLog.WithFields(Fields{"name": name}).Debug("Pinning Cache Entry")
+
+	proxy.pins.mutex.Lock()
+	defer proxy.pins.mutex.Unlock()
+
+	if proxy.pins.names == nil {
+		proxy.pins.names = make(map[string]bool)
+	}
+
+	proxy.pins.names[name] = true
+	return proxy
+}
+
+// Unpin lets the cache entry of the request expire and be evicted again.
+func (proxy *Proxy) Unpin(httpRequest *http.Request) *Proxy {
+	current := proxy.snapshot()
+	name := current.cacheNameOf(httpRequest, current.cacheNameStyle)
+	cacheLog.WithFields(Fields{"name": name}).Debug("Unpinning Cache Entry")
+
+	proxy.pins.mutex.Lock()
+	defer proxy.pins.mutex.Unlock()
+
+	delete(proxy.pins.names, name)
+	return proxy
+}
+
+// pinned reports if the named cache entry is pinned.
+func (proxy *Proxy) pinned(name string) bool {
+	proxy.pins.mutex.RLock()
+	defer proxy.pins.mutex.RUnlock()
+
+	return proxy.pins.names[name]
+}
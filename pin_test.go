@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestPinnedEntrySurvivesEvictionAndStaysFresh(t *testing.T) {
+	var mutex sync.Mutex
+	seen := map[string]int{}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		seen[r.Method+" "+r.URL.Path]++
+		mutex.Unlock()
+
+		// Stale at once; so unpinned entries are revalidated.
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseMaxCacheEntries(1)
+	proxy.Pin(newRequest("GET", origin.URL+"/pinned", ""))
+
+	readBody(t, get(proxy, origin.URL+"/pinned"))
+	for _, path := range []string{"/b", "/c", "/d"} {
+		readBody(t, get(proxy, origin.URL+path))
+	}
+
+	pinned := LoadRequest(newRequest("GET", origin.URL+"/pinned", "")).
+		SetCachePath(root).FullCacheName()
+	if !proxy.index.Has(cacheRoot(root), pinned) {
+		t.Fatal("pinned entry was evicted")
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := readBody(t, get(proxy, origin.URL+"/pinned")); got != "/pinned" {
+			t.Errorf("pinned body = %q", got)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if seen["GET /pinned"] != 1 || seen["HEAD /pinned"] != 0 {
+		t.Errorf("origin saw %v; want one GET and no revalidation of /pinned", seen)
+	}
+
+	// The others are still held to the limit.
+	if files := entryFiles(t, root); len(files) > 2 {
+		t.Errorf("cache entries = %v; want the pinned one and at most one other", files)
+	}
+}
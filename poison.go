@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// reflectedMinLength is the shortest request header value looked
+// for in the response; shorter ones match by chance too easily.
+const reflectedMinLength = 4
+
+// reflectingHeaders are the response headers an origin echoing
+// a request header into would poison the cached redirect or links.
+var reflectingHeaders = []string{"Location", "Content-Location", "Link"}
+
+// CachePoisonGuard sets whether responses echoing the value of a request
+// header the cache name doesn't depend on, such as X-Forwarded-Host, in
+// their Location, Content-Location or Link are not cached; they would
+// be served to every request of the name, whatever its header.
+func (proxy *Proxy) CachePoisonGuard(guard bool) *Proxy {
+	defer proxy.configure()()
+	proxy.poisonGuard = guard
+	return proxy
+}
+
+// keyedHeader reports if the cache name of the request depends on the
+// header; any but the Via and request ID under CacheNameSHA1 (unless
+// narrowed by CacheKeyHeaders), only Accept under CacheNameURI.
+func (proxy *Proxy) keyedHeader(httpRequest *http.Request, header string) bool {
+	if proxy.cacheNameStyle == CacheNameURI && uriCacheable(httpRequest) {
+		return proxy.varyOnAccept && header == "Accept"
+	}
+
+	if header == "Via" || header == proxy.requestIDHeader {
+		return false
+	}
+
+	if proxy.cacheKeyHeaders == nil {
+		return true
+	}
+
+	for _, key := range proxy.cacheKeyHeaders {
+		if key == header {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reflectedHeader returns the unkeyed request header whose value the
+// header of its response echoes in the reflectingHeaders; unless that
+// value is in the requested URL anyway, which is keyed.
+func (proxy *Proxy) reflectedHeader(
+	httpRequest *http.Request, header http.Header,
+) (string, bool) {
+	if httpRequest == nil {
+		return "", false
+	}
+
+	var echoes []string
+	for _, reflecting := range reflectingHeaders {
+		for _, value := range header.Values(reflecting) {
+			echoes = append(echoes, strings.ToLower(value))
+		}
+	}
+
+	if len(echoes) == 0 {
+		return "", false
+	}
+
+	requested := strings.ToLower(httpRequest.Host + " " + httpRequest.URL.String())
+	for key, values := range httpRequest.Header {
+		if proxy.keyedHeader(httpRequest, key) {
+			continue
+		}
+
+		for _, value := range values {
+			value = strings.ToLower(strings.TrimSpace(value))
+			if len(value) < reflectedMinLength || strings.Contains(requested, value) {
+				continue
+			}
+
+			for _, echo := range echoes {
+				if strings.Contains(echo, value) {
+					return key, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
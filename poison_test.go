@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// reflectingOrigin links to the X-Forwarded-Host of the request; as an
+// origin building absolute URLs from it would.
+func reflectingOrigin(fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		host := r.Header.Get("X-Forwarded-Host")
+		if host == "" {
+			host = "www.example.com"
+		}
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Link", "<https://"+host+"/style.css>; rel=preload")
+		w.Write([]byte("page"))
+	}))
+}
+
+func TestCachePoisonGuard(t *testing.T) {
+	for _, guard := range []bool{false, true} {
+		var fetches atomic.Int32
+		origin := reflectingOrigin(&fetches)
+
+		// Named by the URI; so X-Forwarded-Host is unkeyed.
+		proxy := NewProxy().UseCachePath(t.TempDir()).
+			UseCacheNameStyle(CacheNameURI).CachePoisonGuard(guard)
+
+		attack := newRequest("GET", origin.URL+"/page", "")
+		attack.Header.Set("X-Forwarded-Host", "evil.example")
+		readBody(t, serve(proxy, attack))
+
+		victim := get(proxy, origin.URL+"/page")
+		readBody(t, victim)
+
+		link := victim.Header.Get("Link")
+		poisoned := link == "<https://evil.example/style.css>; rel=preload"
+		if poisoned == guard {
+			t.Errorf("guard %v: the victim was served Link %q after %d fetches", guard, link, fetches.Load())
+		}
+
+		origin.Close()
+	}
+}
+
+func TestCachePoisonGuardKeyed(t *testing.T) {
+	var fetches atomic.Int32
+	origin := reflectingOrigin(&fetches)
+	defer origin.Close()
+
+	// The header names the entry under CacheNameSHA1; so it is safe to cache.
+	proxy := NewProxy().UseCachePath(t.TempDir()).CachePoisonGuard(true)
+	for i := 0; i < 2; i++ {
+		request := newRequest("GET", origin.URL+"/page", "")
+		request.Header.Set("X-Forwarded-Host", "cdn.example")
+		readBody(t, serve(proxy, request))
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want the keyed reflection cached", fetches.Load())
+	}
+}
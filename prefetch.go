@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// prefetchConcurrency bounds the fetches of PrefetchLinks
+// and WarmFromManifest in progress.
+const prefetchConcurrency = 4
+
+// linkAttribute matches the href and src attributes of HTML tags;
+// quoted either way or not at all.
+var linkAttribute = regexp.MustCompile(
+	`(?i)\s(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`,
+)
+
+// ExtractLinks returns the http and https URLs of the href and src
+// attributes in an HTML body; resolved against the URL of the request
+// and without duplicates. Other bodies have no links.
+func (response *Response) ExtractLinks() (links []string) {
+	if !strings.Contains(response.GetHeader("Content-Type"), "html") {
+		return nil
+	}
+
+	if response.copyBody() == nil {
+		return nil
+	}
+
+	body := response.body.Bytes()
+	if _, gzipped := response.HasHeaderValue("Content-Encoding", "gzip"); gzipped {
+		var uncompressed bytes.Buffer
+		if err := response.GunzipBodyToErr(&uncompressed); err != nil {
+			return nil
+		}
+
+		body = uncompressed.Bytes()
+	}
+
+	var base *url.URL
+	if request := response.proxied.Request; request != nil {
+		base = request.URL
+	}
+
+	seen := make(map[string]bool)
+	for _, match := range linkAttribute.FindAllSubmatch(body, -1) {
+		link := html.UnescapeString(string(bytes.Join(match[1:], nil)))
+
+		uri, err := url.Parse(strings.TrimSpace(link))
+		if err != nil {
+			continue
+		}
+
+		if base != nil {
+			uri = base.ResolveReference(uri)
+		}
+
+		uri.Fragment = ""
+		if uri.Scheme != "http" && uri.Scheme != "https" || seen[uri.String()] {
+			continue
+		}
+
+		seen[uri.String()] = true
+		links = append(links, uri.String())
+	}
+
+	return
+}
+
+// PrefetchLinks fetches the links of the HTML response through the
+// proxy so they are cached ahead of being asked for; a few at a time.
+// It returns once they have all been fetched.
+func (proxy *Proxy) PrefetchLinks(response *Response) {
+	proxy = proxy.snapshot()
+
+	links := response.ExtractLinks()
+	proxyLog.WithFields(Fields{"links": len(links)}).Debug("Prefetching Links")
+
+	var httpRequests []*http.Request
+	for _, link := range links {
+		httpRequest, err := http.NewRequest("GET", link, nil)
+		if err != nil {
+			proxyLog.WithFields(Fields{"link": link}).WithError(err).Warning("Could Not Prefetch Link")
+			continue
+		}
+
+		httpRequests = append(httpRequests, httpRequest)
+	}
+
+	proxy.warm(httpRequests)
+}
+
+// warm fetches the requests through the proxy so they are cached; a
+// few at a time. It returns the error of each request, in order; nil
+// for those fetched fine, whether or not they could be cached.
+func (proxy *Proxy) warm(httpRequests []*http.Request) []error {
+	errs := make([]error, len(httpRequests))
+
+	slots := make(chan struct{}, prefetchConcurrency)
+	var wait sync.WaitGroup
+
+	for i, httpRequest := range httpRequests {
+		wait.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, httpRequest *http.Request) {
+			defer func() { <-slots; wait.Done() }()
+
+			response := proxy.Fetch(httpRequest)
+			if err := response.Err(); err != nil {
+				errs[i] = err
+			} else if status := response.proxied.StatusCode; status >= 400 {
+				errs[i] = fmt.Errorf("proxy: fetched %d %s", status, http.StatusText(status))
+			}
+
+			// Streams are never cached; there is nothing to keep.
+			if response.Streaming() {
+				response.proxied.Body.Close()
+				return
+			}
+
+			response.serve()
+		}(i, httpRequest)
+	}
+
+	wait.Wait()
+	return errs
+}
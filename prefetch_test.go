@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPrefetchLinks(t *testing.T) {
+	var mutex sync.Mutex
+	fetched := map[string]int{}
+
+	var origin *httptest.Server
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		fetched[r.URL.Path]++
+		mutex.Unlock()
+
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<link href="/style.css"><img src='img.png'>
+				<a href=%s/about#top>about</a> <a href="/style.css">again</a>
+				<a href="mailto:someone@example.com">mail</a>`, origin.URL)
+			return
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	response := proxy.Fetch(newRequest("GET", origin.URL+"/page", ""))
+
+	links := response.ExtractLinks()
+	want := []string{origin.URL + "/style.css", origin.URL + "/img.png", origin.URL + "/about"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("ExtractLinks() = %v; want %v", links, want)
+	}
+
+	proxy.PrefetchLinks(response)
+
+	// Now cached; served without another fetch.
+	for _, link := range want {
+		httpRequest, _ := http.NewRequest("GET", link, nil)
+		cached := proxy.Fetch(httpRequest)
+		if !cached.cached {
+			t.Errorf("%s was not cached by the prefetch", link)
+		}
+		cached.serve()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, path := range []string{"/style.css", "/img.png", "/about"} {
+		if fetched[path] != 1 {
+			t.Errorf("%s fetched %d times; want once, by the prefetch", path, fetched[path])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPrivateCache(t *testing.T) {
+	for _, test := range []struct {
+		cacheControl string
+		private      bool
+		fetches      int32
+	}{
+		{"private, max-age=60", false, 2},
+		{"private, max-age=60", true, 1},
+		{"private, no-store, max-age=60", true, 2},
+		{"s-maxage=0, max-age=60", true, 1},
+	} {
+		var fetches atomic.Int32
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			w.Header().Set("Cache-Control", test.cacheControl)
+			w.Write([]byte("mine"))
+		}))
+
+		proxy := NewProxy().UseCachePath(t.TempDir()).PrivateCache(test.private)
+		for i := 0; i < 2; i++ {
+			readBody(t, get(proxy, origin.URL+"/a"))
+		}
+
+		if fetches.Load() != test.fetches {
+			t.Errorf("%q, private %v: origin fetched %d times; want %d",
+				test.cacheControl, test.private, fetches.Load(), test.fetches)
+		}
+
+		origin.Close()
+	}
+}
@@ -1,10 +1,17 @@
 package proxy
 
 import (
-	"bufio"
-	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // CacheNameStyle is used
@@ -19,23 +26,160 @@ const (
 	CacheNameURI
 )
 
-// Proxy provides a gateway to HTTP caching.
+// DefaultViaName names the proxy in the Via headers it adds.
+const DefaultViaName = "go.proxy"
+
+// Proxy provides a gateway to HTTP caching; made by NewProxy, or as
+// a zero Proxy of the default settings without a cache index. Its
+// setters are safe to call while it serves; each request keeps to
+// the settings it started with.
 type Proxy struct {
-	cachePath      string
-	cacheNameStyle CacheNameStyle
-	transport      http.RoundTripper
+	*proxyConfig
+	*proxyState
+
+	// zero readies a zero Proxy on its first use.
+	zero sync.Once
+}
+
+// proxyConfig holds the settings of a Proxy; as set by its setters.
+type proxyConfig struct {
+	cachePath       string
+	cacheNameStyle  CacheNameStyle
+	cacheSharding   int
+	transport       http.RoundTripper
+	validator       func(cached *Response) (fresh bool)
+	keepSetCookie   bool
+	verifyChecksums bool
+	verifyIntegrity bool
+	addContentSHA1  bool
+	maxCacheEntries int
+	http2           http2Setting
+	noDecompress    bool
+	acceptEncoding  string
+	upstreamScheme  string
+	forwardTLS      bool
+	asyncCache      bool
+	respectClose    bool
+	collapseSlashes bool
+	serverTiming    bool
+	refreshDate     bool
+	poisonGuard     bool
+	privateCache    bool
+	preserveProto   bool
+	unixSockets     map[string]string
+	answerExpect    bool
+	sniffType       bool
+	varyOnAccept    bool
+	compressCache   bool
+	coalesceMisses  bool
+	dedupeBodies    bool
+
+	cacheableMethods map[string]bool
+	cacheBodyLimit   int64
+	cacheKeyHeaders  []string
+	defaultFile      string
+	ignoreParams     []string
+	onlyParams       []string
+	compressExcept   []string
+
+	ttlByContentType map[string]time.Duration
+	maxTTL           time.Duration
+	customTTLHeader  string
+	staleOnError     time.Duration
+	writeTimeout     time.Duration
+	keepAlive        time.Duration
+	bodyReadTimeout  time.Duration
+	slowThreshold    time.Duration
+	har              *harRecorder
+	auth             *basicAuth
+	viaName          string
+	statusPath       string
+	maxHeaderBytes   int
+	streamThreshold  int64
+	captureBodies    int64
+	redirectBodies   int64
+	events           cacheEvents
+	rewriters        []bodyRewriter
+	partition        func(httpRequest *http.Request) string
+	fallback         *fallbackResponse
+	requestIDHeader  string
+	metaCodec        MetadataCodec
+
+	middleware []func(http.RoundTripper) http.RoundTripper
+
+	// built is transport with the options applied and
+	// wrapped in the middleware; once it is asked for.
+	built *builtTransport
+
+	// fetches limits the upstream fetches in progress.
+	fetches *fetchLimiter
+	retry   *connectionRetry
+
+	idempotency *idempotency
+
+	allowHosts []string
+	denyHosts  []string
+}
+
+// proxyState is what a Proxy keeps while it serves; shared by
+// the snapshots of its settings serving the requests.
+type proxyState struct {
+	// config is the proxyConfig published by the last setter.
+	config      atomic.Pointer[proxyConfig]
+	configMutex sync.Mutex
+
+	hits *hitWindow
+
+	// revalidations coalesces the HEAD requests
+	// of concurrently expired cache entries.
+	revalidations flightGroup
+
+	// misses coalesces the fetches of concurrent cache
+	// misses; with CoalesceMisses.
+	misses flightGroup
+
+	// cacheWrites coalesces the AsyncCacheWrites of a name.
+	cacheWrites flightGroup
+
+	// index tracks what is stored under the cache path.
+	index *cacheIndex
+	pins  cachePins
+
+	// retention deletes the entries past UseRetentionTTL.
+	retention retention
+
+	abortedWrites atomic.Int64
+}
+
+// ErrHeaderTooLarge is the error of the 431 answering
+// requests with headers larger than UseMaxHeaderBytes.
+var ErrHeaderTooLarge = errors.New("proxy: request headers too large")
+
+// headerBytes returns the size of the headers as they are sent.
+func headerBytes(header http.Header) (size int) {
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+
+	return
 }
 
 // NewProxy creates a Proxy object that helps us manipulate
 // HTTP requests and responses with a caching layer.
 func NewProxy(transport ...http.RoundTripper) (proxy *Proxy) {
-	proxy = new(Proxy)
+	proxy = defaultProxy()
+	proxy.index = newCacheIndex()
+	proxy.hits = new(hitWindow)
+	proxy.viaName = DefaultViaName
+	proxy.cacheBodyLimit = DefaultCacheBodyLimit
 
 	if len(transport) == 1 {
-		log.Info("Created Proxy with Transport")
+		proxyLog.Info("Created Proxy with Transport")
 		proxy.transport = transport[0]
 	} else {
-		log.Info("Created Proxy")
+		proxyLog.Info("Created Proxy")
 	}
 
 	return
@@ -44,6 +188,7 @@ func NewProxy(transport ...http.RoundTripper) (proxy *Proxy) {
 // UseCachePath sets the directory where we should save
 // the cache responses to and were we should seek cached requests.
 func (proxy *Proxy) UseCachePath(path string) *Proxy {
+	defer proxy.configure()()
 	proxy.cachePath = path
 	return proxy
 }
@@ -53,18 +198,436 @@ func (proxy *Proxy) UseCachePath(path string) *Proxy {
 // CacheNameSHA1: stores cached requests by the SHA1 Sum of the entire request.
 // CacheNameURI: stores cached requests by the HOST/URI of the enture request.
 func (proxy *Proxy) UseCacheNameStyle(style CacheNameStyle) *Proxy {
+	defer proxy.configure()()
 	proxy.cacheNameStyle = style
 	return proxy
 }
 
+// UseCacheSharding spreads CacheNameSHA1 files over subdirectories
+// named by the first levels pairs of hex characters of their Sum
+// ("ab/cd/abcd..."); so no single directory holds the whole cache.
+func (proxy *Proxy) UseCacheSharding(levels int) *Proxy {
+	defer proxy.configure()()
+	proxy.cacheSharding = levels
+	return proxy
+}
+
+// UseCacheableMethods sets the request methods responses are cached
+// for; only GET by default. Other methods are only cached when their
+// response declares its freshness (RFC 7234 4.4 on POST). OPTIONS and
+// TRACE are never cached.
+func (proxy *Proxy) UseCacheableMethods(methods ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.cacheableMethods = make(map[string]bool)
+	for _, method := range methods {
+		proxy.cacheableMethods[strings.ToUpper(method)] = true
+	}
+
+	return proxy
+}
+
+// DefaultCacheBodyLimit is how large a request body may be to be
+// cached by; see UseCacheBodyLimit.
+const DefaultCacheBodyLimit = 1 << 20
+
+// UseCacheBodyLimit sets how many bytes of a request body other than
+// that of a GET are read into memory to be part of its cache name;
+// requests with larger bodies are forwarded as they are read and are
+// not cached. DefaultCacheBodyLimit by default.
+func (proxy *Proxy) UseCacheBodyLimit(max int64) *Proxy {
+	defer proxy.configure()()
+	proxy.cacheBodyLimit = max
+	return proxy
+}
+
+// cacheableMethod reports if responses to the method are cached.
+func (proxy *Proxy) cacheableMethod(method string) bool {
+	// Answers about the server or the request path; never the resource.
+	if method == "OPTIONS" || method == "TRACE" {
+		return false
+	}
+
+	if proxy.cacheableMethods == nil {
+		return method == "GET"
+	}
+
+	return proxy.cacheableMethods[method]
+}
+
+// UseValidator sets a function deciding if a cached Response is still
+// fresh; it replaces the header based checks of Response.CacheExpired.
+func (proxy *Proxy) UseValidator(
+	validator func(cached *Response) (fresh bool),
+) *Proxy {
+	defer proxy.configure()()
+	proxy.validator = validator
+	return proxy
+}
+
+// StripSetCookieOnCache sets whether Set-Cookie headers are removed
+// from responses as they are cached (the default); so one client's
+// cookies are never served to another. Live responses keep them.
+func (proxy *Proxy) StripSetCookieOnCache(strip bool) *Proxy {
+	defer proxy.configure()()
+	proxy.keepSetCookie = !strip
+	return proxy
+}
+
+// UseMaxCacheEntries limits how many responses are kept in the
+// cache; the least recently used are evicted to stay within it.
+func (proxy *Proxy) UseMaxCacheEntries(max int) *Proxy {
+	defer proxy.configure()()
+	proxy.maxCacheEntries = max
+	return proxy
+}
+
+// VerifyChecksums sets whether fetched bodies are checked against
+// their Content-MD5 and Content-SHA1 headers; mismatches are not
+// cached and are answered with a 502 Bad Gateway instead.
+func (proxy *Proxy) VerifyChecksums(verify bool) *Proxy {
+	defer proxy.configure()()
+	proxy.verifyChecksums = verify
+	return proxy
+}
+
+// AddContentSHA1 sets whether a Content-SHA1 of the body is stored
+// with cached responses; entries without other validators are then
+// revalidated by comparing it against the Sum of the latest body.
+func (proxy *Proxy) AddContentSHA1(add bool) *Proxy {
+	defer proxy.configure()()
+	proxy.addContentSHA1 = add
+	return proxy
+}
+
+// AnswerExpectContinue sets whether the proxy answers Expect:
+// 100-continue itself instead of relaying it to the origin (the
+// default); where the client only gets its 100 Continue once the
+// origin has sent one and the transport starts reading the body.
+func (proxy *Proxy) AnswerExpectContinue(answer bool) *Proxy {
+	defer proxy.configure()()
+	proxy.answerExpect = answer
+	return proxy
+}
+
+// PreserveProto sets whether requests are sent upstream over the
+// protocol the client's came in; HTTP/2 ones over h2 (h2c for http://
+// URLs), so the origin must speak it, and the others over HTTP/1.1.
+// It takes the place of ForceHTTP2, and needs a *http.Transport.
+func (proxy *Proxy) PreserveProto(preserve bool) *Proxy {
+	defer proxy.configure()()
+	proxy.preserveProto = preserve
+	return proxy
+}
+
+// AsyncCacheWrites sets whether cacheable responses are written to
+// the cache in a goroutine after they are served; so a slow disk never
+// holds up the client. Bodies over UseStreamThreshold are still teed.
+func (proxy *Proxy) AsyncCacheWrites(async bool) *Proxy {
+	defer proxy.configure()()
+	proxy.asyncCache = async
+	return proxy
+}
+
+// RespectConnectionClose sets whether a request the client sent with
+// Connection: close is also sent upstream with it; so the upstream
+// connection is closed after the response, rather than kept alive.
+func (proxy *Proxy) RespectConnectionClose(respect bool) *Proxy {
+	defer proxy.configure()()
+	proxy.respectClose = respect
+	return proxy
+}
+
+// CoalesceMisses sets whether concurrent GETs missing the same cache
+// entry share the one fetch; each served a duplicate of its response.
+// Responses unfit to share (see shareable) are fetched by each.
+func (proxy *Proxy) CoalesceMisses(coalesce bool) *Proxy {
+	defer proxy.configure()()
+	proxy.coalesceMisses = coalesce
+	return proxy
+}
+
+// CollapseSlashes sets whether the path of the proxied request is
+// cleaned, as by path.Clean, before it is fetched and named in the
+// cache; so "/a//b" and "/a/./b" are both "/a/b". A trailing slash
+// is kept.
+func (proxy *Proxy) CollapseSlashes(collapse bool) *Proxy {
+	defer proxy.configure()()
+	proxy.collapseSlashes = collapse
+	return proxy
+}
+
+// SniffContentType sets whether responses without a Content-Type get
+// one detected from their body (see http.DetectContentType) before
+// they are cached and served.
+func (proxy *Proxy) SniffContentType(sniff bool) *Proxy {
+	defer proxy.configure()()
+	proxy.sniffType = sniff
+	return proxy
+}
+
+// CompressCacheFiles sets whether cache files are written gzipped; to
+// save disk. It is unrelated to the Content-Encoding of the bodies and
+// gzipped cache files are read either way, known by their magic bytes.
+func (proxy *Proxy) CompressCacheFiles(compress bool) *Proxy {
+	defer proxy.configure()()
+	proxy.compressCache = compress
+	return proxy
+}
+
+// DefaultCompressCacheExcept are the Content-Types of bodies already
+// compressed; which CompressCacheFiles stores as is, unless changed by
+// CompressCacheExcept.
+var DefaultCompressCacheExcept = []string{
+	"image/*", "video/*", "audio/*", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+	"application/zstd",
+}
+
+// CompressCacheExcept sets the Content-Types (or their prefixes, such
+// as "image/" or "image/*") of the bodies CompressCacheFiles stores as
+// is; DefaultCompressCacheExcept unless set. Bodies with a
+// Content-Encoding are always stored as is.
+func (proxy *Proxy) CompressCacheExcept(types ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.compressExcept = append([]string{}, types...)
+	return proxy
+}
+
+// VaryOnAccept sets whether CacheNameURI names responses by the Accept
+// header of the request too; for origins negotiating on it without
+// sending Vary: Accept. CacheNameSHA1 names include it unless it is
+// left out of CacheKeyHeaders.
+func (proxy *Proxy) VaryOnAccept(vary bool) *Proxy {
+	defer proxy.configure()()
+	proxy.varyOnAccept = vary
+	return proxy
+}
+
+// CacheKeyHeaders restricts the request hashed into CacheNameSHA1 names
+// to its method, URL (and body) and the included headers; so requests
+// differing only by volatile headers, like User-Agent, share an entry.
+// Every header is hashed unless set; none are with an empty include.
+func (proxy *Proxy) CacheKeyHeaders(include ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.cacheKeyHeaders = make([]string, 0, len(include))
+	for _, header := range include {
+		proxy.cacheKeyHeaders = append(
+			proxy.cacheKeyHeaders, http.CanonicalHeaderKey(header),
+		)
+	}
+
+	return proxy
+}
+
+// uriCacheName returns the CacheNameURI name of the request;
+// with its Accept header when set by VaryOnAccept.
+func (proxy *Proxy) uriCacheName(httpRequest *http.Request) string {
+	name := uriCacheName(proxy.keyURL(httpRequest.URL))
+
+	if proxy.varyOnAccept {
+		name += fmt.Sprintf(";accept=%x", sha1.Sum(
+			[]byte(httpRequest.Header.Get("Accept")),
+		))
+	}
+
+	return filepath.Join(proxy.partitionDir(httpRequest), name)
+}
+
+// PrivateCache sets whether the proxy caches for a single user; as a
+// personal caching proxy. Then Cache-Control: private responses are
+// cached too, and s-maxage (for shared caches) is ignored. Responses
+// with no-store are never cached.
+func (proxy *Proxy) PrivateCache(private bool) *Proxy {
+	defer proxy.configure()()
+	proxy.privateCache = private
+	return proxy
+}
+
+// UseDefaultFile sets the file directory style paths (ending in "/")
+// are cached as; so "/docs/" and "/docs/index.html" share an entry.
+func (proxy *Proxy) UseDefaultFile(name string) *Proxy {
+	defer proxy.configure()()
+	proxy.defaultFile = name
+	return proxy
+}
+
+// keyURL returns the url as it keys the cache; without a fragment,
+// which is never sent upstream, without the query parameters left out
+// (see keyQuery) and with directory style paths naming the UseDefaultFile.
+func (proxy *Proxy) keyURL(uri *url.URL) *url.URL {
+	keyed := *uri
+	keyed.Fragment, keyed.RawFragment = "", ""
+	keyed.RawQuery = proxy.keyQuery(keyed.RawQuery)
+
+	if proxy.defaultFile != "" && keyed.Opaque == "" &&
+		(keyed.Path == "" || strings.HasSuffix(keyed.Path, "/")) {
+		if keyed.Path == "" {
+			keyed.Path = "/"
+		}
+
+		keyed.Path += proxy.defaultFile
+		if keyed.RawPath != "" {
+			keyed.RawPath += url.PathEscape(proxy.defaultFile)
+		}
+	}
+
+	return &keyed
+}
+
+// UseTTLByContentType sets the freshness lifetime of cached responses
+// by the prefix of their Content-Type (such as "image/" or "image/*");
+// overriding the origin max-age. The longest matching prefix is used.
+// The map is copied; changing it after has no effect.
+func (proxy *Proxy) UseTTLByContentType(ttls map[string]time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.ttlByContentType = make(map[string]time.Duration, len(ttls))
+	for prefix, ttl := range ttls {
+		proxy.ttlByContentType[prefix] = ttl
+	}
+
+	return proxy
+}
+
+// UseMaxTTL caps how long a cached response is considered fresh;
+// whether by its max-age, UseTTLByContentType or the Last-Modified
+// heuristic (which is otherwise capped at a day).
+func (proxy *Proxy) UseMaxTTL(ttl time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.maxTTL = ttl
+	return proxy
+}
+
+// RefreshDateOnServe sets whether cached responses are served with an
+// Age header of their current age; their Date is left as the origin
+// sent it (RFC 7231 7.1.1.2), so clients tell their freshness by both.
+func (proxy *Proxy) RefreshDateOnServe(refresh bool) *Proxy {
+	defer proxy.configure()()
+	proxy.refreshDate = refresh
+	return proxy
+}
+
+// UseCustomTTLHeader sets a response header, like X-Cache-TTL, by which
+// the origin gives the seconds its response is fresh for; over any
+// other freshness, though capped by UseMaxTTL. The header is cached
+// with the response but never served to the client.
+func (proxy *Proxy) UseCustomTTLHeader(name string) *Proxy {
+	defer proxy.configure()()
+	proxy.customTTLHeader = http.CanonicalHeaderKey(name)
+	return proxy
+}
+
+// UseUpstreamScheme sets the scheme ("http" or "https") requests are
+// sent upstream with; whatever the scheme they were received with.
+func (proxy *Proxy) UseUpstreamScheme(scheme string) *Proxy {
+	defer proxy.configure()()
+	proxy.upstreamScheme = scheme
+	return proxy
+}
+
+// UseViaName sets the name the proxy appends to the Via headers of
+// forwarded requests and served responses; DefaultViaName unless set.
+// An empty name stops the Via headers from being added.
+func (proxy *Proxy) UseViaName(name string) *Proxy {
+	defer proxy.configure()()
+	proxy.viaName = name
+	return proxy
+}
+
+// UseMaxHeaderBytes limits the size of the request headers ServeHTTP
+// accepts; counted as they would be sent. Larger requests are answered
+// with 431 Request Header Fields Too Large. Unlimited unless set.
+func (proxy *Proxy) UseMaxHeaderBytes(max int) *Proxy {
+	defer proxy.configure()()
+	proxy.maxHeaderBytes = max
+	return proxy
+}
+
+// UseStaleOnError bounds how stale a cached response may be to still
+// be served when its revalidation fails (an error or a 5xx); any
+// staleness is served unless set, but never with must-revalidate.
+func (proxy *Proxy) UseStaleOnError(max time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.staleOnError = max
+	return proxy
+}
+
 // ServeHTTP provides a Middleware for a HTTP Server
 // that also implements tools such as a caching layer.
 func (proxy *Proxy) ServeHTTP(
 	writer http.ResponseWriter,
 	httpRequest *http.Request,
 ) {
-	proxy.prepareRequest(httpRequest).
-		HTTP().Fetch().WriteTo(writer)
+	proxy = proxy.snapshot()
+
+	if proxy.writeTimeout > 0 {
+		writer = &timeoutWriter{
+			ResponseWriter: writer,
+			proxy:          proxy,
+			timeout:        proxy.writeTimeout,
+		}
+	}
+
+	if max := proxy.maxHeaderBytes; max > 0 && headerBytes(httpRequest.Header) > max {
+		proxyLog.WithFields(Fields{"max": max}).Warning("Request Headers Too Large")
+		newStatusResponse(
+			httpRequest,
+			http.StatusRequestHeaderFieldsTooLarge,
+			ErrHeaderTooLarge,
+		).serve(writer)
+		return
+	}
+
+	// Proxy-Authorization is hop-by-hop; removed before forwarding.
+	if !proxy.authorize(writer, httpRequest) {
+		return
+	}
+
+	// Answered by the proxy; never forwarded.
+	if proxy.statusPath != "" && httpRequest.URL.Path == proxy.statusPath {
+		proxy.serveStatus(writer, httpRequest)
+		return
+	}
+
+	if proxy.har != nil {
+		proxy.serveHAR(writer, httpRequest)
+		return
+	}
+
+	started := time.Now()
+	response := proxy.fetch(httpRequest)
+	response.serve(writer)
+
+	proxy.logSlowRequest(httpRequest, response, time.Since(started))
+}
+
+// serveHAR serves the request like ServeHTTP; recording
+// the exchange along with its bodies to the HAR file.
+func (proxy *Proxy) serveHAR(
+	writer http.ResponseWriter,
+	httpRequest *http.Request,
+) {
+	requestBody, responseBody := new(harBody), new(harBody)
+
+	if httpRequest.Body != nil {
+		httpRequest.Body = harReadCloser{
+			io.TeeReader(httpRequest.Body, requestBody),
+			httpRequest.Body,
+		}
+	}
+
+	started := time.Now()
+	response := proxy.fetch(httpRequest)
+	wait := time.Since(started)
+
+	response.Tee(responseBody).serve(writer)
+	receive := time.Since(started) - wait
+	proxy.logSlowRequest(httpRequest, response, wait+receive)
+
+	proxy.har.Record(
+		httpRequest, response, started,
+		wait, receive, requestBody, responseBody,
+	)
 }
 
 // RoundTrip provides a Middleware *http.Request that
@@ -72,42 +635,144 @@ func (proxy *Proxy) ServeHTTP(
 func (proxy *Proxy) RoundTrip(
 	httpRequest *http.Request,
 ) (*http.Response, error) {
-	var writer bytes.Buffer
+	proxy = proxy.snapshot()
 
-	proxy.prepareRequest(httpRequest).
-		HTTP().Fetch().WriteTo(&writer)
+	response := proxy.fetch(httpRequest)
 
-	response, err := http.ReadResponse(
-		bufio.NewReader(&writer),
-		httpRequest,
-	)
+	// Too large to buffer; piped to the client while it is cached.
+	response.streamed = response.streams()
 
-	if err != nil {
-		log.Error(err.Error())
+	var httpResponse *http.Response
+	if response.streamed {
+		httpResponse = response.pipeResponse()
+	} else {
+		httpResponse = response.ToHTTPResponse()
+	}
+
+	httpResponse.Request = httpRequest
+
+	if name := proxy.viaName; name != "" {
+		appendVia(
+			httpResponse.Header,
+			httpResponse.ProtoMajor, httpResponse.ProtoMinor, name,
+		)
 	}
 
-	return response, err
+	if id := response.requestID; id != "" {
+		httpResponse.Header.Set(proxy.requestIDHeader, id)
+	}
+
+	if ttl := proxy.customTTLHeader; ttl != "" {
+		httpResponse.Header.Del(ttl)
+	}
+
+	if timing := response.serverTiming(); timing != "" {
+		httpResponse.Header.Add("Server-Timing", timing)
+	}
+
+	if age := response.servedAge(); age != "" {
+		httpResponse.Header.Set("Age", age)
+	}
+
+	// Streams are never cached; and their body is the client's to read.
+	if !response.streamed && !response.Streaming() {
+		response.serve()
+	}
+
+	return httpResponse, nil
 }
 
 // Fetch takes a *http.Request and returns a *Response object
 func (proxy *Proxy) Fetch(httpRequest *http.Request, _ ...error) *Response {
-	return proxy.prepareRequest(httpRequest).HTTP().Fetch()
+	proxy = proxy.snapshot()
+
+	return proxy.fetch(httpRequest)
+}
+
+// Do creates a request from the method, url, body and headers then
+// fetches it through the Proxy; much like a http.Client would.
+func (proxy *Proxy) Do(
+	method string, url string, body io.Reader, headers http.Header,
+) (*Response, error) {
+	proxy = proxy.snapshot()
+
+	httpRequest, err := http.NewRequest(method, url, body)
+	if err != nil {
+		proxyLog.WithError(err).Error("Could Not Create Request")
+		return nil, err
+	}
+
+	CopyHeaders(headers, httpRequest.Header)
+
+	response := proxy.Fetch(httpRequest)
+	return response, response.Err()
+}
+
+// fetch prepares and fetches the request through the Proxy; traced
+// by the ID of UseRequestIDHeader, if set.
+func (proxy *Proxy) fetch(httpRequest *http.Request) *Response {
+	id := proxy.requestID(httpRequest)
+
+	response := proxy.fetchShared(httpRequest, id)
+	response.requestID = id
+	return response
 }
 
 func (proxy *Proxy) prepareRequest(
 	httpRequest *http.Request,
 ) *Request {
-	log.Debug("Received Request")
+	proxyLog.Debug("Received Request")
 	request := LoadRequest(httpRequest).
-		SetTransport(proxy.transport).
+		SetTransport(proxy.protoTransport(httpRequest)).
 		SetCachePath(proxy.cachePath).
-		SetCacheNameStyle(proxy.cacheNameStyle)
+		SetCacheNameStyle(proxy.cacheNameStyle).
+		SetCacheSharding(proxy.cacheSharding)
+	request.proxy = proxy
 
-	if proxy.cacheNameStyle == CacheNameURI {
-		request.SetCacheName(filepath.Join(
-			httpRequest.URL.Host,
-			httpRequest.URL.Path,
-		))
+	if proxy.collapseSlashes {
+		request.collapseSlashes()
+	}
+
+	if proxy.upstreamScheme != "" {
+		request.SetScheme(proxy.upstreamScheme)
+	}
+
+	// Named by the path as collapsed; it's the one fetched.
+	if proxy.cacheNameStyle == CacheNameURI && uriCacheable(httpRequest) {
+		request.SetCacheName(proxy.uriCacheName(request.proxied))
+	}
+
+	request.addVia(proxy.viaName)
+
+	encoding := proxy.acceptEncoding
+	if encoding != "" && acceptsEncodings(httpRequest.Header.Get("Accept-Encoding"), encoding) {
+		request.copyHeaders()
+		request.traced(requestLog).WithFields(Fields{"encoding": encoding}).Debug("Setting Upstream Accept-Encoding")
+		request.proxied.Header.Set("Accept-Encoding", encoding)
+	}
+
+	// LoadRequest keeps the upstream connection alive regardless.
+	if proxy.respectClose && httpRequest.Close {
+		request.traced(requestLog).Debug("Closing Upstream Connection")
+		request.proxied.Close = true
+	}
+
+	if proxy.forwardTLS {
+		request.forwardTLSInfo()
+	}
+
+	if max := proxy.redirectBodies; max > 0 && httpRequest.Body != nil && httpRequest.Body != http.NoBody {
+		request.holdBody(max)
+	}
+
+	if max := proxy.captureBodies; max > 0 && httpRequest.Body != nil && httpRequest.Body != http.NoBody {
+		request.captureBody(max)
+	}
+
+	// Without Expect the body is sent upstream straight away; and
+	// the http.Server answers 100 Continue as soon as it is read.
+	if proxy.answerExpect {
+		request.RemoveHeaders("Expect")
 	}
 
 	return request
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serve answers the request through the proxy as a client would see it.
+func serve(proxy *Proxy, request *http.Request) *http.Response {
+	recorder := httptest.NewRecorder()
+	proxy.ServeHTTP(recorder, request)
+	return recorder.Result()
+}
+
+// newRequest returns a proxy request; body may be empty.
+func newRequest(method, url, body string) *http.Request {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	return httptest.NewRequest(method, url, reader)
+}
+
+// get is serve of a GET of the url.
+func get(proxy *Proxy, url string) *http.Response {
+	return serve(proxy, newRequest("GET", url, ""))
+}
+
+// readBody reads and closes the body of the response.
+func readBody(t *testing.T, response *http.Response) string {
+	t.Helper()
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Errorf("reading body: %v", err)
+	}
+
+	return string(body)
+}
+
+// cacheFiles returns the paths of the files under the cache root.
+func cacheFiles(t *testing.T, root string) (files []string) {
+	t.Helper()
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walking the cache: %v", err)
+	}
+
+	return files
+}
+
+// proxyClient returns a client sending its requests through the proxy
+// served over HTTP; as a client configured with it would.
+func proxyClient(t *testing.T, proxy *Proxy) *http.Client {
+	t.Helper()
+
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+
+	proxyURL, _ := url.Parse(server.URL)
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+}
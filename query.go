@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net/url"
+	"path"
+)
+
+// CacheIgnoreQueryParams leaves the query parameters matching the
+// patterns out of the URL the cache is keyed by; such as tracking
+// parameters ("utm_*", "fbclid") that would split an entry needlessly.
+// Wildcards are as in path.Match. The full URL is still sent upstream.
+func (proxy *Proxy) CacheIgnoreQueryParams(patterns ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.ignoreParams = append([]string{}, patterns...)
+	return proxy
+}
+
+// CacheOnlyQueryParams keys the cache by only the query parameters
+// matching the patterns; the others are left out of the URL it is keyed
+// by, as with CacheIgnoreQueryParams.
+func (proxy *Proxy) CacheOnlyQueryParams(patterns ...string) *Proxy {
+	defer proxy.configure()()
+	proxy.onlyParams = append([]string{}, patterns...)
+	return proxy
+}
+
+// keyQuery returns the query the cache is keyed by; without the
+// parameters CacheIgnoreQueryParams or CacheOnlyQueryParams leave out.
+// The kept parameters are sorted by name.
+func (proxy *Proxy) keyQuery(rawQuery string) string {
+	if proxy.onlyParams == nil && len(proxy.ignoreParams) == 0 {
+		return rawQuery
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+
+	for param := range query {
+		if proxy.onlyParams != nil && !matchParam(proxy.onlyParams, param) ||
+			matchParam(proxy.ignoreParams, param) {
+			query.Del(param)
+		}
+	}
+
+	return query.Encode()
+}
+
+func matchParam(patterns []string, param string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, param); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// queryOrigin answers with the query it got; fresh for a minute.
+func queryOrigin(fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+}
+
+func TestCacheIgnoreQueryParams(t *testing.T) {
+	var fetches atomic.Int32
+	origin := queryOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).CacheIgnoreQueryParams("utm_*", "fbclid")
+
+	// The first is fetched with its tracking parameter; the others share it.
+	for _, query := range []string{"id=1&utm_source=mail", "id=1&utm_source=ads", "utm_medium=x&id=1", "id=1&fbclid=abc"} {
+		if body := readBody(t, get(proxy, origin.URL+"/p?"+query)); body != "id=1&utm_source=mail" {
+			t.Errorf("%s: body = %q; want the first fetched", query, body)
+		}
+	}
+
+	readBody(t, get(proxy, origin.URL+"/p?id=2&utm_source=mail"))
+	if fetches.Load() != 2 {
+		t.Errorf("origin fetched %d times; want 2", fetches.Load())
+	}
+}
+
+func TestCacheOnlyQueryParams(t *testing.T) {
+	var fetches atomic.Int32
+	origin := queryOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).CacheOnlyQueryParams("id", "page")
+	for _, query := range []string{"id=1&page=2&session=a", "page=2&id=1&session=b", "id=1&page=2"} {
+		readBody(t, get(proxy, origin.URL+"/p?"+query))
+	}
+
+	readBody(t, get(proxy, origin.URL+"/p?id=1&page=3&session=a"))
+	if fetches.Load() != 2 {
+		t.Errorf("origin fetched %d times; want 2", fetches.Load())
+	}
+}
+
+func TestCacheQueryParamsCopied(t *testing.T) {
+	var fetches atomic.Int32
+	origin := queryOrigin(&fetches)
+	defer origin.Close()
+
+	ignore := []string{"utm_source"}
+	only := []string{"id", "utm_source"}
+	proxy := NewProxy().UseCachePath(t.TempDir()).
+		CacheIgnoreQueryParams(ignore...).CacheOnlyQueryParams(only...)
+
+	// Changing the slices given after has no effect; even while serving.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ignore[0], only[0] = "id", "other"
+	}()
+
+	for _, query := range []string{"id=1&utm_source=a", "id=1&utm_source=b"} {
+		readBody(t, get(proxy, origin.URL+"/p?"+query))
+	}
+	wg.Wait()
+
+	readBody(t, get(proxy, origin.URL+"/p?id=2"))
+	if fetches.Load() != 2 {
+		t.Errorf("origin fetched %d times; want the ids keyed and utm_source ignored", fetches.Load())
+	}
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func rangeOrigin(fetches *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("0123456789"))
+	}))
+}
+
+func getRange(proxy *Proxy, url, ranges string) *http.Response {
+	httpRequest := newRequest("GET", url, "")
+	httpRequest.Header.Set("Range", ranges)
+	return serve(proxy, httpRequest)
+}
+
+func TestRangeFromCache(t *testing.T) {
+	var fetches atomic.Int32
+	origin := rangeOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/r"))
+
+	response := getRange(proxy, origin.URL+"/r", "bytes=2-4")
+	if got := readBody(t, response); response.StatusCode != http.StatusPartialContent || got != "234" {
+		t.Errorf("range = %d %q; want 206 \"234\"", response.StatusCode, got)
+	}
+	if got := response.Header.Get("Content-Range"); got != "bytes 2-4/10" {
+		t.Errorf("Content-Range = %q; want bytes 2-4/10", got)
+	}
+	if got := response.Header.Get("Content-Length"); got != "3" {
+		t.Errorf("Content-Length = %q; want 3", got)
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want the range served from cache", n)
+	}
+}
+
+func TestRangeUnsatisfiableFromCache(t *testing.T) {
+	var fetches atomic.Int32
+	origin := rangeOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/r"))
+
+	response := getRange(proxy, origin.URL+"/r", "bytes=20-30")
+	readBody(t, response)
+	if response.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("status = %d; want 416", response.StatusCode)
+	}
+	if got := response.Header.Get("Content-Range"); got != "bytes */10" {
+		t.Errorf("Content-Range = %q; want bytes */10", got)
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want the 416 answered from cache", n)
+	}
+}
+
+func TestMultiRangeFromCache(t *testing.T) {
+	var fetches atomic.Int32
+	origin := rangeOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/r"))
+
+	response := getRange(proxy, origin.URL+"/r", "bytes=0-1,5-6")
+	defer response.Body.Close()
+
+	mediaType, params, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if response.StatusCode != http.StatusPartialContent || err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("multi-range = %d %q; want 206 multipart/byteranges", response.StatusCode, mediaType)
+	}
+
+	var parts []string
+	reader := multipart.NewReader(response.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+
+		data, _ := ioutil.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+"="+string(data))
+	}
+
+	if got := strings.Join(parts, " "); got != "bytes 0-1/10=01 bytes 5-6/10=56" {
+		t.Errorf("parts = %q", got)
+	}
+}
+
+func TestOpenEndedRangeSeeksCache(t *testing.T) {
+	large := strings.Repeat("0123456789abcdef", 1<<14)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(large))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/large"))
+
+	messages, restore := captureLogs()
+	defer restore()
+
+	response := getRange(proxy, origin.URL+"/large", "bytes=1000-")
+	if got := readBody(t, response); response.StatusCode != http.StatusPartialContent || got != large[1000:] {
+		t.Errorf("range = %d of %d bytes; want 206 of %d", response.StatusCode, len(got), len(large)-1000)
+	}
+
+	want := fmt.Sprintf("bytes 1000-%d/%d", len(large)-1, len(large))
+	if got := response.Header.Get("Content-Range"); got != want {
+		t.Errorf("Content-Range = %q; want %s", got, want)
+	}
+
+	// Sought from the cache file; rather than read whole and sliced.
+	if seek := findLog(messages(), "Seeking Cached Range"); seek == "" {
+		t.Error("range was not sought in the cache file")
+	}
+}
+
+func TestExcessiveRangesServeWhole(t *testing.T) {
+	var fetches atomic.Int32
+	origin := rangeOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/r"))
+
+	for name, ranges := range map[string]string{
+		"overlapping": "bytes=0-5,3-8",
+		"repeated":    "bytes=0-,0-,0-",
+	} {
+		response := getRange(proxy, origin.URL+"/r", ranges)
+		if got := readBody(t, response); response.StatusCode != http.StatusOK || got != "0123456789" {
+			t.Errorf("%s ranges = %d %q; want the whole 200", name, response.StatusCode, got)
+		}
+	}
+
+	// Apart, ranges are served up to maxRanges of them.
+	var spec []string
+	for i := 0; i <= maxRanges; i++ {
+		spec = append(spec, fmt.Sprintf("%d-%d", i*2, i*2))
+	}
+	if ranges, ok := parseRange("bytes="+strings.Join(spec[:maxRanges], ","), 1000); !ok || len(ranges) != maxRanges {
+		t.Errorf("parseRange of %d ranges = %d, %v; want them all", maxRanges, len(ranges), ok)
+	}
+	if _, ok := parseRange("bytes="+strings.Join(spec, ","), 1000); ok {
+		t.Errorf("parseRange of %d ranges is ok; want it ignored", maxRanges+1)
+	}
+}
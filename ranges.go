@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// byteRange is a satisfiable range of a body.
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// maxRanges is the most ranges of a Range header that are served.
+const maxRanges = 100
+
+// parseRange parses a "bytes=" Range header against the size of the
+// body; ok is false when it can't be parsed or asks for more than the
+// body (see excessive), and ranges is empty when none can be satisfied.
+func parseRange(header string, size int64) (ranges []byteRange, ok bool) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return nil, false
+	}
+
+	for _, spec := range strings.Split(strings.TrimPrefix(header, "bytes="), ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		dash := strings.Index(spec, "-")
+		if dash < 0 {
+			return nil, false
+		}
+
+		first, last := spec[:dash], spec[dash+1:]
+
+		// A suffix range; the last bytes of the body.
+		if first == "" {
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, false
+			}
+
+			if suffix == 0 || size == 0 {
+				continue
+			}
+
+			if suffix > size {
+				suffix = size
+			}
+
+			ranges = append(ranges, byteRange{size - suffix, suffix})
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, false
+		}
+
+		end := size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return nil, false
+			}
+		}
+
+		if start >= size {
+			continue
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+
+		ranges = append(ranges, byteRange{start, end - start + 1})
+	}
+
+	if excessive(ranges, size) {
+		return nil, false
+	}
+
+	return ranges, true
+}
+
+// excessive reports if the ranges are more than maxRanges, overlap or
+// sum to more than the size of the body; as net/http.ServeContent, so
+// the Range is ignored rather than served larger than the body.
+func excessive(ranges []byteRange, size int64) bool {
+	if len(ranges) > maxRanges {
+		return true
+	}
+
+	sorted := append([]byteRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+
+	var sum int64
+	for i, r := range sorted {
+		if i > 0 && r.start < sorted[i-1].start+sorted[i-1].length {
+			return true
+		}
+
+		sum += r.length
+	}
+
+	return sum > size
+}
+
+// rangeResponse returns the 206 Partial Content of the ranges of the
+// cached body; as multipart/byteranges when there are several, or a
+// 416 Range Not Satisfiable when there are none.
+func (response *Response) rangeResponse(header string) *Response {
+	response.copyBody()
+	full := response.body.Bytes()
+	size := int64(len(full))
+
+	ranges, ok := parseRange(header, size)
+	if !ok {
+		response.traced(cacheLog).WithFields(Fields{"range": header}).Debug("Ignoring Range")
+		return response
+	}
+
+	partial := make(http.Header)
+	CopyHeaders(response.proxied.Header, partial)
+	partial.Del("Content-Length")
+
+	var body []byte
+	status := http.StatusPartialContent
+
+	switch len(ranges) {
+	case 0:
+		status = http.StatusRequestedRangeNotSatisfiable
+		partial.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	case 1:
+		body = append(body, full[ranges[0].start:ranges[0].start+ranges[0].length]...)
+		partial.Set("Content-Range", ranges[0].contentRange(size))
+	default:
+		var buffer bytes.Buffer
+		parts := multipart.NewWriter(&buffer)
+
+		for _, r := range ranges {
+			part, _ := parts.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {response.GetHeader("Content-Type")},
+				"Content-Range": {r.contentRange(size)},
+			})
+
+			part.Write(full[r.start : r.start+r.length])
+		}
+
+		parts.Close()
+		body = buffer.Bytes()
+		partial.Set("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+	}
+
+	response.traced(cacheLog).WithFields(Fields{
+		"range":  header,
+		"status": status,
+	}).Debug("Serving Cached Range")
+
+	ranged := response.partialResponse(
+		status, partial, ioutil.NopCloser(bytes.NewReader(body)), int64(len(body)),
+	)
+
+	response.release()
+	return ranged
+}
+
+// seekRange serves a single range of the cached body by seeking into
+// the cache file; so the rest of a large body is never read. It returns
+// nil unless the body is stored as is and the range is one satisfiable.
+func (response *Response) seekRange(header string) *Response {
+	body, ok := response.proxied.Body.(cacheFileBody)
+	if !ok || body.offset < 0 || response.body != nil {
+		return nil
+	}
+
+	size := response.proxied.ContentLength
+	ranges, ok := parseRange(header, size)
+	if !ok || len(ranges) != 1 {
+		return nil
+	}
+
+	r := ranges[0]
+	response.traced(cacheLog).WithFields(Fields{
+		"range":  header,
+		"offset": body.offset + r.start,
+	}).Debug("Seeking Cached Range")
+
+	partial := make(http.Header)
+	CopyHeaders(response.proxied.Header, partial)
+	partial.Set("Content-Range", r.contentRange(size))
+
+	return response.partialResponse(
+		http.StatusPartialContent, partial, readCloser{
+			io.NewSectionReader(body.file, body.offset+r.start, r.length), body,
+		}, r.length,
+	)
+}
+
+// partialResponse returns the cached response of the status
+// with the partial header and body; of length bytes.
+func (response *Response) partialResponse(
+	status int, partial http.Header, body io.ReadCloser, length int64,
+) *Response {
+	partial.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	ranged := LoadResponse(&http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         response.proxied.Proto,
+		ProtoMajor:    response.proxied.ProtoMajor,
+		ProtoMinor:    response.proxied.ProtoMinor,
+		Header:        partial,
+		Body:          body,
+		ContentLength: length,
+		Request:       response.proxied.Request,
+	}, nil).SetCacheName(response.cacheName).
+		MarkAsCached().SetStoredAt(response.storedAt)
+	ranged.proxy = response.proxy
+	ranged.requestID = response.requestID
+
+	return ranged
+}
+
+// spoolBody gunzips the body of a compressed cache file into a
+// temporary file; so a range is sought in it like in a body stored as
+// is, rather than read from the whole body decompressed into memory.
+func (response *Response) spoolBody() {
+	body, ok := response.proxied.Body.(cacheFileBody)
+	if !ok || !body.gzipped || response.body != nil {
+		return
+	}
+
+	temp, err := ioutil.TempFile("", "go.proxy-range-")
+	if err != nil {
+		response.traced(cacheLog).WithError(err).Error("Could Not Create Range Spool")
+		return
+	}
+
+	response.traced(cacheLog).WithFields(Fields{"name": temp.Name()}).Debug("Spooling Compressed Cached Body")
+	written, err := io.Copy(temp, body)
+	if err == nil && written != response.proxied.ContentLength {
+		err = io.ErrUnexpectedEOF
+	}
+
+	// Served from what was spooled and whatever is left of the body;
+	// as the body would have been, but without seeking into it.
+	if err != nil {
+		response.traced(cacheLog).WithError(err).Error("Could Not Spool Compressed Cached Body")
+		response.proxied.Body = readCloser{io.MultiReader(
+			io.NewSectionReader(temp, 0, written), body,
+		), cacheFileBody{ReadCloser: body, file: temp, temp: true}}
+		return
+	}
+
+	body.Close()
+	response.proxied.Body = cacheFileBody{
+		ReadCloser: ioutil.NopCloser(io.NewSectionReader(temp, 0, written)),
+		file:       temp,
+		temp:       true,
+	}
+}
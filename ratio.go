@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// hitWindowSeconds is the longest window HitRatio looks back over.
+const hitWindowSeconds = 3600
+
+// hitWindow counts the cache hits and misses of each of the last
+// hitWindowSeconds seconds; in a ring of buckets by the second. Only
+// the proxies of NewProxy keep one.
+type hitWindow struct {
+	mutex   sync.Mutex
+	now     func() time.Time
+	buckets [hitWindowSeconds]hitBucket
+}
+
+type hitBucket struct {
+	second int64
+	hits   int
+	misses int
+}
+
+// HitRatio returns the share of the cache lookups over the last window
+// which were served from the cache; of those for cacheable requests,
+// and 0 when there were none. The window is at most an hour.
+func (proxy *Proxy) HitRatio(window time.Duration) float64 {
+	return proxy.snapshot().hits.ratio(window)
+}
+
+func (window *hitWindow) clock() time.Time {
+	if window.now != nil {
+		return window.now()
+	}
+
+	return time.Now()
+}
+
+// record counts a cache lookup in the bucket of this second.
+func (window *hitWindow) record(hit bool) {
+	if window == nil {
+		return
+	}
+
+	window.mutex.Lock()
+	defer window.mutex.Unlock()
+
+	second := window.clock().Unix()
+	bucket := &window.buckets[second%hitWindowSeconds]
+
+	// The bucket was last used a lap of the ring ago.
+	if bucket.second != second {
+		*bucket = hitBucket{second: second}
+	}
+
+	if hit {
+		bucket.hits++
+	} else {
+		bucket.misses++
+	}
+}
+
+// ratio sums the buckets of the seconds within the window.
+func (window *hitWindow) ratio(within time.Duration) float64 {
+	if window == nil {
+		return 0
+	}
+
+	window.mutex.Lock()
+	defer window.mutex.Unlock()
+
+	seconds := int64((within + time.Second - 1) / time.Second)
+	if seconds > hitWindowSeconds {
+		seconds = hitWindowSeconds
+	}
+
+	now := window.clock().Unix()
+
+	var hits, lookups int
+	for _, bucket := range window.buckets {
+		if bucket.second > now-seconds && bucket.second <= now {
+			hits += bucket.hits
+			lookups += bucket.hits + bucket.misses
+		}
+	}
+
+	if lookups == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(lookups)
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHitRatioWindow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	window := &hitWindow{now: func() time.Time { return now }}
+
+	record := func(hits, misses int) {
+		for i := 0; i < hits; i++ {
+			window.record(true)
+		}
+		for i := 0; i < misses; i++ {
+			window.record(false)
+		}
+	}
+
+	ratio := func(within time.Duration, want float64) {
+		t.Helper()
+		if got := window.ratio(within); got != want {
+			t.Errorf("at %v, ratio over %v = %v; want %v", now.Unix(), within, got, want)
+		}
+	}
+
+	ratio(time.Minute, 0)
+
+	record(3, 1)
+	now = now.Add(10 * time.Second)
+	record(0, 1)
+	now = now.Add(20 * time.Second)
+	record(4, 0)
+
+	ratio(time.Second, 1)
+	ratio(25*time.Second, 0.8)
+	ratio(time.Minute, 7.0/9)
+
+	// A lap of the ring later; the buckets of then count no more.
+	now = now.Add(hitWindowSeconds * time.Second)
+	record(0, 2)
+	ratio(24*time.Hour, 0)
+}
+
+func TestHitRatioServed(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	for i := 0; i < 4; i++ {
+		readBody(t, get(proxy, origin.URL+"/a"))
+	}
+
+	if ratio := proxy.HitRatio(time.Minute); ratio != 0.75 {
+		t.Errorf("HitRatio = %v; want 0.75", ratio)
+	}
+}
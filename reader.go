@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBodyReadTimeout is returned once an origin stalls its response
+// body past UseBodyReadTimeout.
+var ErrBodyReadTimeout = errors.New("proxy: read of upstream body timed out")
+
+// timeoutReader aborts reading a response body from an origin that
+// stalls for longer than the timeout on a read; closing the body so
+// the stalled read and its connection are freed.
+type timeoutReader struct {
+	io.ReadCloser
+	timeout  time.Duration
+	timedOut atomic.Bool
+}
+
+func (reader *timeoutReader) Read(data []byte) (int, error) {
+	if reader.timedOut.Load() {
+		return 0, ErrBodyReadTimeout
+	}
+
+	timer := time.AfterFunc(reader.timeout, func() {
+		reader.timedOut.Store(true)
+		reader.ReadCloser.Close()
+	})
+
+	n, err := reader.ReadCloser.Read(data)
+	timer.Stop()
+
+	if reader.timedOut.Load() {
+		responseLog.WithFields(Fields{
+			"timeout": reader.timeout,
+		}).Warning("Aborting Read Of Stalled Body")
+		return n, ErrBodyReadTimeout
+	}
+
+	return n, err
+}
+
+// UseBodyReadTimeout sets how long a read of a response body from the
+// origin may stall before the transfer is aborted; so the response is
+// not cached. Event streams are never timed out. Zero disables it.
+func (proxy *Proxy) UseBodyReadTimeout(timeout time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.bodyReadTimeout = timeout
+	return proxy
+}
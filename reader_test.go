@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBodyReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Length", "1024")
+		w.Write([]byte("the start"))
+		w.(http.Flusher).Flush()
+
+		// Stalls mid-body; until the test is done.
+		<-release
+	}))
+	defer origin.Close()
+	defer close(release)
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseBodyReadTimeout(50 * time.Millisecond)
+
+	done := make(chan *Response)
+	go func() {
+		response := proxy.Fetch(newRequest("GET", origin.URL+"/stall", ""))
+		response.WriteTo(httptest.NewRecorder())
+		done <- response
+	}()
+
+	select {
+	case response := <-done:
+		if err := response.Err(); !errors.Is(err, ErrBodyReadTimeout) {
+			t.Errorf("err = %v; want ErrBodyReadTimeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the fetch of a stalled body was not aborted")
+	}
+
+	if entries := entryFiles(t, root); len(entries) != 0 {
+		t.Errorf("cache entries = %q; want the stalled body uncached", entries)
+	}
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxRedirects is how many redirects a fetch follows; as http.Client,
+// the response of the one after is passed back to the client.
+const maxRedirects = 10
+
+// UseRedirectBodyBuffer sets how many bytes of request bodies are held
+// in memory so they can be sent again to the Location of a 307 or 308;
+// which keep the method and body of the redirected request. Bodies over
+// max are forwarded as they are read; and their redirects, like those
+// of any spent body, are passed back to the client to follow instead.
+// Zero, the default, only resends bodies with an http.Request GetBody.
+func (proxy *Proxy) UseRedirectBodyBuffer(max int64) *Proxy {
+	defer proxy.configure()()
+	proxy.redirectBodies = max
+	return proxy
+}
+
+// holdBody reads up to max bytes of the body of the request into
+// memory; letting GetBody replay it when the whole of it fits.
+func (request *Request) holdBody(max int64) {
+	if request.proxied.GetBody != nil {
+		return
+	}
+
+	body := request.proxied.Body
+	data, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		request.traced(requestLog).WithError(err).Warning("Could Not Buffer Request Body")
+	}
+
+	if err != nil || int64(len(data)) > max {
+		request.proxied.Body = readCloser{io.MultiReader(bytes.NewReader(data), body), body}
+		return
+	}
+
+	body.Close()
+	request.traced(requestLog).WithFields(Fields{"size": len(data)}).Debug("Holding Request Body")
+	request.body = data
+	request.proxied.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	request.proxied.Body, _ = request.proxied.GetBody()
+}
+
+// redirectStatus reports if the status is a redirect to follow; any
+// other response with a Location, such as a 201, is passed back as is.
+func redirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// redirect readies the request for the Location of a redirect of the
+// status; by RFC 7231, 301, 302 and 303 are followed with a GET (the
+// first two by convention), dropping the body. Otherwise the method
+// and body are kept; reporting false when the body is spent.
+func (request *Request) redirect(status int) bool {
+	method := request.proxied.Method
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		if method != "GET" && method != "HEAD" {
+			request.traced(requestLog).WithFields(Fields{"method": method}).Debug("Redirecting As GET")
+			request.proxied.Method = "GET"
+			request.proxied.Body = nil
+			request.proxied.GetBody = nil
+			request.proxied.ContentLength = 0
+			request.RemoveHeaders("Content-Type", "Content-Length", "Content-Encoding", "Expect")
+		}
+
+		return true
+	}
+
+	if body := request.proxied.Body; body == nil || body == http.NoBody {
+		return true
+	}
+
+	if request.proxied.GetBody == nil {
+		request.traced(requestLog).WithFields(Fields{"method": method}).Warning("Could Not Resend Request Body")
+		return false
+	}
+
+	body, err := request.proxied.GetBody()
+	if err != nil {
+		request.traced(requestLog).WithError(err).Warning("Could Not Resend Request Body")
+		return false
+	}
+
+	request.proxied.Body = body
+	return true
+}
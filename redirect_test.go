@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// redirectOrigin redirects /from with the status of its query to /to,
+// which answers with the method and body it got; /loop redirects to
+// itself, counting the hits, and /created is a 201 with a Location.
+func redirectOrigin(loops *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/from":
+			status, _ := strconv.Atoi(r.URL.RawQuery)
+			w.Header().Set("Location", "/to")
+			w.WriteHeader(status)
+		case "/to":
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte(r.Method + " " + string(body)))
+		case "/loop":
+			loops.Add(1)
+			w.Header().Set("Location", "/loop")
+			w.WriteHeader(http.StatusFound)
+		case "/created":
+			w.Header().Set("Location", "/to")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		}
+	}))
+}
+
+func TestRedirectStatuses(t *testing.T) {
+	var loops atomic.Int32
+	origin := redirectOrigin(&loops)
+	defer origin.Close()
+
+	for _, test := range []struct {
+		status int
+		want   string
+	}{
+		{http.StatusMovedPermanently, "GET "},
+		{http.StatusFound, "GET "},
+		{http.StatusSeeOther, "GET "},
+		{http.StatusTemporaryRedirect, "POST a body"},
+		{http.StatusPermanentRedirect, "POST a body"},
+	} {
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseRedirectBodyBuffer(1024)
+
+		url := origin.URL + "/from?" + strconv.Itoa(test.status)
+		response := serve(proxy, newRequest("POST", url, "a body"))
+		if body := readBody(t, response); response.StatusCode != http.StatusOK || body != test.want {
+			t.Errorf("%d: got %d %q; want 200 %q", test.status, response.StatusCode, body, test.want)
+		}
+	}
+}
+
+func TestRedirectNotFollowed(t *testing.T) {
+	var loops atomic.Int32
+	origin := redirectOrigin(&loops)
+	defer origin.Close()
+
+	// Only redirect statuses are followed.
+	for _, status := range []int{http.StatusOK, http.StatusNotModified, http.StatusUseProxy} {
+		proxy := NewProxy().UseCachePath(t.TempDir())
+
+		response := get(proxy, origin.URL+"/from?"+strconv.Itoa(status))
+		readBody(t, response)
+		if response.StatusCode != status || response.Header.Get("Location") != "/to" {
+			t.Errorf("%d: got %d to %q; want it passed back", status, response.StatusCode, response.Header.Get("Location"))
+		}
+	}
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	response := serve(proxy, newRequest("POST", origin.URL+"/created", "a body"))
+	if body := readBody(t, response); response.StatusCode != http.StatusCreated || body != "created" {
+		t.Errorf("201: got %d %q; want 201 %q", response.StatusCode, body, "created")
+	}
+}
+
+func TestRedirectLoop(t *testing.T) {
+	var loops atomic.Int32
+	origin := redirectOrigin(&loops)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	response := get(proxy, origin.URL+"/loop")
+	readBody(t, response)
+
+	if response.StatusCode != http.StatusFound {
+		t.Errorf("status = %d; want the last redirect passed back", response.StatusCode)
+	}
+	if hits := loops.Load(); hits != maxRedirects+1 {
+		t.Errorf("origin hits = %d; want %d", hits, maxRedirects+1)
+	}
+}
+
+func TestRedirectRevalidatesAsGet(t *testing.T) {
+	var methods atomic.Value
+	methods.Store("")
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/form":
+			w.Header().Set("Location", "/result")
+			w.WriteHeader(http.StatusSeeOther)
+		case "/result":
+			methods.Store(methods.Load().(string) + r.Method + " ")
+
+			// Revalidated on each hit, without a lifetime; and changed.
+			w.Header().Set("ETag", `"`+r.Method+`"`)
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write([]byte(r.Method + " " + string(body)))
+		}
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/result"))
+
+	response := serve(proxy, newRequest("POST", origin.URL+"/form", "a body"))
+	if body := readBody(t, response); body != "GET " {
+		t.Errorf("body = %q; want the result fetched by GET", body)
+	}
+
+	if got := methods.Load(); got != "GET HEAD GET " {
+		t.Errorf("the result was fetched by %q; want %q", got, "GET HEAD GET ")
+	}
+}
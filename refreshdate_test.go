@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRefreshDateOnServe(t *testing.T) {
+	date := time.Now().Add(-30 * time.Second).UTC().Format(http.TimeFormat)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", date)
+		w.Header().Set("Cache-Control", "max-age=600")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	for _, refresh := range []bool{false, true} {
+		proxy := NewProxy().UseCachePath(t.TempDir()).RefreshDateOnServe(refresh)
+		readBody(t, get(proxy, origin.URL+"/a"))
+
+		response := get(proxy, origin.URL+"/a")
+		readBody(t, response)
+
+		if got := response.Header.Get("Date"); got != date {
+			t.Errorf("refresh %v: Date = %q; want the origin's %q", refresh, got, date)
+		}
+
+		age := response.Header.Get("Age")
+		if !refresh {
+			if age != "" {
+				t.Errorf("refresh %v: Age = %q; want none", refresh, age)
+			}
+			continue
+		}
+
+		// Sent 30s ago; and only just cached.
+		if seconds, err := strconv.Atoi(age); err != nil || seconds < 29 || seconds > 40 {
+			t.Errorf("refresh %v: Age = %q; want about 30", refresh, age)
+		}
+	}
+}
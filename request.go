@@ -1,18 +1,28 @@
 package proxy
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha1"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// ErrNotCached is the error of the 504 Gateway Timeout answering
+// a Cache-Control: only-if-cached request without a cached response.
+var ErrNotCached = errors.New("proxy: response is not cached")
+
 // HopByHopHeaders are removed on load.
 // http://www.w3.org/Protocols/rfc2616/rfc2616-sec13.html
 var HopByHopHeaders = []string{
@@ -26,15 +36,52 @@ var HopByHopHeaders = []string{
 	"Upgrade",
 }
 
+// credentialHeaders are left out of logged and echoed requests.
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// URIIndexName is the CacheNameURI file of directory style paths and
+// URILeafName that of the others; each path is a directory holding
+// one of them, so "/docs", "/docs/" and "/docs/page" are all cached
+// alongside each other. Entries cached before them, by the Host/Path
+// alone, are not found under these names; clear them when upgrading.
+const (
+	URIIndexName = "__index__"
+	URILeafName  = "__leaf__"
+)
+
 type Request struct {
 	cachePath      string
 	cacheName      string
 	cacheNameStyle CacheNameStyle
+	cacheSharding  int
 
+	proxy         *Proxy
 	transport     http.RoundTripper
 	original      *http.Request
 	proxied       *http.Request
 	copiedHeaders bool
+
+	// body is the buffered body of a cacheable
+	// request other than GET; part of its name.
+	body []byte
+
+	// bodyOverLimit is set once the body is found to be over the
+	// UseCacheBodyLimit; it can't name the request, so it is uncached.
+	bodyOverLimit bool
+
+	// requestID traces the request under UseRequestIDHeader.
+	requestID string
+
+	// capture keeps the start of the body under CaptureRequestBodies.
+	capture *bodyCapture
+
+	// revalidated is the response fetched whole to revalidate the
+	// Content-SHA1 of the cached one; served if that has changed.
+	revalidated *http.Response
 }
 
 func LoadRequest(
@@ -44,18 +91,19 @@ func LoadRequest(
 
 	// Prepare the Request
 	request = &Request{
+		proxy:    defaultProxy(),
 		original: original,
 		proxied:  new(http.Request),
 	}
 
 	// Shallow copy the original Request to the Proxied one.
-	log.Debug("Cloning Request")
+	requestLog.Debug("Cloning Request")
 	*request.proxied = *request.original
 	request.proxied.Close = false
 
 	// Remove modifying headers to ensure a persistent connection. Due
 	// to the shallow copy; we need to copy the headers to allow this.
-	log.Debug("Removing HopByHop Headers")
+	requestLog.Debug("Removing HopByHop Headers")
 	request.RemoveHeaders(append(
 		hopByHopHeaders,
 		HopByHopHeaders...,
@@ -64,19 +112,54 @@ func LoadRequest(
 	// Add the requests RemoteAddr to the X-Forwarded-For header chain.
 	request.xForwardedFor()
 
-	// Ensure request path has a string.
-	if !strings.HasPrefix(request.proxied.URL.Path, "/") {
+	// Ensure request path has a string; unless OPTIONS asks for "*".
+	if request.asteriskForm() {
+		request.setAsteriskForm()
+	} else if !strings.HasPrefix(request.proxied.URL.Path, "/") {
 		request.proxied.URL.Path = "/" + request.proxied.URL.Path
 	}
 
 	return
 }
 
+// collapseSlashes cleans the path of the proxied request; as
+// path.Clean does, though keeping a trailing slash.
+func (request *Request) collapseSlashes() {
+	if request.asteriskForm() {
+		return
+	}
+
+	uri := *request.proxied.URL
+	uri.Path, uri.RawPath = cleanPath(uri.Path), cleanPath(uri.RawPath)
+
+	if uri.Path != request.proxied.URL.Path {
+		request.traced(requestLog).WithFields(Fields{
+			"path":    request.proxied.URL.Path,
+			"cleaned": uri.Path,
+		}).Debug("Collapsing Slashes")
+	}
+
+	request.proxied.URL = &uri
+}
+
+func cleanPath(name string) string {
+	if name == "" {
+		return name
+	}
+
+	cleaned := path.Clean(name)
+	if strings.HasSuffix(name, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	return cleaned
+}
+
 func (request *Request) RemoveHeaders(headers ...string) *Request {
 	for _, header := range headers {
 		if request.proxied.Header.Get(header) != "" {
 			request.copyHeaders()
-			log.Debug("Removing Header: %s", header)
+			request.traced(requestLog).WithFields(Fields{"header": header}).Debug("Removing Header")
 			request.proxied.Header.Del(header)
 		}
 	}
@@ -84,50 +167,77 @@ func (request *Request) RemoveHeaders(headers ...string) *Request {
 	return request
 }
 
+// SetHost sets the Host header sent upstream; while the connection
+// is still made to the URL host, as for virtual-host routing.
+func (request *Request) SetHost(host string) *Request {
+	request.traced(requestLog).WithFields(Fields{"host": host}).Debug("Overriding Host Header")
+	request.proxied.Host = host
+	return request
+}
+
+// SetScheme sets the scheme ("http" or "https") the request is sent
+// upstream with; as behind a load balancer terminating TLS. A request
+// without a URL host, as received by a server, is sent to its Host.
+func (request *Request) SetScheme(scheme string) *Request {
+	request.traced(requestLog).WithFields(Fields{"scheme": scheme}).Debug("Overriding Request Scheme")
+
+	uri := *request.proxied.URL
+	uri.Scheme = strings.ToLower(scheme)
+
+	if uri.Host == "" {
+		uri.Host = request.proxied.Host
+	}
+
+	request.proxied.URL = &uri
+	return request
+}
+
 func (request *Request) SetTransport(
 	transport http.RoundTripper,
 ) *Request {
-	log.Debug("Setting Transport For Request")
+	request.traced(requestLog).Debug("Setting Transport For Request")
 	request.transport = transport
 	return request
 }
 
 func (request *Request) Head() *Request {
-	log.Debug("Preparing To Request Only Headers")
+	request.traced(requestLog).Debug("Preparing To Request Only Headers")
 	request.proxied.Method = "HEAD"
 	return request
 }
 
 func (request *Request) Get(forms ...map[string]interface{}) *Request {
-	log.Debug("Preparing GET Request")
+	request.traced(requestLog).Debug("Preparing GET Request")
 	request.proxied.Method = "GET"
 	request.AddFormData(forms...)
 	return request
 }
 
 func (request *Request) Put(forms ...map[string]interface{}) *Request {
-	log.Debug("Preparing PUT Request")
+	request.traced(requestLog).Debug("Preparing PUT Request")
 	request.proxied.Method = "PUT"
 	request.AddFormData(forms...)
 	return request
 }
 
 func (request *Request) Post(forms ...map[string]interface{}) *Request {
-	log.Debug("Preparing POST Request")
+	request.traced(requestLog).Debug("Preparing POST Request")
 	request.proxied.Method = "POST"
 	request.AddFormData(forms...)
 	return request
 }
 
 func (request *Request) Delete(forms ...map[string]interface{}) *Request {
-	log.Debug("Preparing DELETE Request")
+	request.traced(requestLog).Debug("Preparing DELETE Request")
 	request.proxied.Method = "DELETE"
 	request.AddFormData(forms...)
 	return request
 }
 
 func (request *Request) OriginalMethod() *Request {
-	log.Debug("Restoring To %s Request", request.original.Method)
+	request.traced(requestLog).WithFields(Fields{
+		"method": request.original.Method,
+	}).Debug("Restoring Original Method")
 	request.proxied.Method = request.original.Method
 	return request
 }
@@ -135,7 +245,7 @@ func (request *Request) OriginalMethod() *Request {
 func (request *Request) AddFormData(
 	forms ...map[string]interface{},
 ) *Request {
-	log.Warning("No Handler for FormData Injection Yet")
+	request.traced(requestLog).Warning("No Handler for FormData Injection Yet")
 
 	// for _, form := range forms {
 	//
@@ -145,17 +255,33 @@ func (request *Request) AddFormData(
 }
 
 func (request *Request) AddFormField(key string, value string) *Request {
-	log.Warning("No Handler for FormData Injection Yet")
+	request.traced(requestLog).Warning("No Handler for FormData Injection Yet")
 	return request
 }
 
 func (request *Request) AddFormFile(key string, value io.Reader) *Request {
-	log.Warning("No Handler for FormData Injection Yet")
+	request.traced(requestLog).Warning("No Handler for FormData Injection Yet")
 	return request
 }
 
+// HTTP sets the Proto of the proxied request to that of the upstream
+// transport; the client's under PreserveProto, HTTP/2.0 under
+// ForceHTTP2, otherwise HTTP/1.1.
 func (request *Request) HTTP() *Request {
-	log.Debug("Preparing HTTP Request")
+	request.traced(requestLog).Debug("Preparing HTTP Request")
+
+	if request.proxy.preserveProto && request.proxied.ProtoMajor > 0 {
+		request.traced(requestLog).WithFields(Fields{"proto": request.proxied.Proto}).Debug("Preserving Request Proto")
+		return request
+	}
+
+	if request.proxy.http2 == http2Forced {
+		request.proxied.Proto = "HTTP/2.0"
+		request.proxied.ProtoMajor = 2
+		request.proxied.ProtoMinor = 0
+		return request
+	}
+
 	request.proxied.Proto = "HTTP/1.1"
 	request.proxied.ProtoMajor = 1
 	request.proxied.ProtoMinor = 1
@@ -163,8 +289,8 @@ func (request *Request) HTTP() *Request {
 }
 
 func (request *Request) FTP() *Request {
-	log.Debug("Preparing FTP Request")
-	log.Warning("FTP Requests are not yet supported")
+	request.traced(requestLog).Debug("Preparing FTP Request")
+	request.traced(requestLog).Warning("FTP Requests are not yet supported")
 	request.proxied.Proto = "FTP"
 	request.proxied.ProtoMajor = 0
 	request.proxied.ProtoMinor = 0
@@ -172,42 +298,128 @@ func (request *Request) FTP() *Request {
 }
 
 func (request *Request) Fetch(transport ...http.RoundTripper) *Response {
+	if request.coalescesMiss() {
+		return request.fetchMiss(transport...)
+	}
+
+	return request.fetch(false, transport...)
+}
+
+// fetch is Fetch; revalidating fetches of a cached response skip the
+// cache and the answers made from it, going to the origin directly.
+func (request *Request) fetch(
+	revalidating bool, transport ...http.RoundTripper,
+) *Response {
 	var httpResponse *http.Response
 	var err error
+	var latency time.Duration
+	var lookup time.Duration
+	var started time.Time
+	var redirects int
+
+	if response := request.forbidden(); response != nil {
+		return response
+	}
+
+	if method := request.proxied.Method; method == "TRACE" || method == "OPTIONS" {
+		if response := request.maxForwards(); response != nil {
+			return response
+		}
+	}
+
+	// Cache-Control: only-if-cached; the origin is never contacted.
+	if _, yes := headerValue(
+		request.proxied.Header, "Cache-Control", "only-if-cached",
+	); yes && !revalidating {
+		started = time.Now()
+		response := request.fetchOnlyIfCached()
+		response.lookup = time.Since(started)
+		return response
+	}
+
+	// A HEAD is answered by the cached GET; unless HEAD is cached itself.
+	if method := request.proxied.Method; method == "HEAD" && !revalidating &&
+		!request.proxy.cacheableMethod(method) && request.proxy.cacheableMethod("GET") {
+		started = time.Now()
+		if response := request.fetchCachedHead(); response != nil {
+			response.lookup = time.Since(started)
+			return response
+		}
+		lookup += time.Since(started)
+	}
 
-	if request.proxied.Method != "GET" {
+	if revalidating || !request.proxy.cacheableMethod(request.proxied.Method) {
 		goto RoundTrip
 	}
 
 FetchCache:
+	if !request.bodyCacheable() {
+		goto RoundTrip
+	}
+
+	started = time.Now()
 	if response := request.FetchCache(); response != nil {
+		request.revalidated = nil
+		response.lookup = lookup + time.Since(started)
 		return response
 	}
+	lookup += time.Since(started)
 
-RoundTrip:
-	log.Debug("Fetching Response From Request")
-	var buffer bytes.Buffer
-	request.proxied.Write(&buffer)
-	log.Info("\n" + buffer.String())
+	// Fetched whole by the revalidation; no need to fetch it again.
+	if latest := request.revalidated; latest != nil {
+		request.revalidated = nil
+		httpResponse = latest
+		goto LoadResponse
+	}
 
-	switch {
-	case len(transport) == 1:
-		httpResponse, err = transport[0].RoundTrip(request.proxied)
-	case request.transport != nil:
-		httpResponse, err = request.transport.RoundTrip(request.proxied)
-	default:
-		httpResponse, err = http.DefaultTransport.RoundTrip(request.proxied)
+	// Partial requests go to the origin conditioned on the
+	// cached copy; so the full resource is returned if it changed.
+	if request.proxied.Header.Get("Range") != "" {
+		request.setIfRange()
 	}
 
-	if err != nil {
-		log.Error(err.Error())
-		return nil
+RoundTrip:
+	started = time.Now()
+	httpResponse, err = request.roundTrip(transport...)
+	latency += time.Since(started)
+	if err == ErrTooManyFetches {
+		return request.statusResponse(http.StatusServiceUnavailable, err)
+	} else if err != nil {
+		request.traced(requestLog).WithError(err).Error("Round Trip Failed")
+		request.proxy.events.failed(request.FullCacheName(), err)
+
+		if response := request.fallbackResponse(err); response != nil {
+			return response
+		}
+
+		return request.statusResponse(http.StatusBadGateway, err)
 	}
 
 	// Handle Location HTTP Header redirects
-	log.Debug("Checking If Location Response Header Was Received")
-	if location := httpResponse.Header.Get("Location"); location != "" {
-		log.Debug("Handling Location Response Header Redirect")
+	request.traced(requestLog).Debug("Checking If Location Response Header Was Received")
+	if location := httpResponse.Header.Get("Location"); location != "" &&
+		redirectStatus(httpResponse.StatusCode) {
+		request.traced(requestLog).WithFields(Fields{
+			"location": location,
+		}).Debug("Handling Location Response Header Redirect")
+
+		// A redirect loop is passed back; the client is told where it ended.
+		if redirects++; redirects > maxRedirects {
+			request.traced(requestLog).WithFields(Fields{
+				"redirects": maxRedirects,
+			}).Warning("Stopped After Too Many Redirects")
+			goto LoadResponse
+		}
+
+		// An echoed unkeyed header is the client's to follow; uncached.
+		if request.proxy.poisonGuard {
+			if header, yes := request.proxy.reflectedHeader(
+				request.proxied, httpResponse.Header,
+			); yes {
+				request.traced(requestLog).WithFields(Fields{"header": header}).Warning("Not Following Reflected Header")
+				goto LoadResponse
+			}
+		}
 
 		// If our request url is missing a host
 		// (can happen if forwarding request as a proxy)
@@ -220,64 +432,550 @@ RoundTrip:
 
 		// Try not to knock the service down.
 		if err != nil {
-			log.Error("Could Not Handle Location Redirect")
+			request.traced(requestLog).WithError(err).Error("Could Not Handle Location Redirect")
+			goto LoadResponse
+		}
+
+		// The client follows the redirect of a body we can't send again.
+		if !request.redirect(httpResponse.StatusCode) {
 			goto LoadResponse
 		}
 
-		// If we have a returned Host
-		// apply the host to the request.
-		if uri.Host != "" {
+		// If we have a returned Host apply it to the request; a
+		// Host set by SetHost is kept for redirects to the same host.
+		if uri.Host != "" && uri.Host != request.proxied.URL.Host {
 			request.proxied.Host = uri.Host
 		}
 
 		// Update the requst URL
 		request.proxied.URL = uri
 
+		// Done with the redirect; free its connection and fetch slot.
+		httpResponse.Body.Close()
+
+		if response := request.forbidden(); response != nil {
+			return response
+		}
+
 		// Try again
-		log.Debug("Fetch The Redirected Request")
+		request.traced(requestLog).Debug("Fetch The Redirected Request")
 		goto FetchCache
 	}
 
 LoadResponse:
-	return LoadResponse(httpResponse, err).
-		SetCacheName(request.CacheName())
+	response := LoadResponse(httpResponse, err).
+		SetCacheName(request.FullCacheName())
+	response.proxy = request.proxy
+	response.requestID = request.requestID
+	response.cachePath = request.CachePath()
+	response.namedBy = request.namingRequest()
+	response.latency = latency
+	response.lookup = lookup
+	response.capture = request.capture
+	response.bodyOverLimit = request.bodyOverLimit
+
+	// An origin stalling the body is cut off; unless it is an event stream.
+	if timeout := request.proxy.bodyReadTimeout; timeout > 0 && !response.Streaming() {
+		response.proxied.Body = &timeoutReader{ReadCloser: response.proxied.Body, timeout: timeout}
+	}
+
+	// A HEAD has no body to check the sums against.
+	if request.proxy.verifyChecksums && request.proxied.Method != "HEAD" {
+		if err := response.VerifyChecksums(); err != nil {
+			request.traced(requestLog).WithError(err).Error("Rejecting Response")
+			response.release()
+			return request.statusResponse(http.StatusBadGateway, err)
+		}
+	}
+
+	if invalidates(request.proxied.Method, response.proxied.StatusCode) {
+		request.invalidateCache()
+	}
+
+	return response
+}
+
+// roundTrip sends the proxied request upstream; through the given
+// transport, else the Request transport, else http.DefaultTransport.
+func (request *Request) roundTrip(
+	transport ...http.RoundTripper,
+) (*http.Response, error) {
+	// Only the headers; writing the request would consume its body.
+	var buffer bytes.Buffer
+	request.proxied.Header.WriteSubset(&buffer, credentialHeaders)
+	request.traced(requestLog).WithFields(Fields{
+		"method": request.proxied.Method,
+		"url":    request.proxied.URL,
+		"header": buffer.String(),
+	}).Debug("Fetching Response From Request")
+
+	switch {
+	case len(transport) == 1:
+		return request.proxy.retryRoundTrip(transport[0], request.proxied)
+	case request.transport != nil:
+		return request.proxy.retryRoundTrip(request.transport, request.proxied)
+	default:
+		return request.proxy.retryRoundTrip(http.DefaultTransport, request.proxied)
+	}
 }
 
+// statusResponse answers the request from the proxy itself.
+func (request *Request) statusResponse(status int, err error) *Response {
+	response := newStatusResponse(request.proxied, status, err)
+	response.proxy = request.proxy
+	response.requestID = request.requestID
+	return response
+}
+
+// FetchCache returns the cached response of the request while it is
+// fresh; Range requests are served the ranges of the cached body.
 func (request *Request) FetchCache() *Response {
-	log.Debug("Checking If Cached Response Exists")
-	if file, err := os.Open(request.CacheName()); err == nil {
-
-		log.Debug("Loading Cached Response")
-		response := LoadResponse(http.ReadResponse(
-			bufio.NewReader(file), request.proxied,
-		)).SetCacheName(request.CacheName()).MarkAsCached()
-
-		log.Debug("Checking For Cached Response Expiration")
-		if !response.CacheExpired(func() *Response {
-			response := request.Head().Fetch()
-			request.OriginalMethod()
-			return response
-		}) {
-			log.Debug("Serving Cached Response")
-			return response
+	request.traced(cacheLog).Debug("Checking If Cached Response Exists")
+	name := request.FullCacheName()
+	if response := request.loadCache(name); response != nil {
+		request.traced(cacheLog).Debug("Checking For Cached Response Expiration")
+		if !request.cacheExpired(response) {
+			request.traced(cacheLog).Debug("Serving Cached Response")
+			request.proxy.hits.record(true)
+			request.proxy.events.cacheHit(response.cacheName)
+			return request.cachedRange(response)
 		}
+
+		response.proxied.Body.Close()
+		response.release()
 	}
 
-	log.Debug("No Valid Cached Response")
+	request.traced(cacheLog).Debug("No Valid Cached Response")
+	request.proxy.hits.record(false)
+	request.proxy.events.cacheMissed(name)
 	return nil
 }
 
+// fetchOnlyIfCached serves the cached response without revalidating it;
+// if it is fresh or the request accepts its max-stale. Otherwise the
+// request is answered with a 504 Gateway Timeout.
+func (request *Request) fetchOnlyIfCached() *Response {
+	request.traced(cacheLog).Debug("Only If Cached")
+
+	if request.proxy.cacheableMethod(request.proxied.Method) {
+		// Named as the request that was cached; without the directive.
+		name := request.cacheNameWithout("Cache-Control", "Range", "If-Range")
+		if response := request.loadCache(name); response != nil {
+			if request.acceptsCached(response) {
+				request.traced(cacheLog).Debug("Serving Cached Response")
+				request.proxy.hits.record(true)
+				request.proxy.events.cacheHit(response.cacheName)
+				return request.cachedRange(response)
+			}
+
+			response.proxied.Body.Close()
+			response.release()
+		}
+	}
+
+	request.traced(cacheLog).Debug("No Acceptable Cached Response")
+	request.proxy.hits.record(false)
+	request.proxy.events.cacheMissed(request.cacheNameWithout("Cache-Control", "Range", "If-Range"))
+	return request.statusResponse(http.StatusGatewayTimeout, ErrNotCached)
+}
+
+// acceptsCached reports if the cached response is fresh; or stale
+// by no more than the Cache-Control max-stale of the request.
+func (request *Request) acceptsCached(response *Response) bool {
+	if request.proxy.pinned(response.cacheName) {
+		return true
+	}
+
+	if validator := request.proxy.validator; validator != nil && validator(response) {
+		return true
+	}
+
+	stale, known := response.staleness()
+	if known && stale <= 0 {
+		return true
+	}
+
+	value, yes := headerValue(request.proxied.Header, "Cache-Control", "max-stale")
+	if !yes {
+		return false
+	}
+
+	// max-stale without a value accepts any staleness.
+	if value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || !known || stale > time.Duration(seconds)*time.Second {
+			return false
+		}
+	}
+
+	request.traced(cacheLog).WithFields(Fields{"stale": stale}).Debug("Accepting Stale Response")
+	response.proxied.Header.Add("Warning", `110 - "Response is Stale"`)
+	return true
+}
+
+// cacheExpired defers to the Proxy validator when one is set;
+// otherwise the cached response headers decide. Pinned entries
+// never expire.
+func (request *Request) cacheExpired(response *Response) bool {
+	if request.proxy.pinned(response.cacheName) {
+		request.traced(cacheLog).WithFields(Fields{"name": response.cacheName}).Debug("Pinned Cache Entry")
+		return false
+	}
+
+	if validator := request.proxy.validator; validator != nil {
+		fresh := validator(response)
+		request.traced(cacheLog).WithFields(Fields{"fresh": fresh}).Debug("Consulted Validator")
+		return !fresh
+	}
+
+	return response.CacheExpired(func() *Response {
+		return request.revalidate(response)
+	})
+}
+
+// revalidate fetches the latest headers of the cached resource;
+// concurrent revalidations of the same entry share one HEAD.
+func (request *Request) revalidate(cached *Response) *Response {
+	response, _ := request.proxy.revalidations.Do(
+		request.CacheName(), func() *Response {
+			if request.proxy.addContentSHA1 && cached.onlyContentSHA1() {
+				return request.revalidateContentSHA1()
+			}
+
+			// The method fetched; a GET after a 303 of a POST.
+			method := request.proxied.Method
+			response := request.Head().fetch(true)
+			request.proxied.Method = method
+			return response
+		},
+	)
+
+	return response
+}
+
+// revalidateContentSHA1 fetches the latest body to sum; a HEAD has
+// nothing to compare a Content-SHA1 against. A whole body is kept for
+// the request; so if it changed, it is served rather than fetched again.
+func (request *Request) revalidateContentSHA1() *Response {
+	request.traced(cacheLog).Debug("Revalidating By Content-SHA1")
+
+	httpResponse, err := request.roundTrip()
+	if err != nil {
+		request.traced(requestLog).WithError(err).Error("Round Trip Failed")
+		return request.statusResponse(http.StatusBadGateway, err)
+	}
+
+	body, err := ioutil.ReadAll(httpResponse.Body)
+	httpResponse.Body.Close()
+	if err != nil {
+		request.traced(requestLog).WithError(err).Error("Could Not Read Body")
+		return request.statusResponse(http.StatusBadGateway, err)
+	}
+
+	// A copy; the response is shared with concurrent revalidations.
+	if httpResponse.StatusCode == http.StatusOK {
+		latest := *httpResponse
+		latest.Header = httpResponse.Header.Clone()
+		latest.Body = ioutil.NopCloser(bytes.NewReader(body))
+		request.revalidated = &latest
+	}
+
+	sum := sha1.Sum(body)
+	httpResponse.Body = http.NoBody
+
+	response := LoadResponse(httpResponse, nil)
+	response.proxy = request.proxy
+	response.requestID = request.requestID
+	response.proxied.Header.Set("Content-SHA1", base64.StdEncoding.EncodeToString(sum[:]))
+
+	return response
+}
+
+// loadCache reads the cached response stored under name; the
+// cache file is closed along with the returned response body.
+func (request *Request) loadCache(name string) *Response {
+	index := request.proxy.index
+	if index != nil && !index.Has(request.CachePath(), name) {
+		return nil
+	}
+
+	// The checks of the hit share its metadata; decoded once.
+	meta := request.proxy.entryMeta(request.CachePath(), name)
+	if request.cacheCollision(name, meta) {
+		return nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		if index != nil {
+			index.release(request.CachePath(), index.Remove(name))
+		}
+
+		return nil
+	}
+
+	// Past UseRetentionTTL; as good as swept.
+	if info, err := file.Stat(); err == nil && !request.proxy.retained(meta, info.ModTime()) &&
+		!request.proxy.pinned(name) {
+		request.traced(cacheLog).WithFields(Fields{"name": name}).Debug("Cached Response Past Retention")
+		file.Close()
+
+		if err := request.proxy.removeCacheEntry(name); err != nil && !os.IsNotExist(err) {
+			request.traced(cacheLog).WithError(err).Error("Could Not Remove Cache Past Retention")
+		}
+
+		return nil
+	}
+
+	request.traced(cacheLog).WithFields(Fields{"name": name}).Debug("Loading Cached Response")
+	reader, gzipped, err := cacheReader(file)
+	if err != nil {
+		request.traced(cacheLog).WithError(err).Error("Could Not Gunzip Cached Response")
+		file.Close()
+		return nil
+	}
+
+	httpResponse, err := http.ReadResponse(reader, request.proxied)
+
+	if err != nil {
+		request.traced(cacheLog).WithError(err).Error("Could Not Read Cached Response")
+		file.Close()
+		return nil
+	}
+
+	// Parsed fine and still not a response; discard it for a refetch.
+	if httpResponse.StatusCode < 100 || httpResponse.StatusCode > 599 ||
+		httpResponse.Body == nil {
+		request.traced(cacheLog).WithFields(Fields{
+			"name":   name,
+			"status": httpResponse.StatusCode,
+		}).Error("Discarding Invalid Cached Response")
+		file.Close()
+
+		if err := request.proxy.removeCacheEntry(name); err != nil && !os.IsNotExist(err) {
+			request.traced(cacheLog).WithError(err).Error("Could Not Remove Invalid Cache")
+		}
+
+		return nil
+	}
+
+	// Deduplicated; the body is stored by its sum (see DedupeBodies).
+	var stored *os.File
+	sum := httpResponse.Header.Get(cacheBodyHeader)
+	if sum != "" {
+		if stored = request.openBody(httpResponse, meta); stored == nil {
+			file.Close()
+
+			if err := request.proxy.removeCacheEntry(name); err != nil && !os.IsNotExist(err) {
+				request.traced(cacheLog).WithError(err).Error("Could Not Remove Invalid Cache")
+			}
+
+			return nil
+		}
+
+		// Only its length; a HEAD has no body.
+		if request.proxied.Method == "HEAD" {
+			stored.Close()
+			stored = nil
+		}
+	}
+
+	// Changed on disk since it was stored; fetched again.
+	if request.proxy.verifyIntegrity && !request.intactCache(name, meta) {
+		httpResponse.Body.Close()
+		file.Close()
+
+		if stored != nil {
+			stored.Close()
+		}
+
+		// Else it would be referenced again by the fetched response.
+		if corrupt, ok := cacheBodyName(request.CachePath(), sum); ok {
+			os.Remove(corrupt)
+		}
+
+		if err := request.proxy.removeCacheEntry(name); err != nil && !os.IsNotExist(err) {
+			request.traced(cacheLog).WithError(err).Error("Could Not Remove Corrupt Cache")
+		}
+
+		return nil
+	}
+
+	if index != nil {
+		index.Touch(name)
+	}
+
+	var storedAt time.Time
+	if info, err := file.Stat(); err == nil {
+		storedAt = info.ModTime()
+	}
+
+	body := cacheFileBody{ReadCloser: httpResponse.Body, file: file, offset: -1}
+
+	// A body stored by its sum is the whole file; read as is, by range.
+	if stored != nil {
+		httpResponse.Body.Close()
+		file.Close()
+		body = cacheFileBody{ReadCloser: ioutil.NopCloser(stored), file: stored}
+	}
+
+	// A body stored as is can be read from the file directly; by range.
+	// A gzipped one only once it is spooled; see spoolBody.
+	if stored == nil && httpResponse.ContentLength >= 0 &&
+		len(httpResponse.TransferEncoding) == 0 && request.proxied.Method != "HEAD" {
+		if gzipped {
+			body.gzipped = true
+		} else if position, err := file.Seek(0, io.SeekCurrent); err == nil {
+			body.offset = position - int64(reader.Buffered())
+		}
+	}
+
+	httpResponse.Body = body
+	response := LoadResponse(httpResponse, nil).
+		SetCacheName(name).MarkAsCached()
+	response.proxy = request.proxy
+	response.requestID = request.requestID
+
+	if !storedAt.IsZero() {
+		response.SetStoredAt(storedAt)
+	}
+
+	return response
+}
+
+// namingRequest returns the request the cache name is of; the original
+// when it was named up front, as CacheNameURI is before any redirect.
+func (request *Request) namingRequest() *http.Request {
+	if request.cacheName != "" {
+		return request.original
+	}
+
+	return request.proxied
+}
+
+// cacheCollision reports if the named entry was stored for another
+// URL than the request; as when distinct URLs are named the same.
+func (request *Request) cacheCollision(name string, meta *CacheMetadata) bool {
+	if meta == nil {
+		return false
+	}
+
+	stored, err := meta.Request()
+	if err != nil {
+		return false
+	}
+
+	storedURL := request.proxy.cacheURL(stored)
+	requestURL := request.proxy.cacheURL(request.namingRequest())
+	if storedURL == requestURL {
+		return false
+	}
+
+	request.traced(cacheLog).WithFields(Fields{
+		"name":    name,
+		"stored":  storedURL,
+		"request": requestURL,
+	}).Warning("Cache Name Collision")
+	return true
+}
+
+// cacheURL returns the Host and request URI the request is keyed by;
+// with its path cleaned under CollapseSlashes.
+func (proxy *Proxy) cacheURL(httpRequest *http.Request) string {
+	host := httpRequest.URL.Host
+	if host == "" {
+		host = httpRequest.Host
+	}
+
+	keyed := proxy.keyURL(httpRequest.URL)
+	if proxy.collapseSlashes {
+		keyed.Path, keyed.RawPath = cleanPath(keyed.Path), cleanPath(keyed.RawPath)
+	}
+
+	return host + keyed.RequestURI()
+}
+
+// cacheFileBody closes the cache file behind a cached response body;
+// and knows the offset of the body in the file, or -1 if it's encoded.
+// A temporary file (of a spooled body) is removed once closed.
+type cacheFileBody struct {
+	io.ReadCloser
+	file    *os.File
+	offset  int64
+	gzipped bool
+	temp    bool
+}
+
+func (body cacheFileBody) Close() error {
+	body.ReadCloser.Close()
+	err := body.file.Close()
+
+	if body.temp {
+		os.Remove(body.file.Name())
+	}
+
+	return err
+}
+
+// cachedRange answers a Range request with the ranges of the cached
+// full response; which is served whole when the Range can't be parsed
+// or the If-Range of the request no longer matches it.
+func (request *Request) cachedRange(cached *Response) *Response {
+	header := request.proxied.Header.Get("Range")
+	if header == "" {
+		return cached
+	}
+
+	if ifRange := request.proxied.Header.Get("If-Range"); ifRange != "" {
+		if !StrongETagMatch(ifRange, cached.GetHeader("ETag")) &&
+			ifRange != cached.GetHeader("Last-Modified") {
+			request.traced(cacheLog).WithFields(Fields{"if-range": ifRange}).Debug("If-Range Changed")
+			return cached
+		}
+	}
+
+	// Read from the file; rather than all of a large body.
+	cached.spoolBody()
+	if ranged := cached.seekRange(header); ranged != nil {
+		return ranged
+	}
+
+	return cached.rangeResponse(header)
+}
+
+// setIfRange conditions a Range request on the validator of
+// the cached full resource; ETags are only used when strong.
+func (request *Request) setIfRange() {
+	if request.proxied.Header.Get("If-Range") != "" {
+		return
+	}
+
+	cached := request.loadCache(request.FullCacheName())
+	if cached == nil {
+		return
+	}
+
+	defer cached.proxied.Body.Close()
+
+	validator := cached.GetHeader("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = cached.GetHeader("Last-Modified")
+	}
+
+	if validator != "" {
+		request.traced(cacheLog).WithFields(Fields{"validator": validator}).Debug("Setting If-Range")
+		request.copyHeaders()
+		request.proxied.Header.Set("If-Range", validator)
+	}
+}
+
 func (request *Request) SetCachePath(path string) *Request {
 	request.cachePath = path
 	return request
 }
 
 func (request *Request) CachePath() string {
-	if request.cachePath == "" {
-		return "./cache"
-	}
-
-	return request.cachePath
+	return cacheRoot(request.cachePath)
 }
 
 func (request *Request) SetCacheNameStyle(style CacheNameStyle) *Request {
@@ -285,6 +983,13 @@ func (request *Request) SetCacheNameStyle(style CacheNameStyle) *Request {
 	return request
 }
 
+// SetCacheSharding sets how many levels of two hex character
+// directories CacheNameSHA1 names are sharded into.
+func (request *Request) SetCacheSharding(levels int) *Request {
+	request.cacheSharding = levels
+	return request
+}
+
 func (request *Request) SetCacheName(name string) *Request {
 	request.cacheName = filepath.Join(request.CachePath(), name)
 	return request
@@ -299,20 +1004,167 @@ func (request *Request) CacheName() string {
 	// case CacheNameSHA1:
 	default:
 		var buffer bytes.Buffer
-		log.Debug("Generating SHA1 Hash Of Request")
-		request.proxied.WriteProxy(&buffer)
+		request.traced(cacheLog).Debug("Generating SHA1 Hash Of Request")
+
+		// Hash a bodiless copy; writing the request would consume its body.
+		hashed := *request.proxied
+		hashed.Body, hashed.ContentLength = nil, 0
+		hashed.URL = request.proxy.keyURL(hashed.URL)
+
+		// Only the CacheKeyHeaders when set. Otherwise all but the Via
+		// chain, which says how the request got here and not what it is,
+		// and the ID tracing it; which differs for every request.
+		id := request.proxy.requestIDHeader
+		if keys := request.proxy.cacheKeyHeaders; keys != nil {
+			hashed.Header = make(http.Header)
+			for _, key := range keys {
+				if values, ok := request.proxied.Header[key]; ok {
+					hashed.Header[key] = values
+				}
+			}
+		} else if hashed.Header.Get("Via") != "" || id != "" && hashed.Header.Get(id) != "" {
+			hashed.Header = make(http.Header)
+			CopyHeaders(request.proxied.Header, hashed.Header)
+			hashed.Header.Del("Via")
+
+			if id != "" {
+				hashed.Header.Del(id)
+			}
+		}
+
+		hashed.WriteProxy(&buffer)
+
+		// Identical requests other than GET differ by their body.
+		if method := request.proxied.Method; method != "GET" &&
+			request.proxy.cacheableMethod(method) {
+			body, _ := request.bufferBody()
+			buffer.Write(body)
+		}
+
 		return filepath.Join(
 			request.CachePath(),
-			fmt.Sprintf("%x", sha1.Sum(
+			request.proxy.partitionDir(request.original),
+			shardCacheName(fmt.Sprintf("%x", sha1.Sum(
 				buffer.Bytes()),
-			),
+			), request.cacheSharding),
 		)
 	}
 }
 
+// bodyCacheable reports if the request body can name it; a
+// body over the UseCacheBodyLimit can't, and is never cached.
+func (request *Request) bodyCacheable() bool {
+	if request.proxied.Method == "GET" {
+		return true
+	}
+
+	_, ok := request.bufferBody()
+	return ok
+}
+
+// bufferBody reads the request body into memory; so it can be part
+// of the cache name and still be sent upstream after. A body over the
+// UseCacheBodyLimit is sent as it is read instead, reporting false.
+func (request *Request) bufferBody() ([]byte, bool) {
+	if request.bodyOverLimit {
+		return nil, false
+	}
+
+	max := request.proxy.cacheBodyLimit
+	if request.body != nil || request.proxied.Body == nil {
+		request.bodyOverLimit = int64(len(request.body)) > max
+		return request.body, !request.bodyOverLimit
+	}
+
+	body := request.proxied.Body
+	data, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		request.traced(requestLog).WithError(err).Error("Could Not Read Request Body")
+	}
+
+	if err != nil || int64(len(data)) > max {
+		request.traced(cacheLog).WithFields(Fields{"max": max}).Debug("Request Body Over Cache Limit")
+		request.bodyOverLimit = true
+		request.proxied.Body = readCloser{io.MultiReader(bytes.NewReader(data), body), body}
+		return nil, false
+	}
+
+	body.Close()
+	request.body = data
+	request.proxied.Body = ioutil.NopCloser(bytes.NewReader(data))
+	request.proxied.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	return data, true
+}
+
+// shardCacheName prefixes the SHA1 name with a directory for each
+// of its first levels pairs of hex characters; "ab/cd/abcd...".
+func shardCacheName(sum string, levels int) string {
+	var shards []string
+	for level := 0; level < levels && level*2+2 <= len(sum); level++ {
+		shards = append(shards, sum[level*2:level*2+2])
+	}
+
+	return filepath.Join(append(shards, sum)...)
+}
+
+// uriCacheable reports if the request can be named by its Host/URI;
+// only GETs are told apart by it, other methods keep the SHA1 Sum.
+func uriCacheable(httpRequest *http.Request) bool {
+	return httpRequest.Method == "" || httpRequest.Method == "GET"
+}
+
+// uriCacheName returns the Host/URI cache name of the url; the host
+// and path are rooted first so neither can climb out of the cache path.
+// Files are only ever named URIIndexName or URILeafName, so no
+// entry takes the name of a directory another one needs.
+func uriCacheName(uri *url.URL) string {
+	host := strings.TrimPrefix(filepath.Clean("/"+uri.Host), "/")
+	name := filepath.Join(host, filepath.Clean("/"+uri.Path))
+
+	if uri.Path == "" || strings.HasSuffix(uri.Path, "/") {
+		return filepath.Join(name, URIIndexName)
+	}
+
+	return filepath.Join(name, URILeafName)
+}
+
+// FullCacheName returns the CacheName of the whole resource;
+// ignoring any Range and If-Range headers on the request.
+func (request *Request) FullCacheName() string {
+	return request.cacheNameWithout("Range", "If-Range")
+}
+
+// cacheNameWithout returns the CacheName of the request
+// as if it had been sent without the named headers.
+func (request *Request) cacheNameWithout(headers ...string) string {
+	present := false
+	for _, header := range headers {
+		present = present || request.proxied.Header.Get(header) != ""
+	}
+
+	if !present {
+		return request.CacheName()
+	}
+
+	request.copyHeaders()
+	partial := request.proxied.Header
+	request.proxied.Header = make(http.Header)
+	CopyHeaders(partial, request.proxied.Header)
+
+	for _, header := range headers {
+		request.proxied.Header.Del(header)
+	}
+
+	defer func() { request.proxied.Header = partial }()
+	return request.CacheName()
+}
+
 func (request *Request) copyHeaders() {
 	if !request.copiedHeaders {
-		log.Debug("Copying Request Headers")
+		request.traced(requestLog).Debug("Copying Request Headers")
 		request.proxied.Header = make(http.Header)
 
 		CopyHeaders(
@@ -324,11 +1176,33 @@ func (request *Request) copyHeaders() {
 	}
 }
 
+// addVia appends the proxy by name to the Via header chain.
+func (request *Request) addVia(name string) {
+	if name == "" {
+		return
+	}
+
+	request.copyHeaders()
+	request.traced(requestLog).WithFields(Fields{"name": name}).Debug("Adding/Appending Via Header")
+	appendVia(request.proxied.Header, request.original.ProtoMajor, request.original.ProtoMinor, name)
+}
+
+// appendVia appends the "<protocol> <name>" of the message received
+// to the Via header chain; joining it with the Via values already set.
+func appendVia(header http.Header, major int, minor int, name string) {
+	if major == 0 {
+		major, minor = 1, 1
+	}
+
+	via := append(header.Values("Via"), fmt.Sprintf("%d.%d %s", major, minor, name))
+	header.Set("Via", strings.Join(via, ", "))
+}
+
 func (request *Request) xForwardedFor() {
 	if addr, _, e := net.SplitHostPort(
 		request.proxied.RemoteAddr,
 	); e == nil {
-		log.Debug("Adding/Appending X-Forwarded-For Header")
+		request.traced(requestLog).WithFields(Fields{"addr": addr}).Debug("Adding/Appending X-Forwarded-For Header")
 		request.proxied.Header.Add("X-Forwarded-For", addr)
 	}
 }
@@ -3,11 +3,17 @@ package proxy
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"hash"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,25 +21,90 @@ import (
 // Response is a tool for interacting
 // with *http.Responses including a caching layer
 type Response struct {
+	proxy     *Proxy
+	cachePath string
 	cacheName string
+	namedBy   *http.Request
 	err       error
 	proxied   *http.Response
 	cached    bool
+	storedAt  time.Time
+	latency   time.Duration
+	lookup    time.Duration
+
+	// body holds the buffered response body; it
+	// is borrowed from BodyBuffers until release.
+	body *bytes.Buffer
+
+	// requestID traces the request of the response.
+	requestID string
+
+	// capture is the start of the request body; see CaptureRequestBodies.
+	capture *bodyCapture
+
+	// sum is the hex SHA-256 of the body written to the cache.
+	sum string
+
+	// storedBody is the sum of the body stored by DedupeBodies
+	// that the cache file written references; if it does.
+	storedBody string
+
+	// streamed bodies are over the UseStreamThreshold; they
+	// are written by WriteTo as they are read, unbuffered.
+	streamed bool
+
+	// tees also receive the body on the next write.
+	tees []io.Writer
+
+	// coalesced responses are shared from the fetch of another
+	// request missing the cache; which stores it, so they don't.
+	coalesced bool
+
+	// bodyOverLimit is set when the request body was over the
+	// UseCacheBodyLimit; too large to be named by, so uncached.
+	bodyOverLimit bool
 }
 
 // LoadResponse loads a *http.Response and returns a *Response object
 func LoadResponse(httpResponse *http.Response, err error) *Response {
-	log.Debug("Loading Response")
 	var buffer bytes.Buffer
 	httpResponse.Header.Write(&buffer)
-	log.Info("\n" + buffer.String())
+	responseLog.WithFields(Fields{
+		"status": httpResponse.StatusCode,
+		"header": buffer.String(),
+	}).Info("Loading Response")
 
 	return (&Response{
+		proxy:   defaultProxy(),
 		err:     err,
 		proxied: httpResponse,
 	}).RemoveHeaders(HopByHopHeaders...)
 }
 
+// newStatusResponse creates a Response for the request; used when
+// the proxy answers by itself. Its body is JSON or HTML by the Accept
+// header of the request; see statusBody.
+func newStatusResponse(
+	httpRequest *http.Request, status int, err error,
+) *Response {
+	contentType, body := statusBody(httpRequest, status)
+
+	header := make(http.Header)
+	header.Set("Content-Type", contentType)
+
+	return LoadResponse(&http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       httpRequest,
+	}, err)
+}
+
 // RemoveHeaders deletes the named headers from the response headers.
 func (response *Response) RemoveHeaders(headers ...string) *Response {
 	for _, header := range headers {
@@ -57,6 +128,51 @@ func (response *Response) MarkAsCached() *Response {
 	return response
 }
 
+// SetStoredAt records when the cached response was written to the cache.
+func (response *Response) SetStoredAt(storedAt time.Time) *Response {
+	response.storedAt = storedAt
+	return response
+}
+
+// Streaming reports if the response has to reach the client as it
+// arrives, like Server-Sent Events; so it is never buffered or cached.
+func (response *Response) Streaming() bool {
+	return strings.HasPrefix(
+		strings.ToLower(response.GetHeader("Content-Type")),
+		"text/event-stream",
+	)
+}
+
+// UpstreamLatency returns how long the round trips upstream took to
+// answer with the headers of the response; of any redirects too. It is
+// zero for responses served from the cache or by the proxy itself.
+func (response *Response) UpstreamLatency() time.Duration {
+	return response.latency
+}
+
+// requestMethod returns the method of the request the
+// response answers; GET when the request is unknown.
+func (response *Response) requestMethod() string {
+	if request := response.proxied.Request; request != nil && request.Method != "" {
+		return request.Method
+	}
+
+	return "GET"
+}
+
+// Err returns the error met while fetching the response, if any;
+// or else the first error met reading or writing its body.
+func (response *Response) Err() error {
+	return response.err
+}
+
+// setErr records the error unless one was met before.
+func (response *Response) setErr(err error) {
+	if response.err == nil {
+		response.err = err
+	}
+}
+
 // GetHeaderValues returns an string slice
 // of values of a named response header.
 func (response *Response) GetHeaderValues(header string) []string {
@@ -78,29 +194,232 @@ func (response *Response) GetHeaders() http.Header {
 func (response *Response) HasHeaderValue(
 	header string, has string,
 ) (string, bool) {
+	return headerValue(response.proxied.Header, header, has)
+}
+
+// headerValue finds the has subvalue of the header
+// values; as HasHeaderValue does for any headers.
+func headerValue(headers http.Header, header string, has string) (string, bool) {
 	has = strings.ToLower(has)
 
-	for _, value := range response.GetHeaderValues(header) {
-		keyval := append(strings.Split(value, "="), "")
-		key, value := keyval[0], keyval[1]
+	for _, values := range headers[http.CanonicalHeaderKey(header)] {
+		for _, value := range strings.Split(values, ",") {
+			keyval := append(strings.SplitN(value, "=", 2), "")
+			key, value := strings.TrimSpace(keyval[0]), keyval[1]
 
-		if strings.ToLower(key) == has {
-			return value, true
+			if strings.ToLower(key) == has {
+				return strings.Trim(strings.TrimSpace(value), `"`), true
+			}
 		}
 	}
 
 	return "", false
 }
 
+// defaultHeuristicTTL caps heuristic freshness without Proxy.UseMaxTTL.
+const defaultHeuristicTTL = 24 * time.Hour
+
+// freshnessLifetime returns the Cache-Control s-maxage or max-age
+// of the response; s-maxage wins as we are a shared cache, unless
+// Proxy.PrivateCache says we are not and it is ignored. A TTL
+// set with Proxy.UseTTLByContentType overrides them both; and the
+// Proxy.UseCustomTTLHeader of the response overrides all of them.
+func (response *Response) freshnessLifetime() (time.Duration, bool) {
+	if ttl, yes := response.customTTL(); yes {
+		return response.capTTL(ttl), true
+	}
+
+	if ttl, yes := response.contentTypeTTL(); yes {
+		return response.capTTL(ttl), true
+	}
+
+	directives := []string{"s-maxage", "max-age"}
+	if response.proxy.privateCache {
+		directives = directives[1:]
+	}
+
+	for _, maxage := range directives {
+		if value, yes := response.HasHeaderValue(
+			"Cache-Control", maxage,
+		); yes {
+			seconds, err := strconv.ParseInt(value, 10, 64)
+
+			fields := Fields{"directive": maxage, "value": value}
+			response.traced(cacheLog).WithFields(fields).Debug("Cache-Control")
+			if err != nil {
+				response.traced(cacheLog).WithFields(fields).WithError(err).Error("Cache-Control")
+				continue
+			}
+
+			return response.capTTL(time.Duration(seconds) * time.Second), true
+		}
+	}
+
+	return 0, false
+}
+
+// heuristicLifetime is a tenth of the time from Last-Modified to Date
+// (RFC 7234 4.2.2) for responses without an explicit expiry; capped by
+// Proxy.UseMaxTTL or otherwise by a day.
+func (response *Response) heuristicLifetime() (time.Duration, bool) {
+	date, err := time.Parse(time.RFC1123, response.GetHeader("Date"))
+	if err != nil {
+		return 0, false
+	}
+
+	modified, err := time.Parse(time.RFC1123, response.GetHeader("Last-Modified"))
+	if err != nil || modified.After(date) {
+		return 0, false
+	}
+
+	lifetime := date.Sub(modified) / 10
+	if response.proxy.maxTTL <= 0 && lifetime > defaultHeuristicTTL {
+		lifetime = defaultHeuristicTTL
+	}
+
+	lifetime = response.capTTL(lifetime)
+	response.traced(cacheLog).WithFields(Fields{"lifetime": lifetime}).Debug("Heuristic Freshness")
+	return lifetime, true
+}
+
+// capTTL limits the freshness lifetime to Proxy.UseMaxTTL.
+func (response *Response) capTTL(ttl time.Duration) time.Duration {
+	if max := response.proxy.maxTTL; max > 0 && ttl > max {
+		return max
+	}
+
+	return ttl
+}
+
+// customTTL returns the seconds of the UseCustomTTLHeader
+// header of the response; set by the origin for the entry.
+func (response *Response) customTTL() (time.Duration, bool) {
+	header := response.proxy.customTTLHeader
+	if header == "" {
+		return 0, false
+	}
+
+	value := response.GetHeader(header)
+	if value == "" {
+		return 0, false
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || seconds < 0 {
+		response.traced(cacheLog).WithFields(Fields{header: value}).Warning("Ignoring Invalid Custom TTL")
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// contentTypeTTL returns the Proxy.UseTTLByContentType TTL of the
+// longest prefix matching the response Content-Type.
+func (response *Response) contentTypeTTL() (ttl time.Duration, yes bool) {
+	contentType := strings.ToLower(response.GetHeader("Content-Type"))
+	longest := -1
+
+	for prefix, duration := range response.proxy.ttlByContentType {
+		prefix = strings.TrimSuffix(strings.ToLower(prefix), "*")
+
+		if strings.HasPrefix(contentType, prefix) && len(prefix) > longest {
+			longest, ttl, yes = len(prefix), duration, true
+		}
+	}
+
+	if yes {
+		response.traced(cacheLog).WithFields(Fields{
+			"content-type": contentType,
+			"ttl":          ttl,
+		}).Debug("Content-Type TTL")
+	}
+
+	return
+}
+
+// currentAge is the age of the response (RFC 7234 4.2.3); the larger
+// of its apparent age by Date and its Age header when it was received,
+// plus the time it has been resident in the cache since. It is unknown
+// without a Date, an Age or the time the response was stored.
+func (response *Response) currentAge() (time.Duration, bool) {
+	received, known := response.storedAt, !response.storedAt.IsZero()
+	if !known {
+		received = time.Now()
+	}
+
+	var age time.Duration
+	if date, err := time.Parse(time.RFC1123, response.GetHeader("Date")); err == nil {
+		if apparent := received.Sub(date); apparent > 0 {
+			age = apparent
+		}
+
+		known = true
+	}
+
+	if value := response.GetHeader("Age"); value != "" {
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || seconds < 0 {
+			response.traced(cacheLog).WithFields(Fields{"age": value}).Warning("Ignoring Invalid Age")
+		} else {
+			if header := time.Duration(seconds) * time.Second; header > age {
+				age = header
+			}
+
+			known = true
+		}
+	}
+
+	return age + time.Since(received), known
+}
+
+// servedAge returns the Age a cached response is served with under
+// RefreshDateOnServe; empty for other responses or an unknown age.
+func (response *Response) servedAge() string {
+	if !response.cached || response.proxy == nil || !response.proxy.refreshDate {
+		return ""
+	}
+
+	age, known := response.currentAge()
+	if !known {
+		return ""
+	}
+
+	return strconv.FormatInt(int64(age/time.Second), 10)
+}
+
+// staleness returns how long the cached response has been past its
+// freshness lifetime; without asking the origin. It is unknown for
+// responses with neither a lifetime, an Expires nor a Last-Modified.
+func (response *Response) staleness() (time.Duration, bool) {
+	age, known := response.currentAge()
+
+	if lifetime, yes := response.freshnessLifetime(); yes && known {
+		return age - lifetime, true
+	}
+
+	if expires, err := time.Parse(
+		time.RFC1123, response.GetHeader("Expires"),
+	); err == nil {
+		return time.Since(expires), true
+	}
+
+	if lifetime, yes := response.heuristicLifetime(); yes {
+		return age - lifetime, true
+	}
+
+	return 0, false
+}
+
 // CacheExpired checks if the Response is cached and is expired.
-// This is done by comparing information from a HEAD only response.
+// This is done by comparing information from a HEAD only response;
+// unless the response is still fresh by its max-age or Expires.
 //
 // Note: The HEAD only response is retrieved by
 // a function passed from a Request object.
 func (response *Response) CacheExpired(
 	latestHeadFunc func() *Response,
 ) bool {
-	log.Debug("Response Cached? (should be true): %v", response.cached)
+	response.traced(cacheLog).WithFields(Fields{"cached": response.cached}).Debug("Checking Expiration")
 
 	// If this Response is new;
 	// then it's not expired.
@@ -108,32 +427,14 @@ func (response *Response) CacheExpired(
 		return false
 	}
 
-	// Check Cache-Control: s-maxage and max-age
-	responseDate := response.GetHeader("Date")
-	if responseDate != "" {
-		date, err := time.Parse(time.RFC1123, responseDate)
+	// Check Cache-Control: s-maxage and max-age; against the
+	// age of the response, which includes any upstream Age.
+	age, known := response.currentAge()
+	response.traced(cacheLog).WithFields(Fields{"age": age, "known": known}).Debug("Age")
 
-		log.Debug("Date: %v", date)
-		if err != nil {
-			log.Error(err.Error())
-		}
-
-		for _, maxage := range []string{"s-maxage", "max-age"} {
-			if value, yes := response.HasHeaderValue(
-				"Cache-Control", maxage,
-			); yes {
-				age, err := time.ParseDuration(value)
-
-				log.Debug("Cache-Control: has %s of %v", maxage, age)
-				if err != nil {
-					log.Error(err.Error())
-				}
-
-				if err == nil && date.Add(age).Before(time.Now()) {
-					return true
-				}
-			}
-		}
+	// An explicit lifetime needs no revalidation until it ends.
+	if lifetime, yes := response.freshnessLifetime(); yes && known {
+		return age >= lifetime
 	}
 
 	// Check Expires header
@@ -141,16 +442,21 @@ func (response *Response) CacheExpired(
 	if responseExpires != "" {
 		expires, err := time.Parse(time.RFC1123, responseExpires)
 
-		log.Debug("Expires: on %v", expires)
+		response.traced(cacheLog).WithFields(Fields{"expires": expires}).Debug("Expires")
 		if err != nil {
-			log.Error(err.Error())
+			response.traced(cacheLog).WithError(err).Error("Expires")
 		}
 
-		if err == nil && expires.Before(time.Now()) {
-			return true
+		if err == nil {
+			return expires.Before(time.Now())
 		}
 	}
 
+	// Only Last-Modified; fresh for a fraction of its age.
+	if lifetime, yes := response.heuristicLifetime(); yes && known && age < lifetime {
+		return false
+	}
+
 	// The LatestHead should never be cached.
 	// Assume expiration.
 	latestHead := latestHeadFunc()
@@ -158,6 +464,14 @@ func (response *Response) CacheExpired(
 		return true
 	}
 
+	// The origin failed to answer; rather than fail too, stay stale.
+	if latestHead.err != nil || latestHead.proxied.StatusCode >= 500 {
+		response.traced(cacheLog).WithError(latestHead.err).WithFields(Fields{
+			"status": latestHead.proxied.StatusCode,
+		}).Warning("Revalidation Failed")
+		return !response.staleOnError()
+	}
+
 	// Check ETag and Content-MD5 headers
 	for _, header := range []string{
 		"ETag", "Content-MD5", "Content-SHA1",
@@ -166,7 +480,20 @@ func (response *Response) CacheExpired(
 		responseHeader := response.GetHeader(header)
 
 		if latestHeader != "" && responseHeader != "" {
-			log.Debug("%s: ...", header)
+			response.traced(cacheLog).WithFields(Fields{
+				"header": header,
+				"latest": latestHeader,
+				"cached": responseHeader,
+			}).Debug("Comparing Validator")
+
+			// Revalidation only needs the weak comparison.
+			if header == "ETag" {
+				if !WeakETagMatch(latestHeader, responseHeader) {
+					return true
+				}
+
+				continue
+			}
 
 			if latestHeader != responseHeader {
 				return true
@@ -176,19 +503,22 @@ func (response *Response) CacheExpired(
 
 	// Check Last-Modified header
 	latestModified := latestHead.GetHeader("Last-Modified")
-	responseModified := response.GetHeader("Last-Mofified")
+	responseModified := response.GetHeader("Last-Modified")
 	if latestModified != "" && responseModified != "" {
 		lmod, err1 := time.Parse(time.RFC1123, latestModified)
 		cmod, err2 := time.Parse(time.RFC1123, responseModified)
 
-		log.Debug("Last-Modified: latest %v", lmod)
+		response.traced(cacheLog).WithFields(Fields{
+			"latest": lmod,
+			"cached": cmod,
+		}).Debug("Last-Modified")
+
 		if err1 != nil {
-			log.Error(err1.Error())
+			response.traced(cacheLog).WithError(err1).Error("Last-Modified")
 		}
 
-		log.Debug("Last-Modified: cached %v", cmod)
 		if err2 != nil {
-			log.Error(err2.Error())
+			response.traced(cacheLog).WithError(err2).Error("Last-Modified")
 		}
 
 		if err1 == nil && err2 == nil && lmod.After(cmod) {
@@ -199,6 +529,89 @@ func (response *Response) CacheExpired(
 	return false
 }
 
+// staleOnError reports if the cached response can still be served
+// after its revalidation failed; no staler than UseStaleOnError allows
+// and never when it must be revalidated. It is then given a Warning.
+func (response *Response) staleOnError() bool {
+	for _, directive := range []string{"must-revalidate", "proxy-revalidate"} {
+		if _, yes := response.HasHeaderValue("Cache-Control", directive); yes {
+			return false
+		}
+	}
+
+	if max := response.proxy.staleOnError; max > 0 {
+		if stale, known := response.staleness(); !known || stale > max {
+			return false
+		}
+	}
+
+	response.traced(cacheLog).Debug("Serving Stale Response")
+	response.proxied.Header.Add("Warning", `111 - "Revalidation Failed"`)
+	return true
+}
+
+// VerifyChecksums compares the base64 encoded Content-MD5 and
+// Content-SHA1 headers against the body; erroring on a mismatch.
+func (response *Response) VerifyChecksums() error {
+	for _, checksum := range []struct {
+		header string
+		hash   func() hash.Hash
+	}{
+		{"Content-MD5", md5.New},
+		{"Content-SHA1", sha1.New},
+	} {
+		expected := response.GetHeader(checksum.header)
+		if expected == "" {
+			continue
+		}
+
+		sum := checksum.hash()
+		io.Copy(sum, response.copyBody())
+
+		actual := base64.StdEncoding.EncodeToString(sum.Sum(nil))
+		response.traced(cacheLog).WithFields(Fields{
+			"header":   checksum.header,
+			"expected": expected,
+			"actual":   actual,
+		}).Debug("Verifying Checksum")
+
+		if actual != expected {
+			return fmt.Errorf(
+				"%s mismatch: expected %s, got %s",
+				checksum.header, expected, actual,
+			)
+		}
+	}
+
+	return nil
+}
+
+// contentSHA1 returns the base64 encoded SHA1 Sum of the body.
+func (response *Response) contentSHA1() string {
+	sum := sha1.New()
+	io.Copy(sum, response.copyBody())
+	return base64.StdEncoding.EncodeToString(sum.Sum(nil))
+}
+
+// onlyContentSHA1 reports if Content-SHA1 is the only
+// validator the response can be revalidated with.
+func (response *Response) onlyContentSHA1() bool {
+	for _, header := range []string{"ETag", "Last-Modified", "Content-MD5"} {
+		if response.GetHeader(header) != "" {
+			return false
+		}
+	}
+
+	return response.GetHeader("Content-SHA1") != ""
+}
+
+// Tee registers a writer that also receives the body
+// during the next WriteTo or WriteBodyTo; for auditing.
+func (response *Response) Tee(writer io.Writer) *Response {
+	response.tees = append(response.tees, writer)
+	return response
+}
+
 // WriteHeaderTo writes the response headers to the writers.
 func (response *Response) WriteHeaderTo(writers ...io.Writer) {
 	response.proxied.Header.Write(io.MultiWriter(writers...))
@@ -211,82 +624,666 @@ func (response *Response) WriteBodyTo(writers ...io.Writer) {
 		return
 	}
 
-	io.Copy(io.MultiWriter(writers...), reader)
+	writers = append(writers, response.tees...)
+	response.tees = nil
+
+	if _, err := io.Copy(io.MultiWriter(writers...), reader); err != nil {
+		response.traced(responseLog).WithError(err).Error("Could Not Write Body")
+		response.setErr(err)
+	}
 }
 
 // GunzipBodyTo using gunzip on the body then
 // writes the uncompressed body to the writers.
+//
+// Note: see GunzipBodyToErr; whose error it logs.
 func (response *Response) GunzipBodyTo(writers ...io.Writer) {
+	response.GunzipBodyToErr(writers...)
+}
+
+// GunzipBodyToErr is GunzipBodyTo returning the error of the gzip
+// stream. If the stream is not gzip the raw compressed body is written
+// instead; if it fails mid-body, such as when it is truncated, what was
+// uncompressed stays written and the error is returned.
+func (response *Response) GunzipBodyToErr(writers ...io.Writer) error {
 	reader := response.copyBody()
 	if reader == nil {
-		return
+		return nil
 	}
 
 	gzread, err := gzip.NewReader(reader)
 	if err != nil {
-		log.Error(err.Error())
-		return
+		response.traced(responseLog).WithError(err).Error("Could Not Gunzip Body")
+		io.Copy(io.MultiWriter(writers...), response.copyBody())
+		return err
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), gzread); err != nil {
+		response.traced(responseLog).WithError(err).Error("Gzip Stream Failed Mid-Body")
+		return err
+	}
+
+	return nil
+}
+
+// gunzipFlushBytes is how much of the uncompressed body
+// GunzipBodyStreamTo writes between flushes.
+const gunzipFlushBytes = 32 * 1024
+
+// GunzipBodyStreamTo writes the uncompressed body to the writers as it
+// is decompressed; flushing those that are an http.Flusher periodically
+// so large bodies reach the client before the whole body is unzipped.
+//
+// Note: if the gzip stream is invalid the raw compressed body is
+// written instead; if it fails mid-body what was written stays and
+// the error is returned.
+func (response *Response) GunzipBodyStreamTo(writers ...io.Writer) error {
+	reader := response.copyBody()
+	if reader == nil {
+		return nil
+	}
+
+	gzread, err := gzip.NewReader(reader)
+	if err != nil {
+		response.traced(responseLog).WithError(err).Error("Could Not Gunzip Body")
+		io.Copy(io.MultiWriter(writers...), response.copyBody())
+		return err
+	}
+
+	var flushers []http.Flusher
+	for _, writer := range writers {
+		if flusher, ok := writer.(http.Flusher); ok {
+			flushers = append(flushers, flusher)
+		}
+	}
+
+	writer := io.MultiWriter(writers...)
+	for {
+		n, err := io.CopyN(writer, gzread, gunzipFlushBytes)
+
+		if n > 0 {
+			for _, flusher := range flushers {
+				flusher.Flush()
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			response.traced(responseLog).WithError(err).Error("Gzip Stream Failed Mid-Body")
+			return err
+		}
+	}
+}
+
+// ToHTTPResponse returns a copy of the *http.Response with a body that
+// reads the buffered body afresh; so it stays readable after WriteTo.
+// Streaming responses keep their live body, which can be read once.
+func (response *Response) ToHTTPResponse() *http.Response {
+	if response.cached {
+		response.setExpires()
+	}
+
+	httpResponse := new(http.Response)
+	*httpResponse = *response.proxied
+	httpResponse.Header = make(http.Header)
+	CopyHeaders(response.proxied.Header, httpResponse.Header)
+
+	if response.Streaming() {
+		return httpResponse
+	}
+
+	response.copyBody()
+	body := append([]byte(nil), response.body.Bytes()...)
+	httpResponse.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// A HEAD keeps the length of the body it did not get.
+	if response.requestMethod() != "HEAD" {
+		httpResponse.ContentLength = int64(len(body))
+		httpResponse.TransferEncoding = nil
 	}
 
-	io.Copy(io.MultiWriter(writers...), gzread)
+	return httpResponse
 }
 
 // WriteTo handles the caching process and writing the
 // full response body (including) headers to the writers.
 //
-// Note: WriteTo also handle *http.ResponseWriter
+// Note: WriteTo also handle *http.ResponseWriter; a buffered
+// body stays readable afterwards, as its buffer is still held.
 func (response *Response) WriteTo(writers ...interface{}) {
+	var cacheFile *os.File
+	var cacheLater bool
+
+	if response.proxy.sniffType {
+		response.sniffContentType()
+	}
+
+	// Cached bodies were rewritten before they were stored.
+	if len(response.proxy.rewriters) > 0 && !response.cached {
+		response.rewriteBody()
+	}
+
+	if !response.streamed {
+		response.streamed = response.streams()
+	}
 
 	// Don't overwrite if the Reponse is from cache.
 	if response.cached {
+		response.setExpires()
+		goto WriteIt
+	}
+
+	// Stored by the request whose fetch it shares.
+	if response.coalesced {
+		response.traced(cacheLog).Debug("Not Caching Coalesced Response")
+		goto WriteIt
+	}
+
+	// Errors are not the resource.
+	if response.err != nil {
+		response.traced(cacheLog).WithError(response.err).Debug("Not Caching Error")
+		goto WriteIt
+	}
+
+	// Only responses to the cacheable methods; and other than for GET
+	// only when the origin declares how long they are fresh.
+	if method := response.requestMethod(); !response.proxy.cacheableMethod(method) {
+		response.traced(cacheLog).WithFields(Fields{"method": method}).Debug("Not Caching Method")
+		goto WriteIt
+	} else if _, explicit := response.freshnessLifetime(); method != "GET" &&
+		!explicit && response.GetHeader("Expires") == "" {
+		response.traced(cacheLog).WithFields(Fields{"method": method}).Debug("Not Caching Without Freshness")
+		goto WriteIt
+	}
+
+	if response.bodyOverLimit {
+		response.traced(cacheLog).Debug("Not Caching Request Body Over Limit")
+		goto WriteIt
+	}
+
+	// Streams have no end to cache.
+	if response.Streaming() {
+		response.traced(cacheLog).Debug("Not Caching Stream")
+		goto WriteIt
+	}
+
+	// Partial Content is only a slice of the resource.
+	if response.proxied.StatusCode == http.StatusPartialContent {
+		response.traced(cacheLog).WithFields(Fields{"status": 206}).Debug("Not Caching Partial Content")
 		goto WriteIt
 	}
 
-	// Cache-Control, do not cache if present
+	// Cache-Control, do not cache if present; a private
+	// cache may keep the responses for a single user.
 	for _, key := range []string{"private", "no-cache", "no-store"} {
+		if key == "private" && response.proxy.privateCache {
+			continue
+		}
+
 		if _, yes := response.HasHeaderValue("Cache-Control", key); yes {
-			log.Debug("Cache-Control: has %s", key)
+			response.traced(cacheLog).WithFields(Fields{"directive": key}).Debug("Not Caching Cache-Control")
 			goto WriteIt
 		}
 	}
 
+	// Vary: *, the response varies on more than the request.
+	if _, yes := response.HasHeaderValue("Vary", "*"); yes {
+		response.traced(cacheLog).WithFields(Fields{"vary": "*"}).Debug("Not Caching Vary")
+		goto WriteIt
+	}
+
 	// @TODO: Need to figure out where
 	// Vary: Accept-Enacoding, User-Agent, etc... fit in.
 
 	// Pragma, do not cache if present (backwards compatability)
 	if _, yes := response.HasHeaderValue("Pragma", "no-cache"); yes {
-		log.Debug("Pragma: has no-cache")
+		response.traced(cacheLog).WithFields(Fields{"directive": "no-cache"}).Debug("Not Caching Pragma")
+		goto WriteIt
+	}
+
+	// An echoed unkeyed header would be served to every request.
+	if response.proxy.poisonGuard {
+		if header, yes := response.proxy.reflectedHeader(
+			response.proxied.Request, response.proxied.Header,
+		); yes {
+			response.traced(cacheLog).WithFields(Fields{"header": header}).Warning("Not Caching Reflected Header")
+			goto WriteIt
+		}
+	}
+
+	// A directory of other entries already has the name.
+	if info, err := os.Stat(response.cacheName); err == nil && info.IsDir() {
+		response.traced(cacheLog).WithFields(Fields{"name": response.cacheName}).Warning("Cache Name is a Directory")
 		goto WriteIt
 	}
 
 	// Ensure the cache file path exists.
-	if os.MkdirAll(filepath.Dir(response.cacheName), 0700) != nil {
-		log.Error("Cache Directory is not writeable!\n")
+	if err := os.MkdirAll(filepath.Dir(response.cacheName), 0700); err != nil {
+		response.traced(cacheLog).WithFields(Fields{"name": response.cacheName}).WithError(err).Error("Cache Directory is not writeable!")
+		goto WriteIt
+	}
+
+	// A body cut short upstream is not the resource; a
+	// streamed body is only known to be whole once it is read.
+	if !response.streamed {
+		response.copyBody()
+	}
+
+	if response.err != nil {
+		response.traced(cacheLog).WithError(response.err).Warning("Not Caching Incomplete Body")
+		goto WriteIt
+	}
+
+	// Cached once the client is served; off its path.
+	if response.proxy.asyncCache && !response.streamed {
+		cacheLater = true
 		goto WriteIt
 	}
 
 	// Ok, the checks passed; go ahead and cache the content.
-	if file, err := os.Create(response.cacheName); err == nil {
-		log.Debug("Preparing Cache Writer")
-		writers = append(writers, file)
+	if file, err := createCacheFile(response.cacheName); err == nil {
+		response.traced(cacheLog).WithFields(Fields{"name": response.cacheName}).Debug("Preparing Cache Writer")
+		cacheFile = file
 	}
 
 WriteIt:
+	// The tees and the cache read along with the writers.
+	if response.streamed {
+		done := response.streamCache(cacheFile)
+		response.writeTo(writers...)
+		done()
+		return
+	}
+
+	// Keep the body readable for the tees.
+	if len(response.tees) > 0 && !response.Streaming() {
+		response.copyBody()
+	}
+
 	response.writeTo(writers...)
+
+	// Tees not yet written to by a http.ResponseWriter.
+	if len(response.tees) > 0 {
+		response.WriteBodyTo()
+	}
+
+	if cacheLater {
+		response.writeCacheAsync()
+		return
+	}
+
+	if cacheFile != nil {
+		response.writeCache(cacheFile)
+	}
+
+	// Read afresh by the caller; as ToHTTPResponse is.
+	if response.body != nil {
+		response.copyBody()
+	}
+}
+
+// serve is WriteTo for the proxy's own callers, which are done with
+// the response once it is written; its buffer goes back to BodyBuffers.
+func (response *Response) serve(writers ...interface{}) {
+	response.WriteTo(writers...)
+	response.release()
+}
+
+// writeCacheAsync writes a copy of the response to the cache in a
+// goroutine; once for concurrent writes of the same name. The copy
+// has a buffer of its own, which it releases when it is written.
+func (response *Response) writeCacheAsync() {
+	cached := *response
+	proxied := *response.proxied
+	cached.proxied, cached.tees = &proxied, nil
+
+	response.copyBody()
+	cached.body = BodyBuffers.Get()
+	cached.body.Write(response.body.Bytes())
+
+	go func() {
+		defer cached.release()
+
+		response.proxy.cacheWrites.Do(cached.cacheName, func() *Response {
+			file, err := createCacheFile(cached.cacheName)
+			if err != nil {
+				cached.traced(cacheLog).WithFields(Fields{"name": cached.cacheName}).WithError(err).Error("Could Not Create Cache")
+				return nil
+			}
+
+			cached.traced(cacheLog).WithFields(Fields{"name": cached.cacheName}).Debug("Writing Cache Asynchronously")
+			cached.writeCache(file)
+			return nil
+		})
+	}()
+}
+
+// sniffContentType sets a missing Content-Type from the first 512
+// bytes of the body; encoded bodies can't be told apart this way.
+func (response *Response) sniffContentType() {
+	if response.GetHeader("Content-Type") != "" ||
+		response.GetHeader("Content-Encoding") != "" {
+		return
+	}
+
+	response.copyBody()
+	sniffed := response.body.Bytes()
+	if len(sniffed) == 0 {
+		return
+	}
+
+	if len(sniffed) > 512 {
+		sniffed = sniffed[:512]
+	}
+
+	contentType := http.DetectContentType(sniffed)
+	response.traced(responseLog).WithFields(Fields{"content-type": contentType}).Debug("Sniffed Content-Type")
+	response.proxied.Header.Set("Content-Type", contentType)
+}
+
+// writeCache writes the buffered response to the cache
+// file using the headers returned by cacheHeader.
+func (response *Response) writeCache(file *os.File) {
+	response.copyBody()
+
+	// Stored by its length rather than chunked; so ranges can seek it.
+	stored := *response.proxied
+	stored.Header = response.cacheHeader()
+	if response.requestMethod() != "HEAD" {
+		stored.ContentLength = int64(response.body.Len())
+		stored.TransferEncoding = nil
+		response.sum = bodySum(response.body.Bytes())
+
+		if response.proxy.dedupeBodies {
+			if err := response.storeBody(&stored); err != nil {
+				response.storeCache(file, err)
+				return
+			}
+		}
+	}
+
+	response.storeCache(file, response.writeCacheFile(file, &stored))
+}
+
+// writeCacheFile writes the response to the cache
+// file; gzipped when CompressCacheFiles is set.
+func (response *Response) writeCacheFile(
+	file *os.File, httpResponse *http.Response,
+) (err error) {
+	if !response.proxy.compressCache || !response.compressible(httpResponse.Header) {
+		return httpResponse.Write(file)
+	}
+
+	gzwrite := gzip.NewWriter(file)
+	err = httpResponse.Write(gzwrite)
+
+	if closeErr := gzwrite.Close(); err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+// compressible reports if the body is worth gzipping into the cache file
+// by the header it is stored with; not when it is encoded or of a
+// CompressCacheExcept type. The header is the copy being written, as
+// a streamed body is cached while the response is still being served.
+func (response *Response) compressible(header http.Header) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" &&
+		!strings.EqualFold(encoding, "identity") {
+		return false
+	}
+
+	except := response.proxy.compressExcept
+	if except == nil {
+		except = DefaultCompressCacheExcept
+	}
+
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, prefix := range except {
+		if strings.HasPrefix(contentType, strings.TrimSuffix(strings.ToLower(prefix), "*")) {
+			response.traced(cacheLog).WithFields(Fields{
+				"content-type": contentType,
+			}).Debug("Not Compressing Cache File")
+			return false
+		}
+	}
+
+	return true
+}
+
+// storeCache closes the cache file written with err; removing
+// it if the write failed, else recording the cache entry.
+func (response *Response) storeCache(file *os.File, err error) {
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), response.cacheName)
+	}
+
+	// A partial cache file would be served as the whole response.
+	if err != nil {
+		response.traced(cacheLog).WithError(err).Error("Could Not Write Cache")
+		response.setErr(err)
+		response.proxy.events.failed(response.cacheName, err)
+
+		if err := os.Remove(file.Name()); err != nil && !os.IsNotExist(err) {
+			response.traced(cacheLog).WithError(err).Error("Could Not Remove Partial Cache")
+		}
+
+		if index := response.proxy.index; index != nil {
+			index.Remove(response.cacheName)
+
+			// The body stored for it may be referenced by nothing else.
+			if response.storedBody != "" {
+				index.release(response.cachePath, response.storedBody)
+			}
+		}
+
+		return
+	}
+
+	response.writeMeta()
+
+	info, err := os.Stat(response.cacheName)
+	if err != nil {
+		response.traced(cacheLog).WithError(err).Error("Could Not Stat Cache")
+		return
+	}
+
+	response.proxy.events.cacheStored(response.cacheName, info.Size())
+
+	if index := response.proxy.index; index != nil {
+		released := index.Add(&CacheEntry{
+			Name:     response.cacheName,
+			Size:     info.Size(),
+			StoredAt: info.ModTime(),
+			body:     response.storedBody,
+		})
+
+		if released != "" {
+			index.release(response.cachePath, released)
+		}
+
+		response.proxy.evictCache()
+	}
+}
+
+// writeMeta stores the request the cached response is named by under
+// the cache meta directory; so its name can be recomputed by
+// MigrateCache, and hits checked against collisions.
+func (response *Response) writeMeta() {
+	httpRequest := response.namedBy
+	if httpRequest == nil {
+		httpRequest = response.proxied.Request
+	}
+
+	if httpRequest == nil || response.cachePath == "" {
+		return
+	}
+
+	name, ok := metaName(response.cachePath, response.cacheName)
+	if !ok {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		response.traced(cacheLog).WithFields(Fields{"name": name}).WithError(err).Error("Cache Meta Directory is not writeable!")
+		return
+	}
+
+	// Readable by the proxy alone; as are the cache files.
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		response.traced(cacheLog).WithFields(Fields{"name": name}).WithError(err).Error("Could Not Write Cache Meta")
+		return
+	}
+
+	defer file.Close()
+
+	// Stored as it was named; bodiless and without the Range, or
+	// the credentials, which are never logged or echoed either.
+	stored := *httpRequest
+	stored.Body, stored.ContentLength = nil, 0
+	stored.Header = make(http.Header)
+	CopyHeaders(httpRequest.Header, stored.Header)
+	stored.Header.Del("Range")
+	stored.Header.Del("If-Range")
+
+	for header := range credentialHeaders {
+		stored.Header.Del(header)
+	}
+
+	meta := newCacheMetadata(&stored)
+	meta.Body = response.capture.Bytes()
+	meta.Sum = response.sum
+	meta.FreshUntil, meta.RetainUntil = response.deadlines(time.Now())
+
+	if err := response.proxy.metadataCodec().Encode(file, meta); err != nil {
+		response.traced(cacheLog).WithError(err).Error("Could Not Write Cache Meta")
+	}
+}
+
+// deadlines returns when the response stored at storedAt stops being
+// fresh, if it has a lifetime, and when UseRetentionTTL deletes it.
+func (response *Response) deadlines(storedAt time.Time) (fresh, retain time.Time) {
+	if lifetime, yes := response.freshnessLifetime(); yes {
+		if age, known := response.currentAge(); known {
+			fresh = storedAt.Add(lifetime - age)
+		}
+	}
+
+	if ttl := response.proxy.retentionTTL(); ttl > 0 {
+		retain = storedAt.Add(ttl)
+	}
+
+	return fresh, retain
+}
+
+// cacheHeader returns a copy of the response headers
+// with those unfit to be shared between clients removed.
+func (response *Response) cacheHeader() http.Header {
+	header := make(http.Header)
+	CopyHeaders(response.proxied.Header, header)
+
+	if response.proxy.addContentSHA1 {
+		header.Set("Content-SHA1", response.contentSHA1())
+	}
+
+	if !response.proxy.keepSetCookie {
+		response.traced(cacheLog).Debug("Removing Set-Cookie From Cache")
+		header.Del("Set-Cookie")
+	}
+
+	// Only storeBody references a stored body; never the origin.
+	header.Del(cacheBodyHeader)
+
+	return header
+}
+
+// setExpires updates the Expires header of a cached response
+// to when its age reaches its freshness lifetime.
+func (response *Response) setExpires() {
+	if response.storedAt.IsZero() {
+		return
+	}
+
+	if lifetime, yes := response.freshnessLifetime(); yes {
+		age, _ := response.currentAge()
+		expires := time.Now().Add(lifetime - age).UTC().Format(http.TimeFormat)
+		response.traced(cacheLog).WithFields(Fields{"expires": expires}).Debug("Setting Expires")
+		response.proxied.Header.Set("Expires", expires)
+	}
 }
 
 func (response *Response) writeTo(writers ...interface{}) {
 	var ioWriters []io.Writer
 
+	// Served with the proxy in the Via chain, the ID of the request, the
+	// Server-Timing and Age, and without the custom TTL; but cached as it was.
+	name, id, ttl := response.proxy.viaName, response.requestID, response.proxy.customTTLHeader
+	timing, age := response.serverTiming(), response.servedAge()
+	if name != "" || id != "" || ttl != "" || timing != "" || age != "" {
+		header := response.proxied.Header
+		response.proxied.Header = make(http.Header)
+		CopyHeaders(header, response.proxied.Header)
+
+		if name != "" {
+			appendVia(
+				response.proxied.Header,
+				response.proxied.ProtoMajor, response.proxied.ProtoMinor, name,
+			)
+		}
+
+		if id != "" {
+			response.proxied.Header.Set(response.proxy.requestIDHeader, id)
+		}
+
+		if ttl != "" {
+			response.proxied.Header.Del(ttl)
+		}
+
+		if timing != "" {
+			response.proxied.Header.Add("Server-Timing", timing)
+		}
+
+		if age != "" {
+			response.proxied.Header.Set("Age", age)
+		}
+
+		defer func() { response.proxied.Header = header }()
+	}
+
 	// NO, NO, NO: I need io.Writers ;)
 	for _, writer := range writers {
 		switch writer := writer.(type) {
 		case http.ResponseWriter:
 			// Also http.ResponseWriter won't validate as an io.Writer
-			CopyHeaders(writer.Header(), response.proxied.Header)
+			ReplaceHeaders(response.proxied.Header, writer.Header())
 			writer.WriteHeader(response.proxied.StatusCode)
+
+			if response.Streaming() {
+				response.streamBodyTo(writer)
+				continue
+			}
+
+			if response.streamed {
+				response.streamTo(writer)
+				continue
+			}
+
 			response.WriteBodyTo(io.Writer(writer))
 		case io.PipeWriter:
+			if response.streamed {
+				response.streamTo(&writer)
+				continue
+			}
+
 			response.WriteBodyTo(io.Writer(&writer))
 		case io.Writer:
 			ioWriters = append(ioWriters, writer)
@@ -295,20 +1292,80 @@ func (response *Response) writeTo(writers ...interface{}) {
 
 	// Write to everything at once; since the response
 	// is a ReadCloser we only get one shot. xD
-	response.proxied.Write(io.MultiWriter(ioWriters...))
+	if len(ioWriters) == 0 {
+		return
+	}
+
+	if err := response.proxied.Write(io.MultiWriter(ioWriters...)); err != nil {
+		response.traced(responseLog).WithError(err).Error("Could Not Write Response")
+		response.setErr(err)
+	}
+}
+
+// streamBodyTo copies the body to the writer as it is read; flushing
+// after every read so each event reaches the client right away.
+func (response *Response) streamBodyTo(writer http.ResponseWriter) {
+	flusher, _ := writer.(http.Flusher)
+
+	writers := append([]io.Writer{writer}, response.tees...)
+	response.tees = nil
+
+	defer response.proxied.Body.Close()
+
+	buffer := make([]byte, 4096)
+	for {
+		n, err := response.proxied.Body.Read(buffer)
+
+		if n > 0 {
+			if _, err := io.MultiWriter(writers...).Write(buffer[:n]); err != nil {
+				response.traced(responseLog).WithError(err).Error("Could Not Write Stream")
+				response.setErr(err)
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if err == io.EOF {
+			return
+		}
+
+		if err != nil {
+			response.traced(responseLog).WithError(err).Error("Could Not Read Stream")
+			response.setErr(err)
+			return
+		}
+	}
 }
 
 func (response *Response) copyBody() (reader io.ReadCloser) {
-	var buf bytes.Buffer
-	var err error
+	if response.body == nil {
+		response.body = BodyBuffers.Get()
 
-	_, err = buf.ReadFrom(response.proxied.Body)
-	err = response.proxied.Body.Close()
+		if _, err := response.body.ReadFrom(response.proxied.Body); err != nil {
+			response.traced(responseLog).WithError(err).Error("Could Not Read Body")
+			response.setErr(err)
+		}
 
-	if err != nil {
-		log.Error(err.Error())
+		if err := response.proxied.Body.Close(); err != nil {
+			response.traced(responseLog).WithError(err).Error("Could Not Close Body")
+		}
+	}
+
+	response.proxied.Body = ioutil.NopCloser(bytes.NewReader(response.body.Bytes()))
+	return ioutil.NopCloser(bytes.NewReader(response.body.Bytes()))
+}
+
+// release hands the buffered body back to BodyBuffers; the
+// readers returned by copyBody alias it and must be done with.
+func (response *Response) release() {
+	if response.body == nil {
+		return
 	}
 
-	response.proxied.Body = ioutil.NopCloser(&buf)
-	return ioutil.NopCloser(bytes.NewReader(buf.Bytes()))
+	response.proxied.Body = http.NoBody
+	BodyBuffers.Put(response.body)
+	response.body = nil
 }
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// maxRetentionSweep is the longest the retention sweep waits between runs.
+const maxRetentionSweep = time.Minute
+
+// retention is the UseRetentionTTL of the cache entries; the sweep
+// deleting them runs in the background while the TTL is set.
+type retention struct {
+	mutex    sync.Mutex
+	ttl      time.Duration
+	sweeping bool
+}
+
+// UseRetentionTTL sets how long cache entries are kept after they are
+// stored; regardless of their freshness or of being accessed since.
+// Older entries are deleted by a sweep in the background (see
+// SweepCache) and never served. Pinned entries are kept. Zero, the
+// default, keeps entries until they are evicted or replaced.
+//
+// Note: the deadline is the RetainUntil of the CacheMetadata, set as
+// the entry is stored; entries stored without one are kept the TTL
+// from when their cache file was written. Changing the TTL does not
+// move the deadlines already stored, so lowering it only shortens the
+// retention of entries stored after.
+func (proxy *Proxy) UseRetentionTTL(ttl time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.retention.mutex.Lock()
+	defer proxy.retention.mutex.Unlock()
+
+	proxy.retention.ttl = ttl
+	if ttl > 0 && !proxy.retention.sweeping {
+		proxy.retention.sweeping = true
+		go proxy.sweepRetention()
+	}
+
+	return proxy
+}
+
+func (proxy *Proxy) retentionTTL() time.Duration {
+	proxy.retention.mutex.Lock()
+	defer proxy.retention.mutex.Unlock()
+
+	return proxy.retention.ttl
+}
+
+// retained reports if an entry, written at storedAt, is within
+// UseRetentionTTL; by the RetainUntil of its metadata, if it has one.
+func (proxy *Proxy) retained(meta *CacheMetadata, storedAt time.Time) bool {
+	ttl := proxy.retentionTTL()
+	if ttl <= 0 {
+		return true
+	}
+
+	if meta != nil && !meta.RetainUntil.IsZero() {
+		return time.Now().Before(meta.RetainUntil)
+	}
+
+	return time.Since(storedAt) < ttl
+}
+
+// sweepRetention runs SweepCache every half of the
+// UseRetentionTTL; until the TTL is unset.
+func (proxy *Proxy) sweepRetention() {
+	for {
+		proxy.retention.mutex.Lock()
+		ttl := proxy.retention.ttl
+		if ttl <= 0 {
+			proxy.retention.sweeping = false
+			proxy.retention.mutex.Unlock()
+			return
+		}
+
+		proxy.retention.mutex.Unlock()
+
+		interval := ttl / 2
+		if interval > maxRetentionSweep {
+			interval = maxRetentionSweep
+		}
+
+		time.Sleep(interval)
+		proxy.SweepCache()
+	}
+}
+
+// SweepCache deletes the cache entries past their UseRetentionTTL
+// deadline; returning how many were. Pinned entries are kept.
+func (proxy *Proxy) SweepCache() (swept int) {
+	proxy = proxy.snapshot()
+
+	if proxy.index == nil || proxy.retentionTTL() <= 0 {
+		return
+	}
+
+	proxy.index.load(cacheRoot(proxy.cachePath))
+	for _, entry := range proxy.index.Entries() {
+		if proxy.retained(proxy.entryMeta(cacheRoot(proxy.cachePath), entry.Name), entry.StoredAt) || proxy.pinned(entry.Name) {
+			continue
+		}
+
+		cacheLog.WithFields(Fields{"name": entry.Name}).Debug("Sweeping Cache Entry Past Retention")
+		if err := proxy.removeCacheEntry(entry.Name); err != nil && !os.IsNotExist(err) {
+			cacheLog.WithError(err).Error("Could Not Sweep Cache Entry")
+			continue
+		}
+
+		proxy.events.cacheEvicted(entry.Name)
+		swept++
+	}
+
+	return
+}
+
+// removeCacheEntry deletes the named cache file, the request stored
+// with it, its entry in the index and the body only it referenced.
+func (proxy *Proxy) removeCacheEntry(name string) error {
+	root := cacheRoot(proxy.cachePath)
+
+	var released string
+	if proxy.index != nil {
+		released = proxy.index.Remove(name)
+	}
+
+	if meta, ok := metaName(root, name); ok {
+		os.Remove(meta)
+	}
+
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+
+	if released != "" {
+		proxy.index.release(root, released)
+	}
+
+	return nil
+}
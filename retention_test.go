@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetentionSweep(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseRetentionTTL(200 * time.Millisecond)
+	defer proxy.UseRetentionTTL(0)
+
+	// Accessed until shortly before; which doesn't keep it from the sweep.
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+		readBody(t, get(proxy, origin.URL+"/a"))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want the entry served until swept", fetches.Load())
+	}
+
+	waitFor(t, "the sweep past retention", func() bool { return len(entryFiles(t, root)) == 0 })
+
+	if metas := cacheFiles(t, root); len(metas) != 0 {
+		t.Errorf("cache files = %q; want the meta swept too", metas)
+	}
+}
+
+func TestRetentionDeadlineStored(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseRetentionTTL(time.Hour)
+	defer proxy.UseRetentionTTL(0)
+
+	stored := time.Now()
+	readBody(t, get(proxy, origin.URL+"/a"))
+	name := entryFiles(t, root)[0]
+
+	meta, err := proxy.ReadCacheMetadata(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := meta.RetainUntil.Sub(stored); until < time.Hour-time.Minute || until > time.Hour+time.Minute {
+		t.Errorf("RetainUntil = %v; want an hour after storing", meta.RetainUntil)
+	}
+	if until := meta.FreshUntil.Sub(stored); until < 59*time.Second || until > 61*time.Second {
+		t.Errorf("FreshUntil = %v; want the max-age=60 after storing", meta.FreshUntil)
+	}
+
+	// Written long ago by its file, as a restarted proxy finds it;
+	// the deadline it was stored with holds.
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	proxy = NewProxy().UseCachePath(root).UseRetentionTTL(time.Hour)
+	defer proxy.UseRetentionTTL(0)
+	if swept := proxy.SweepCache(); swept != 0 {
+		t.Errorf("swept %d entries by their mtime; want none before their deadline", swept)
+	}
+
+	// Past the deadline it is stored with; swept.
+	meta.RetainUntil = time.Now().Add(-time.Second)
+	metaPath, _ := metaName(root, name)
+	file, err := os.Create(metaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	HTTPMetadataCodec.Encode(file, meta)
+	file.Close()
+
+	if swept := proxy.SweepCache(); swept != 1 || len(entryFiles(t, root)) != 0 {
+		t.Errorf("swept %d entries; want the one past its deadline", swept)
+	}
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// connectionRetry holds the UseConnectionRetry settings.
+type connectionRetry struct {
+	max     int
+	base    time.Duration
+	methods map[string]bool
+}
+
+// UseConnectionRetry retries round trips failing to connect or reset
+// by the origin up to max times; waiting base, then doubling it, with
+// jitter in between. Only GET and HEAD requests are retried unless
+// methods are given; those with a body need GetBody to rewind it.
+// HTTP error statuses are responses, so they are never retried.
+func (proxy *Proxy) UseConnectionRetry(
+	max int, base time.Duration, methods ...string,
+) *Proxy {
+	defer proxy.configure()()
+	if max <= 0 {
+		proxy.retry = nil
+		return proxy
+	}
+
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD"}
+	}
+
+	proxy.retry = &connectionRetry{max, base, make(map[string]bool)}
+	for _, method := range methods {
+		proxy.retry.methods[strings.ToUpper(method)] = true
+	}
+
+	return proxy
+}
+
+// retryRoundTrip sends the request through the transport;
+// retrying connection errors as set by UseConnectionRetry.
+func (proxy *Proxy) retryRoundTrip(
+	transport http.RoundTripper, httpRequest *http.Request,
+) (*http.Response, error) {
+	httpResponse, err := proxy.limitedRoundTrip(transport, httpRequest)
+
+	retry := proxy.retry
+	if retry == nil || !retry.methods[httpRequest.Method] {
+		return httpResponse, err
+	}
+
+	for attempt := 0; attempt < retry.max && connectionError(err); attempt++ {
+		if !rewindBody(httpRequest) {
+			requestLog.Warning("Can Not Rewind Body To Retry")
+			break
+		}
+
+		wait := retry.backoff(attempt)
+		requestLog.WithError(err).WithFields(Fields{
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Warning("Retrying Round Trip")
+
+		select {
+		case <-time.After(wait):
+		case <-httpRequest.Context().Done():
+			return nil, httpRequest.Context().Err()
+		}
+
+		httpResponse, err = proxy.limitedRoundTrip(transport, httpRequest)
+	}
+
+	return httpResponse, err
+}
+
+// backoff returns the wait before the retry; base doubled each
+// attempt, with up to half of it taken off at random as jitter.
+func (retry *connectionRetry) backoff(attempt int) time.Duration {
+	wait := retry.base << uint(attempt)
+	if wait <= 0 {
+		return 0
+	}
+
+	return wait - time.Duration(rand.Int63n(int64(wait)/2+1))
+}
+
+// connectionError reports if the round trip failed to connect
+// or had the connection reset; rather than failing otherwise.
+func connectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var opError *net.OpError
+	return errors.As(err, &opError) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// rewindBody resets the request body for another round trip;
+// reporting false when it has one that can't be rewound.
+func rewindBody(httpRequest *http.Request) bool {
+	if httpRequest.Body == nil || httpRequest.Body == http.NoBody {
+		return true
+	}
+
+	if httpRequest.GetBody == nil {
+		return false
+	}
+
+	body, err := httpRequest.GetBody()
+	if err != nil {
+		requestLog.WithError(err).Error("Could Not Rewind Body")
+		return false
+	}
+
+	httpRequest.Body = body
+	return true
+}
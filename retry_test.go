@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resettingOrigin resets the connection of the first request it
+// gets; answering the others with their method and body.
+func resettingOrigin(attempts *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.(*net.TCPConn).SetLinger(0)
+			conn.Close()
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(body)))
+	}))
+}
+
+// freshTransport dials every request anew; so no retry is the transport's.
+func freshTransport() *http.Transport {
+	return &http.Transport{DisableKeepAlives: true}
+}
+
+func TestConnectionRetry(t *testing.T) {
+	var attempts atomic.Int32
+	origin := resettingOrigin(&attempts)
+	defer origin.Close()
+
+	proxy := NewProxy(freshTransport()).UseCachePath(t.TempDir()).
+		UseConnectionRetry(2, time.Millisecond)
+
+	response := get(proxy, origin.URL+"/flaky")
+	if got := readBody(t, response); response.StatusCode != http.StatusOK || got != "GET " {
+		t.Errorf("retried GET = %d %q; want 200", response.StatusCode, got)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("origin saw %d attempts; want 2", n)
+	}
+}
+
+func TestConnectionRetryOff(t *testing.T) {
+	var attempts atomic.Int32
+	origin := resettingOrigin(&attempts)
+	defer origin.Close()
+
+	response := get(NewProxy(freshTransport()).UseCachePath(t.TempDir()), origin.URL+"/flaky")
+	readBody(t, response)
+	if response.StatusCode != http.StatusBadGateway {
+		t.Errorf("status without retries = %d; want 502", response.StatusCode)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("origin saw %d attempts; want 1", n)
+	}
+}
+
+func TestConnectionRetryRewindsBody(t *testing.T) {
+	var attempts atomic.Int32
+	origin := resettingOrigin(&attempts)
+	defer origin.Close()
+
+	// POST is not retried unless asked for.
+	proxy := NewProxy(freshTransport()).UseCachePath(t.TempDir()).
+		UseConnectionRetry(2, time.Millisecond)
+	response, _ := proxy.Do("POST", origin.URL+"/flaky", strings.NewReader("payload"), nil)
+	if status := response.proxied.StatusCode; status != http.StatusBadGateway {
+		t.Errorf("POST status = %d; want 502 without retrying POST", status)
+	}
+
+	// Do gives the request a GetBody; so the body is sent again.
+	attempts.Store(0)
+	proxy.UseConnectionRetry(2, time.Millisecond, "POST")
+	response, err := proxy.Do("POST", origin.URL+"/flaky", strings.NewReader("payload"), nil)
+	if err != nil {
+		t.Fatalf("retried POST: %v", err)
+	}
+
+	var body bytes.Buffer
+	response.WriteBodyTo(&body)
+	if body.String() != "POST payload" {
+		t.Errorf("retried POST body = %q; want the body sent again", body.String())
+	}
+
+	// A body that can't be rewound is not sent again.
+	attempts.Store(0)
+	served := serve(proxy, newRequest("POST", origin.URL+"/flaky", "payload"))
+	readBody(t, served)
+	if served.StatusCode != http.StatusBadGateway || attempts.Load() != 1 {
+		t.Errorf("unrewindable POST = %d after %d attempts; want 502 after 1", served.StatusCode, attempts.Load())
+	}
+}
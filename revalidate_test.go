@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRevalidationsShareOneHead(t *testing.T) {
+	var heads atomic.Int32
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Method == "HEAD" {
+			heads.Add(1)
+			<-release
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	// Without a freshness lifetime the entry is revalidated on every hit.
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	const clients = 8
+	var wait sync.WaitGroup
+	bodies := make([]string, clients)
+	for i := 0; i < clients; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			bodies[i] = readBody(t, get(proxy, origin.URL+"/a"))
+		}(i)
+	}
+
+	// The HEAD is held until the other clients have had time to join it.
+	deadline := time.Now().Add(5 * time.Second)
+	for heads.Load() < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wait.Wait()
+
+	if n := heads.Load(); n != 1 {
+		t.Errorf("origin saw %d HEAD requests; want 1", n)
+	}
+	for i, body := range bodies {
+		if body != "hello" {
+			t.Errorf("client %d body = %q", i, body)
+		}
+	}
+}
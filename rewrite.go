@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+)
+
+// bodyRewriter rewrites the bodies of a Content-Type prefix.
+type bodyRewriter struct {
+	prefix  string
+	rewrite func([]byte) []byte
+}
+
+// UseBodyRewriter rewrites the bodies of responses whose Content-Type
+// starts with the prefix (such as "text/html"); before they are cached
+// so the rewritten body is stored. Rewriters run in the order they are
+// added; encoded and streaming bodies are never rewritten.
+func (proxy *Proxy) UseBodyRewriter(
+	prefix string, rewrite func([]byte) []byte,
+) *Proxy {
+	defer proxy.configure()()
+	proxy.rewriters = append(proxy.rewriters, bodyRewriter{
+		strings.ToLower(prefix), rewrite,
+	})
+
+	return proxy
+}
+
+// rewrites reports if a body rewriter matches the Content-Type of the
+// response; which rewriteBody then buffers the body for.
+func (response *Response) rewrites() bool {
+	contentType := strings.ToLower(response.GetHeader("Content-Type"))
+	for _, rewriter := range response.proxy.rewriters {
+		if strings.HasPrefix(contentType, rewriter.prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewriteBody runs the matching body rewriters on the buffered body;
+// dropping the checksums and weakening the ETag it no longer matches.
+func (response *Response) rewriteBody() {
+	contentType := strings.ToLower(response.GetHeader("Content-Type"))
+	encoding := response.GetHeader("Content-Encoding")
+
+	if response.Streaming() || (encoding != "" && encoding != "identity") {
+		return
+	}
+
+	rewritten := false
+	for _, rewriter := range response.proxy.rewriters {
+		if !strings.HasPrefix(contentType, rewriter.prefix) {
+			continue
+		}
+
+		response.copyBody()
+		body := rewriter.rewrite(response.body.Bytes())
+
+		response.body.Reset()
+		response.body.Write(body)
+		rewritten = true
+	}
+
+	if !rewritten {
+		return
+	}
+
+	response.traced(responseLog).WithFields(Fields{"content-type": contentType}).Debug("Rewrote Body")
+	response.copyBody()
+	response.proxied.ContentLength = int64(response.body.Len())
+	response.proxied.Header.Set("Content-Length", strconv.Itoa(response.body.Len()))
+	response.RemoveHeaders("Content-MD5", "Content-SHA1")
+
+	if etag := response.GetHeader("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		response.proxied.Header.Set("ETag", "W/"+etag)
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBodyRewriterByContentType(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<a href="http://internal/doc">doc</a>`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG http://internal/doc"))
+	}))
+	defer origin.Close()
+
+	var rewrites atomic.Int32
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseBodyRewriter("text/html", func(body []byte) []byte {
+		rewrites.Add(1)
+		return bytes.ReplaceAll(body, []byte("http://internal/"), []byte("/"))
+	})
+
+	// From the origin; then from the cache.
+	for i := 0; i < 2; i++ {
+		if got := readBody(t, get(proxy, origin.URL+"/page")); got != `<a href="/doc">doc</a>` {
+			t.Errorf("served HTML %d = %q; want the links rewritten", i, got)
+		}
+		if got := readBody(t, get(proxy, origin.URL+"/image")); got != "\x89PNG http://internal/doc" {
+			t.Errorf("served image %d = %q; want it untouched", i, got)
+		}
+	}
+
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want both served from cache the second time", n)
+	}
+	if n := rewrites.Load(); n != 1 {
+		t.Errorf("rewriter ran %d times; want once, for the HTML from the origin", n)
+	}
+
+	name := LoadRequest(newRequest("GET", origin.URL+"/page", "")).SetCachePath(root).FullCacheName()
+	cached, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("reading the cached HTML: %v", err)
+	}
+	if strings.Contains(string(cached), "http://internal/") {
+		t.Errorf("cached HTML was not rewritten: %q", cached)
+	}
+}
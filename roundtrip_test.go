@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTripStreamsLarge(t *testing.T) {
+	chunk := strings.Repeat("x", 256<<10)
+	received := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(chunk))
+		w.(http.Flusher).Flush()
+
+		// The rest only once the client has the start; it would never
+		// be sent if RoundTrip buffered the body before returning it.
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+		}
+		for i := 0; i < 7; i++ {
+			w.Write([]byte(chunk))
+		}
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseStreamThreshold(64 << 10)
+	client := &http.Client{Transport: proxy}
+
+	returned := make(chan *http.Response)
+	go func() {
+		response, err := client.Get(origin.URL + "/download")
+		if err != nil {
+			t.Errorf("GET: %v", err)
+		}
+		returned <- response
+	}()
+
+	var response *http.Response
+	select {
+	case response = <-returned:
+	case <-time.After(4 * time.Second):
+		t.Fatal("RoundTrip held the response until the whole body was read")
+	}
+	if response == nil {
+		return
+	}
+
+	start := make([]byte, len(chunk))
+	if _, err := io.ReadFull(response.Body, start); err != nil {
+		t.Fatalf("reading the start: %v", err)
+	}
+	close(received)
+
+	rest, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if len(start)+len(rest) != 8*len(chunk) {
+		t.Errorf("streamed %d bytes; want %d", len(start)+len(rest), 8*len(chunk))
+	}
+
+	waitFor(t, "the streamed body to be cached", func() bool { return len(entryFiles(t, root)) == 1 })
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamScheme(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.TLS != nil {
+			w.Write([]byte("https " + r.URL.Path))
+		}
+	}))
+	defer origin.Close()
+
+	host := strings.TrimPrefix(origin.URL, "https://")
+	proxy := NewProxy(origin.Client().Transport).UseCachePath(t.TempDir()).
+		UseUpstreamScheme("HTTPS")
+
+	// Received as http://; fetched over TLS all the same.
+	if body := readBody(t, get(proxy, "http://"+host+"/a")); body != "https /a" {
+		t.Errorf("absolute request: origin answered %q; want it over https", body)
+	}
+
+	// As received by a server, with only a Host; sent to it.
+	request := newRequest("GET", "/b", "")
+	request.Host = host
+	if body := readBody(t, serve(proxy, request)); body != "https /b" {
+		t.Errorf("server request: origin answered %q; want it over https", body)
+	}
+}
+
+func TestRequestSetScheme(t *testing.T) {
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.TLS != nil {
+			w.Write([]byte("https"))
+		}
+	}))
+	defer origin.Close()
+
+	httpRequest := newRequest("GET", "http://"+strings.TrimPrefix(origin.URL, "https://")+"/c", "")
+	response := LoadRequest(httpRequest).SetTransport(origin.Client().Transport).
+		SetCachePath(t.TempDir()).SetScheme("https").Fetch()
+
+	body := readBody(t, response.ToHTTPResponse())
+	if err := response.Err(); err != nil || body != "https" {
+		t.Errorf("origin answered %q, %v; want it over https", body, err)
+	}
+
+	if scheme := httpRequest.URL.Scheme; scheme != "http" {
+		t.Errorf("client request scheme = %q; want it left as http", scheme)
+	}
+}
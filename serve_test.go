@@ -0,0 +1,21 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServedHeadersFromOrigin(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Origin", "yes")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	response := get(NewProxy().UseCachePath(t.TempDir()), origin.URL+"/a")
+	readBody(t, response)
+	if response.Header.Get("X-Origin") != "yes" {
+		t.Errorf("origin header not served: %v", response.Header)
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestContentSHA1Revalidation(t *testing.T) {
+	var body atomic.Value
+	var fetches atomic.Int32
+	body.Store("one")
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).AddContentSHA1(true)
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	sum := sha1.Sum([]byte("one"))
+	cached := get(proxy, origin.URL+"/a")
+	if got := readBody(t, cached); got != "one" {
+		t.Fatalf("cached body = %q", got)
+	}
+	if got, want := cached.Header.Get("Content-SHA1"), base64.StdEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("Content-SHA1 = %q; want %q", got, want)
+	}
+
+	body.Store("two")
+	fetched := fetches.Load()
+	if got := readBody(t, get(proxy, origin.URL+"/a")); got != "two" {
+		t.Errorf("body after the origin changed = %q; want %q", got, "two")
+	}
+
+	// The body fetched to revalidate is the one served.
+	if n := fetches.Load() - fetched; n != 1 {
+		t.Errorf("origin fetched %d times for the changed body; want 1", n)
+	}
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCacheShardingPathAndLookup(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseCacheSharding(2)
+
+	for i := 0; i < 2; i++ {
+		if got := readBody(t, get(proxy, origin.URL+"/sharded")); got != "/sharded" {
+			t.Fatalf("body = %q; want /sharded", got)
+		}
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("origin fetched %d times; want the second served from the sharded cache", n)
+	}
+
+	files := entryFiles(t, root)
+	if len(files) != 1 {
+		t.Fatalf("cache entries = %v; want one", files)
+	}
+
+	name, _ := filepath.Rel(root, files[0])
+	sharded := regexp.MustCompile(`^([0-9a-f]{2})/([0-9a-f]{2})/([0-9a-f]{40})$`)
+	match := sharded.FindStringSubmatch(filepath.ToSlash(name))
+	if match == nil || match[3][:4] != match[1]+match[2] {
+		t.Errorf("cache entry %q is not sharded as ab/cd/abcd...", name)
+	}
+}
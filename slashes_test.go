@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestCollapseSlashes(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).CollapseSlashes(true)
+
+	// Fetched as the one path; and so named by it in the cache too.
+	for _, path := range []string{"/a//b", "/a/b", "/a/./b", "//a/c/../b"} {
+		if body := readBody(t, get(proxy, origin.URL+path)); body != "/a/b" {
+			t.Errorf("%s: origin saw %q; want /a/b", path, body)
+		}
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want the one entry shared", fetches.Load())
+	}
+
+	// A trailing slash is kept; it is another resource.
+	if body := readBody(t, get(proxy, origin.URL+"/a//b/")); body != "/a/b/" {
+		t.Errorf("origin saw %q; want /a/b/", body)
+	}
+}
+
+func TestCollapseSlashesURINames(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).
+		UseCacheNameStyle(CacheNameURI).CollapseSlashes(true)
+
+	// Each spelling is the entry of the first; not a collision with it.
+	for _, path := range []string{"/a/b", "/a//b", "//a/b", "/a/b"} {
+		if body := readBody(t, get(proxy, origin.URL+path)); body != "/a/b" {
+			t.Errorf("%s: origin saw %q; want /a/b", path, body)
+		}
+	}
+
+	if fetches.Load() != 1 {
+		t.Errorf("origin fetched %d times; want the one entry shared", fetches.Load())
+	}
+}
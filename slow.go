@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// UseSlowRequestLog sets a threshold over which the time ServeHTTP
+// takes to fetch and write a response is logged as a warning; along
+// with its URL, the upstream latency and whether it was a cache hit.
+// Zero, the default, logs none.
+func (proxy *Proxy) UseSlowRequestLog(threshold time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.slowThreshold = threshold
+	return proxy
+}
+
+// logSlowRequest warns of the response to the request when it took
+// longer than the threshold of UseSlowRequestLog to be handled.
+func (proxy *Proxy) logSlowRequest(
+	httpRequest *http.Request, response *Response, took time.Duration,
+) {
+	if proxy.slowThreshold <= 0 || took <= proxy.slowThreshold {
+		return
+	}
+
+	status := "miss"
+	if response.cached {
+		status = "hit"
+	}
+
+	uri := *httpRequest.URL
+	if uri.Host == "" {
+		uri.Host = httpRequest.Host
+	}
+
+	response.traced(proxyLog).WithFields(Fields{
+		"url":      uri.String(),
+		"duration": took,
+		"upstream": response.latency,
+		"cache":    status,
+	}).Warning("Slow Request")
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowRequestLog(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	messages, restore := captureLogs()
+	defer restore()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseSlowRequestLog(250 * time.Millisecond)
+
+	readBody(t, get(proxy, origin.URL+"/fast"))
+	if line := findLog(messages(), "Slow Request"); line != "" {
+		t.Errorf("fast request logged as slow: %q", line)
+	}
+
+	readBody(t, get(proxy, origin.URL+"/slow"))
+	line := findLog(messages(), "Slow Request")
+	if !strings.Contains(line, " url="+origin.URL+"/slow") || !strings.Contains(line, " cache=miss") {
+		t.Errorf("slow request message lacks its fields: %q", line)
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+// defaultProxy returns a Proxy of the default settings; for NewProxy
+// and the Requests and Responses loaded without one.
+func defaultProxy() *Proxy {
+	proxy := &Proxy{
+		proxyConfig: &proxyConfig{
+			built:  new(builtTransport),
+			events: cacheEvents{eventStream: new(eventStream)},
+		},
+		proxyState: new(proxyState),
+	}
+
+	proxy.config.Store(proxy.proxyConfig)
+	return proxy
+}
+
+// ready gives a zero Proxy, one not made by NewProxy, the settings
+// and state of defaultProxy; once, on its first use.
+func (proxy *Proxy) ready() {
+	proxy.zero.Do(func() {
+		if proxy.proxyState == nil {
+			ready := defaultProxy()
+			proxy.proxyConfig, proxy.proxyState = ready.proxyConfig, ready.proxyState
+		}
+	})
+}
+
+// configure readies a copy of the settings of the Proxy for a setter to
+// change, as in "defer proxy.configure()()"; it is published when the
+// returned func is called. Requests already being served keep to the
+// settings they started with; so the setters are safe while serving.
+func (proxy *Proxy) configure() (publish func()) {
+	proxy.ready()
+	proxy.configMutex.Lock()
+	proxy.proxyConfig = proxy.config.Load().clone()
+
+	return func() {
+		proxy.config.Store(proxy.proxyConfig)
+		proxy.configMutex.Unlock()
+	}
+}
+
+// snapshot returns the Proxy by the settings last published; which
+// stay as they are while it serves a request, whatever is set since.
+// It shares everything else, like the cache index, with the Proxy.
+func (proxy *Proxy) snapshot() *Proxy {
+	proxy.ready()
+	return &Proxy{proxyConfig: proxy.config.Load(), proxyState: proxy.proxyState}
+}
+
+// clone returns a copy of the settings; with their own maps, as the
+// setters add to those in place. Slices are only ever appended to.
+func (config *proxyConfig) clone() *proxyConfig {
+	clone := *config
+
+	if config.cacheableMethods != nil {
+		clone.cacheableMethods = make(map[string]bool, len(config.cacheableMethods))
+		for method, yes := range config.cacheableMethods {
+			clone.cacheableMethods[method] = yes
+		}
+	}
+
+	if config.unixSockets != nil {
+		clone.unixSockets = make(map[string]string, len(config.unixSockets))
+		for host, socket := range config.unixSockets {
+			clone.unixSockets[host] = socket
+		}
+	}
+
+	return &clone
+}
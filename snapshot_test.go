@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run with -race; the setters change the settings while they serve.
+func TestSettersWhileServing(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+
+	stop := make(chan struct{})
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				url := fmt.Sprintf("%s/%d/%d", origin.URL, i, n%5)
+				recorder := httptest.NewRecorder()
+				proxy.ServeHTTP(recorder, newRequest("GET", url, ""))
+				if recorder.Code != http.StatusOK {
+					t.Errorf("%s: status = %d; want 200", url, recorder.Code)
+				}
+
+				if response, err := proxy.RoundTrip(newRequest("GET", url, "")); err == nil {
+					response.Body.Close()
+				}
+			}
+		}(i)
+	}
+
+	for n := 0; n < 100; n++ {
+		proxy.UseViaName(fmt.Sprint("proxy-", n)).
+			UseServerTiming(n%2 == 0).
+			UseMaxTTL(time.Duration(n)*time.Second).
+			UseTTLByContentType(map[string]time.Duration{"text/": time.Minute}).
+			UseUnixSocket(fmt.Sprint("host-", n), "/nonexistent").
+			CacheKeyHeaders("Accept").
+			UseCacheableMethods("GET", "HEAD").
+			UseMaxCacheEntries(100).
+			UseTransportMiddleware(func(next http.RoundTripper) http.RoundTripper { return next }).
+			OnCacheHit(func(string) {}).
+			UseStreamThreshold(int64(n % 3))
+
+		proxy.DumpConfig()
+		proxy.Stats()
+		time.Sleep(time.Millisecond)
+	}
+
+	close(stop)
+	wait.Wait()
+}
+
+func TestZeroProxy(t *testing.T) {
+	origin := cacheOrigin(nil)
+	defer origin.Close()
+
+	// Served without NewProxy; whether it is first set or first used.
+	// Those without a UseCachePath cache under the working directory.
+	t.Chdir(t.TempDir())
+	for name, proxy := range map[string]*Proxy{
+		"zero":       {},
+		"new":        new(Proxy),
+		"configured": new(Proxy).UseCachePath(t.TempDir()),
+	} {
+		if got := readBody(t, get(proxy, origin.URL+"/zero")); got != "/zero" {
+			t.Errorf("%s Proxy served %q; want /zero", name, got)
+		}
+
+		proxy.HitRatio(time.Minute)
+		proxy.AbortedWrites()
+		proxy.Stats()
+	}
+}
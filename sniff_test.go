@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSniffContentType(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keep the server from detecting it itself.
+		w.Header()["Content-Type"] = nil
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("<!DOCTYPE html><html><body>hi</body></html>"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).SniffContentType(true)
+
+	// Once from the origin; then from the cache.
+	for _, from := range []string{"origin", "cache"} {
+		response := get(proxy, origin.URL+"/page")
+		readBody(t, response)
+
+		if got := response.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+			t.Errorf("Content-Type from %s = %q; want text/html", from, got)
+		}
+	}
+}
+
+func TestSniffContentTypeOff(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = nil
+		w.Write([]byte("<html></html>"))
+	}))
+	defer origin.Close()
+
+	response := get(NewProxy().UseCachePath(t.TempDir()), origin.URL+"/page")
+	readBody(t, response)
+
+	if got := response.Header.Get("Content-Type"); got != "" {
+		t.Errorf("Content-Type = %q; want none without SniffContentType", got)
+	}
+}
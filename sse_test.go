@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerSentEventsArriveIncrementally(t *testing.T) {
+	next := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+
+			// The next event only once the client has this one.
+			select {
+			case <-next:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer origin.Close()
+
+	response, err := proxyClient(t, NewProxy().UseCachePath(t.TempDir())).Get(origin.URL + "/events")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer response.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines <- line
+			}
+		}
+	}()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case line := <-lines:
+			if want := fmt.Sprintf("data: %d", i); line != want {
+				t.Fatalf("event %d = %q; want %q", i, line, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d was not delivered before the next was sent", i)
+		}
+
+		next <- struct{}{}
+	}
+}
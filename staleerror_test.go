@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingOrigin answers with the headers and no explicit lifetime, so
+// each hit is revalidated, until failing is set; then every request,
+// the revalidating HEAD too, fails with 500.
+func failingOrigin(failing *atomic.Bool, header http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+
+		CopyHeaders(header, w.Header())
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("stale body"))
+	}))
+}
+
+func TestStaleServedOnFailedRevalidation(t *testing.T) {
+	var failing atomic.Bool
+	origin := failingOrigin(&failing, nil)
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/s"))
+
+	failing.Store(true)
+	response := get(proxy, origin.URL+"/s")
+	if got := readBody(t, response); response.StatusCode != http.StatusOK || got != "stale body" {
+		t.Errorf("after a failed revalidation = %d %q; want the stale body", response.StatusCode, got)
+	}
+	if got := response.Header.Get("Warning"); !strings.HasPrefix(got, "111 ") {
+		t.Errorf("Warning = %q; want 111 Revalidation Failed", got)
+	}
+}
+
+func TestStaleNotServedWhenMustRevalidate(t *testing.T) {
+	var failing atomic.Bool
+	origin := failingOrigin(&failing, http.Header{"Cache-Control": {"must-revalidate"}})
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir())
+	readBody(t, get(proxy, origin.URL+"/s"))
+
+	failing.Store(true)
+	response := get(proxy, origin.URL+"/s")
+	readBody(t, response)
+	if response.StatusCode != http.StatusInternalServerError {
+		t.Errorf("must-revalidate after a failed revalidation = %d; want the origin's 500", response.StatusCode)
+	}
+}
+
+func TestStaleOnErrorBound(t *testing.T) {
+	// Fresh for 10s by its Last-Modified; 90s stale by its Date.
+	var failing atomic.Bool
+	origin := failingOrigin(&failing, http.Header{
+		"Date":          {time.Now().Add(-100 * time.Second).UTC().Format(http.TimeFormat)},
+		"Last-Modified": {time.Now().Add(-200 * time.Second).UTC().Format(http.TimeFormat)},
+	})
+	defer origin.Close()
+
+	for max, want := range map[time.Duration]int{
+		time.Minute: http.StatusInternalServerError,
+		time.Hour:   http.StatusOK,
+	} {
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseStaleOnError(max)
+
+		failing.Store(false)
+		readBody(t, get(proxy, origin.URL+"/s"))
+
+		failing.Store(true)
+		response := get(proxy, origin.URL+"/s")
+		readBody(t, response)
+		if response.StatusCode != want {
+			t.Errorf("90s stale under UseStaleOnError(%v) = %d; want %d", max, response.StatusCode, want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package proxy
+
+// Stats are counters of the work the Proxy was spared.
+type Stats struct {
+	// Coalesced counts the requests that joined an in-flight fetch
+	// instead of starting their own; the revalidations of the same
+	// cache entry, its misses under CoalesceMisses and requests
+	// sharing an UseIdempotencyKey.
+	Coalesced int64
+}
+
+// Stats returns the counters of the Proxy since it was created.
+func (proxy *Proxy) Stats() Stats {
+	proxy = proxy.snapshot()
+
+	stats := Stats{
+		Coalesced: proxy.misses.joined.Load() + proxy.revalidations.joined.Load(),
+	}
+
+	if keys := proxy.idempotency; keys != nil {
+		stats.Coalesced += keys.flights.joined.Load()
+	}
+
+	return stats
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStatsCoalescedMisses(t *testing.T) {
+	const n = 5
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).CoalesceMisses(true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body := readBody(t, get(proxy, origin.URL+"/cold")); body != "hello" {
+				t.Errorf("body = %q", body)
+			}
+		}()
+	}
+
+	// All but the first join its fetch.
+	waitFor(t, "the misses to join", func() bool { return proxy.Stats().Coalesced == n-1 })
+	close(release)
+	wg.Wait()
+
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("origin fetched %d times; want the one shared", got)
+	}
+	if stats := proxy.Stats(); stats.Coalesced != n-1 {
+		t.Errorf("Coalesced = %d; want %d", stats.Coalesced, n-1)
+	}
+	if entries := entryFiles(t, root); len(entries) != 1 {
+		t.Errorf("cache entries = %q; want the one stored", entries)
+	}
+}
+
+func TestStatsCoalesced(t *testing.T) {
+	const n = 5
+
+	// Revalidated on each hit, without a lifetime; the HEADs held until released.
+	var heads atomic.Int32
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"same"`)
+		if r.Method == "HEAD" {
+			heads.Add(1)
+			<-release
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseIdempotencyKey("Idempotency-Key")
+	readBody(t, get(proxy, origin.URL+"/a"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body := readBody(t, get(proxy, origin.URL+"/a")); body != "hello" {
+				t.Errorf("body = %q", body)
+			}
+		}()
+	}
+
+	// All but the first join its revalidation.
+	waitFor(t, "the revalidations to join", func() bool { return proxy.Stats().Coalesced == n-1 })
+	close(release)
+	wg.Wait()
+
+	if heads.Load() != 1 {
+		t.Errorf("origin saw %d HEADs; want the one shared", heads.Load())
+	}
+
+	// And those of the duplicate idempotent requests add to them.
+	var hits atomic.Int32
+	hold := make(chan struct{})
+	hook := webhookOrigin(&hits, hold)
+	defer hook.Close()
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readBody(t, keyedPost(proxy, hook.URL+"/hook", "retry-1"))
+		}()
+	}
+
+	waitFor(t, "the duplicates to join", func() bool { return proxy.Stats().Coalesced == 2*(n-1) })
+	close(hold)
+	wg.Wait()
+
+	if stats := proxy.Stats(); stats.Coalesced != 2*(n-1) || hits.Load() != 1 {
+		t.Errorf("Coalesced = %d after %d hook hits; want %d after 1", stats.Coalesced, hits.Load(), 2*(n-1))
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// statusEntries is how many of the most recently
+// cached entries are listed on the status page.
+const statusEntries = 20
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Proxy Status</title></head>
+<body>
+<h1>Proxy Status</h1>
+<h2>Stats</h2>
+<table>
+<tr><th>Hit Ratio (Last Minute)</th><td>{{printf "%.1f%%" .MinuteRatio}}</td></tr>
+<tr><th>Hit Ratio (Last Hour)</th><td>{{printf "%.1f%%" .HourRatio}}</td></tr>
+<tr><th>Cached Entries</th><td>{{.Entries}}</td></tr>
+<tr><th>Cached Bytes</th><td>{{.Bytes}}</td></tr>
+<tr><th>Aborted Writes</th><td>{{.AbortedWrites}}</td></tr>
+<tr><th>Coalesced Fetches</th><td>{{.Coalesced}}</td></tr>
+</table>
+<h2>Recently Cached</h2>
+<table>
+<tr><th>Name</th><th>Size</th><th>Stored At</th></tr>
+{{range .Recent}}<tr><td>{{.Name}}</td><td>{{.Size}}</td><td>{{.StoredAt.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// statusPage is what the status page shows.
+type statusPage struct {
+	MinuteRatio   float64
+	HourRatio     float64
+	Entries       int
+	Bytes         int64
+	AbortedWrites int64
+	Coalesced     int64
+	Recent        []CacheEntry
+}
+
+// UseStatusPage serves a small HTML page at the path with the hit
+// ratio, the size of the cache and its most recently cached entries;
+// for debugging. Requests for the path are never forwarded upstream,
+// whatever their host. There is no status page unless a path is set.
+func (proxy *Proxy) UseStatusPage(path string) *Proxy {
+	defer proxy.configure()()
+	proxy.statusPath = path
+	return proxy
+}
+
+// serveStatus writes the status page to the writer.
+func (proxy *Proxy) serveStatus(writer http.ResponseWriter, httpRequest *http.Request) {
+	proxyLog.WithFields(Fields{"path": httpRequest.URL.Path}).Debug("Serving Status Page")
+
+	root := cacheRoot(proxy.cachePath)
+	page := statusPage{
+		MinuteRatio:   proxy.HitRatio(time.Minute) * 100,
+		HourRatio:     proxy.HitRatio(time.Hour) * 100,
+		AbortedWrites: proxy.AbortedWrites(),
+		Coalesced:     proxy.Stats().Coalesced,
+	}
+
+	if proxy.index != nil {
+		proxy.index.load(root)
+		page.Recent = proxy.index.Entries()
+	}
+
+	page.Entries = len(page.Recent)
+	for i := range page.Recent {
+		page.Bytes += page.Recent[i].Size
+
+		if name, err := filepath.Rel(root, page.Recent[i].Name); err == nil {
+			page.Recent[i].Name = name
+		}
+	}
+
+	sort.SliceStable(page.Recent, func(i, j int) bool {
+		return page.Recent[i].StoredAt.After(page.Recent[j].StoredAt)
+	})
+
+	if len(page.Recent) > statusEntries {
+		page.Recent = page.Recent[:statusEntries]
+	}
+
+	var buffer bytes.Buffer
+	if err := statusTemplate.Execute(&buffer, page); err != nil {
+		proxyLog.WithError(err).Error("Could Not Render Status Page")
+		http.Error(writer, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(buffer.Bytes())
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStatusPage(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+
+	// Off by default; the path is the origin's.
+	if body := readBody(t, get(proxy, origin.URL+"/_status")); body != "/_status" {
+		t.Errorf("without a status page: body = %q; want the origin's", body)
+	}
+
+	proxy.UseStatusPage("/_status")
+	for _, path := range []string{"/a", "/a", "/a", "/b"} {
+		readBody(t, get(proxy, origin.URL+path))
+	}
+	fetched := fetches.Load()
+
+	response := get(proxy, origin.URL+"/_status")
+	body := readBody(t, response)
+	if response.StatusCode != http.StatusOK || !strings.HasPrefix(response.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("status page = %d %q; want 200 HTML", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	// Of the five lookups, /a was served from the cache twice.
+	for _, want := range []string{
+		"<td>40.0%</td>",
+		"<th>Cached Entries</th><td>3</td>",
+		filepath.Base(entryFiles(t, root)[0]),
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page lacks %q:\n%s", want, body)
+		}
+	}
+
+	if fetches.Load() != fetched {
+		t.Error("the status page was forwarded upstream")
+	}
+}
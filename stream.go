@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// UseStreamThreshold sets the size in bytes above which response bodies
+// are streamed to the client by WriteTo instead of buffered whole first;
+// teed into the cache file as they are read. RoundTrip pipes them to
+// the body it returns likewise. Smaller bodies (and all of them with
+// the default of 0) are buffered by copyBody as before.
+//
+// Note: bodies buffered for some other reason, like SniffContentType,
+// AddContentSHA1 or a UseBodyRewriter of their Content-Type, are never
+// streamed.
+func (proxy *Proxy) UseStreamThreshold(bytes int64) *Proxy {
+	defer proxy.configure()()
+	proxy.streamThreshold = bytes
+	return proxy
+}
+
+// streams reports if the body is over the UseStreamThreshold; peeking
+// at a body of unknown length up to the threshold to tell. A body found
+// to be under it is left buffered, as copyBody would have.
+func (response *Response) streams() bool {
+	threshold := response.proxy.streamThreshold
+	if threshold <= 0 || response.body != nil || response.cached ||
+		response.Streaming() || response.proxy.addContentSHA1 ||
+		response.proxy.sniffType || response.rewrites() ||
+		response.requestMethod() == "HEAD" {
+		return false
+	}
+
+	if length := response.proxied.ContentLength; length >= 0 {
+		return length > threshold
+	}
+
+	// Grown as it is read; so a short body takes no threshold of memory.
+	body := response.proxied.Body
+	peeked := BodyBuffers.Get()
+	n, err := peeked.ReadFrom(io.LimitReader(body, threshold+1))
+
+	if err == nil && n <= threshold {
+		body.Close()
+		response.body = peeked
+		response.copyBody()
+		return false
+	}
+
+	if err != nil {
+		response.traced(responseLog).WithError(err).Error("Could Not Read Body")
+		response.setErr(err)
+	}
+
+	response.proxied.Body = readCloser{
+		io.MultiReader(&drainedBuffer{peeked}, body), body,
+	}
+
+	return true
+}
+
+// drainedBuffer reads the buffer; handing it back to
+// BodyBuffers once the whole of it has been read.
+type drainedBuffer struct {
+	buffer *bytes.Buffer
+}
+
+func (drained *drainedBuffer) Read(data []byte) (int, error) {
+	if drained.buffer == nil {
+		return 0, io.EOF
+	}
+
+	n, err := drained.buffer.Read(data)
+	if err == io.EOF {
+		BodyBuffers.Put(drained.buffer)
+		drained.buffer = nil
+	}
+
+	return n, err
+}
+
+// pipeResponse returns a copy of the *http.Response with a body piped
+// from WriteTo in a goroutine; which caches the body as it is read, so
+// it is never buffered whole. The body is cut short by any error.
+func (response *Response) pipeResponse() *http.Response {
+	httpResponse := new(http.Response)
+	*httpResponse = *response.proxied
+	httpResponse.Header = make(http.Header)
+	CopyHeaders(response.proxied.Header, httpResponse.Header)
+
+	reader, writer := io.Pipe()
+	httpResponse.Body = reader
+	response.Tee(writer)
+
+	response.traced(responseLog).Debug("Piping Response Body")
+	go func() {
+		response.serve()
+		writer.CloseWithError(response.Err())
+	}()
+
+	return httpResponse
+}
+
+// streamTo copies the rest of the streamed body to the writer.
+func (response *Response) streamTo(writer io.Writer) {
+	if _, err := io.Copy(writer, response.proxied.Body); err != nil {
+		response.traced(responseLog).WithError(err).Error("Could Not Write Body")
+		response.setErr(err)
+	}
+}
+
+// streamCache tees the streamed body to the tees and, unless file is
+// nil, into the cache file as the body is read. The returned done
+// reads the remainder of the body and stores the file; a body cut
+// short leaves nothing cached.
+func (response *Response) streamCache(file *os.File) (done func()) {
+	writers := response.tees
+	response.tees = nil
+
+	var written chan error
+	var cacheWriter *io.PipeWriter
+	var sum hash.Hash
+
+	if file != nil {
+		cached := *response.proxied
+		cached.Header = response.cacheHeader()
+
+		var reader *io.PipeReader
+		reader, cacheWriter = io.Pipe()
+		cached.Body = reader
+
+		written = make(chan error, 1)
+		go func() {
+			err := response.writeCacheFile(file, &cached)
+			reader.CloseWithError(err)
+			written <- err
+		}()
+
+		// Failing to cache doesn't fail the client.
+		writers = append(writers, &quietWriter{writer: cacheWriter})
+
+		if response.requestMethod() != "HEAD" {
+			sum = sha256.New()
+			writers = append(writers, sum)
+		}
+	}
+
+	body := response.proxied.Body
+	if len(writers) > 0 {
+		response.proxied.Body = readCloser{
+			io.TeeReader(body, io.MultiWriter(writers...)), body,
+		}
+	}
+
+	return func() {
+		if len(writers) > 0 && response.err == nil {
+			if _, err := io.Copy(ioutil.Discard, response.proxied.Body); err != nil {
+				response.traced(responseLog).WithError(err).Error("Could Not Read Body")
+				response.setErr(err)
+			}
+		}
+
+		body.Close()
+
+		if file == nil {
+			return
+		}
+
+		if sum != nil {
+			response.sum = hex.EncodeToString(sum.Sum(nil))
+		}
+
+		cacheWriter.CloseWithError(response.err)
+		response.storeCache(file, <-written)
+	}
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// quietWriter discards what is written after the first error;
+// reporting every write as done.
+type quietWriter struct {
+	writer io.Writer
+	err    error
+}
+
+func (writer *quietWriter) Write(p []byte) (int, error) {
+	if writer.err == nil {
+		_, writer.err = writer.writer.Write(p)
+	}
+
+	return len(p), nil
+}
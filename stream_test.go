@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStreamThresholdBuffersSmall(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("small body"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseStreamThreshold(1024)
+	response := proxy.Fetch(newRequest("GET", origin.URL+"/small", ""))
+	response.WriteTo(httptest.NewRecorder())
+
+	if response.streamed || response.body == nil {
+		t.Fatal("small response was not buffered")
+	}
+
+	// Buffered; so it reads again.
+	for i := 0; i < 2; i++ {
+		body, _ := ioutil.ReadAll(response.ToHTTPResponse().Body)
+		if string(body) != "small body" {
+			t.Errorf("read %d = %q; want small body", i, body)
+		}
+	}
+
+	response.release()
+}
+
+func TestStreamThresholdStreamsLarge(t *testing.T) {
+	chunk := strings.Repeat("x", 64<<10)
+	received := make(chan struct{})
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(chunk))
+		w.(http.Flusher).Flush()
+
+		// The rest only once the client has the start.
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+		}
+		w.Write([]byte(chunk))
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root).UseStreamThreshold(1024)
+
+	client := proxyClient(t, proxy)
+	response, err := client.Get(origin.URL + "/large")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+
+	start := make([]byte, len(chunk))
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		if _, err := io.ReadFull(response.Body, start); err != nil {
+			t.Errorf("reading the start: %v", err)
+		}
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(4 * time.Second):
+		t.Fatal("the start of the body was held back until the whole of it was read")
+	}
+	close(received)
+
+	rest, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if len(start)+len(rest) != 2*len(chunk) {
+		t.Errorf("streamed %d bytes; want %d", len(start)+len(rest), 2*len(chunk))
+	}
+
+	// Cached whole as it streamed; served from the cache after.
+	waitFor(t, "the streamed body to be cached", func() bool { return len(entryFiles(t, root)) == 1 })
+	response, err = client.Get(origin.URL + "/large")
+	if err != nil {
+		t.Fatalf("GET again: %v", err)
+	}
+	if body := readBody(t, response); len(body) != 2*len(chunk) || fetches.Load() != 1 {
+		t.Errorf("served %d bytes after %d fetches; want the whole body from the cache", len(body), fetches.Load())
+	}
+}
+
+// trackingPool counts the buffers of BodyBuffers not yet handed back.
+type trackingPool struct {
+	BufferPool
+	outstanding atomic.Int32
+}
+
+func (pool *trackingPool) Get() *bytes.Buffer {
+	pool.outstanding.Add(1)
+	return pool.BufferPool.Get()
+}
+
+func (pool *trackingPool) Put(buffer *bytes.Buffer) {
+	pool.outstanding.Add(-1)
+	pool.BufferPool.Put(buffer)
+}
+
+func TestStreamThresholdPeeksPooled(t *testing.T) {
+	pool := &trackingPool{BufferPool: BodyBuffers}
+	defer func(pool BufferPool) { BodyBuffers = pool }(BodyBuffers)
+	BodyBuffers = pool
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Chunked; of a length unknown until it is read.
+		w.Write([]byte(r.URL.Path))
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/large" {
+			w.Write(bytes.Repeat([]byte("x"), 64<<10))
+		}
+	}))
+	defer origin.Close()
+
+	// A short body of unknown length takes no threshold of memory.
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseStreamThreshold(16 << 20)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if body := readBody(t, get(proxy, origin.URL+"/small")); body != "/small" {
+		t.Errorf("body = %q; want /small", body)
+	}
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Errorf("allocated %d bytes for a short body", allocated)
+	}
+
+	// The peek of a streamed body is handed back once it is read.
+	proxy = NewProxy().UseCachePath(t.TempDir()).UseStreamThreshold(1024)
+	response := proxy.Fetch(newRequest("GET", origin.URL+"/large", ""))
+	if !response.streams() {
+		t.Fatal("large response was not streamed")
+	}
+
+	data, _ := ioutil.ReadAll(response.proxied.Body)
+	response.proxied.Body.Close()
+	if len(data) != len("/large")+64<<10 {
+		t.Errorf("read %d bytes; want %d", len(data), len("/large")+64<<10)
+	}
+	if n := pool.outstanding.Load(); n != 0 {
+		t.Errorf("%d buffers not handed back to BodyBuffers", n)
+	}
+}
+
+func TestStreamThresholdRewrittenTypes(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html")
+		} else {
+			w.Header().Set("Content-Type", "image/png")
+		}
+		w.Write(bytes.Repeat([]byte("x"), 64<<10))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseStreamThreshold(1024).
+		UseBodyRewriter("text/html", func(body []byte) []byte { return body })
+
+	// Only the bodies the rewriter is for are buffered.
+	for path, want := range map[string]bool{"/page": false, "/image": true} {
+		response := proxy.Fetch(newRequest("GET", origin.URL+path, ""))
+		if streams := response.streams(); streams != want {
+			t.Errorf("%s streamed = %v; want %v", path, streams, want)
+		}
+		response.proxied.Body.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTeeReceivesBody(t *testing.T) {
+	body := strings.Repeat("0123456789", 1000)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(body))
+	}))
+	defer origin.Close()
+
+	for _, threshold := range []int64{0, 1024} {
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseStreamThreshold(threshold)
+
+		// Fetched, then served from the cache.
+		for _, pass := range []string{"fetched", "cached"} {
+			var tee bytes.Buffer
+			recorder := httptest.NewRecorder()
+			proxy.Fetch(httptest.NewRequest("GET", origin.URL+"/a", nil)).Tee(&tee).WriteTo(recorder)
+
+			if recorder.Body.String() != body {
+				t.Errorf("threshold %d, %s: client got %d bytes; want %d", threshold, pass, recorder.Body.Len(), len(body))
+			}
+			if tee.String() != recorder.Body.String() {
+				t.Errorf("threshold %d, %s: tee got %d bytes; client %d", threshold, pass, tee.Len(), recorder.Body.Len())
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UseServerTiming sets whether the served responses carry a
+// Server-Timing header with how long the cache lookup ("cache") and
+// the upstream fetch ("upstream") took; a cache hit only has the first.
+func (proxy *Proxy) UseServerTiming(enable bool) *Proxy {
+	defer proxy.configure()()
+	proxy.serverTiming = enable
+	return proxy
+}
+
+// serverTiming returns the Server-Timing of the response; empty
+// unless it is enabled and the cache or the origin was consulted.
+func (response *Response) serverTiming() string {
+	if response.proxy == nil || !response.proxy.serverTiming {
+		return ""
+	}
+
+	var metrics []string
+	if response.lookup > 0 {
+		metrics = append(metrics, timingMetric("cache", response.lookup))
+	}
+
+	if response.latency > 0 {
+		metrics = append(metrics, timingMetric("upstream", response.latency))
+	}
+
+	return strings.Join(metrics, ", ")
+}
+
+// timingMetric formats a Server-Timing metric of the duration in milliseconds.
+func timingMetric(name string, duration time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, float64(duration)/float64(time.Millisecond))
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timingMetrics parses a Server-Timing header into the milliseconds of each metric.
+func timingMetrics(t *testing.T, header string) map[string]float64 {
+	t.Helper()
+
+	metrics := make(map[string]float64)
+	for _, metric := range strings.Split(header, ",") {
+		name, dur, ok := strings.Cut(strings.TrimSpace(metric), ";dur=")
+		if !ok {
+			t.Fatalf("metric %q of %q has no duration", metric, header)
+		}
+
+		millis, err := strconv.ParseFloat(dur, 64)
+		if err != nil {
+			t.Fatalf("metric %q of %q: %v", metric, header, err)
+		}
+		metrics[name] = millis
+	}
+
+	return metrics
+}
+
+func TestServerTiming(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseServerTiming(true)
+
+	miss := timingMetrics(t, get(proxy, origin.URL+"/a").Header.Get("Server-Timing"))
+	if upstream, ok := miss["upstream"]; !ok || upstream < 20 || upstream > 5000 {
+		t.Errorf("miss timing = %v; want about 20ms upstream", miss)
+	}
+	if cache, ok := miss["cache"]; ok && (cache < 0 || cache > 5000) {
+		t.Errorf("miss timing = %v; want a plausible cache lookup", miss)
+	}
+
+	hit := timingMetrics(t, get(proxy, origin.URL+"/a").Header.Get("Server-Timing"))
+	if _, ok := hit["cache"]; !ok || len(hit) != 1 {
+		t.Errorf("hit timing = %v; want only the cache lookup", hit)
+	}
+}
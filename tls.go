@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"net/url"
+)
+
+// ForwardTLSInfo sets whether requests the proxy received over TLS are
+// sent upstream with X-Forwarded-Proto: https, and with the client's
+// certificate, if it gave one, URL escaped PEM in X-Client-Cert. Any
+// X-Forwarded-Proto or X-Client-Cert sent by the client itself is removed.
+func (proxy *Proxy) ForwardTLSInfo(forward bool) *Proxy {
+	defer proxy.configure()()
+	proxy.forwardTLS = forward
+	return proxy
+}
+
+// forwardTLSInfo adds the TLS headers of ForwardTLSInfo.
+func (request *Request) forwardTLSInfo() {
+	request.copyHeaders()
+	request.proxied.Header.Del("X-Forwarded-Proto")
+	request.proxied.Header.Del("X-Client-Cert")
+
+	state := request.original.TLS
+	if state == nil {
+		return
+	}
+
+	request.traced(requestLog).Debug("Forwarding TLS Info")
+	request.proxied.Header.Set("X-Forwarded-Proto", "https")
+
+	if len(state.PeerCertificates) > 0 {
+		cert := pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: state.PeerCertificates[0].Raw,
+		})
+
+		request.proxied.Header.Set("X-Client-Cert", url.QueryEscape(string(cert)))
+	}
+}
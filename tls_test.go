@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestForwardTLSInfo(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Seen-Proto", r.Header.Get("X-Forwarded-Proto"))
+		w.Header().Set("Seen-Cert", r.Header.Get("X-Client-Cert"))
+	}))
+	defer origin.Close()
+
+	// Any certificate will do as the client's.
+	issuer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer issuer.Close()
+	cert := issuer.Certificate()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).ForwardTLSInfo(true)
+
+	request := newRequest("GET", origin.URL+"/tls", "")
+	request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	response := serve(proxy, request)
+
+	if proto := response.Header.Get("Seen-Proto"); proto != "https" {
+		t.Errorf("origin saw X-Forwarded-Proto %q; want https", proto)
+	}
+
+	escaped, err := url.QueryUnescape(response.Header.Get("Seen-Cert"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode([]byte(escaped))
+	if block == nil || string(block.Bytes) != string(cert.Raw) {
+		t.Errorf("origin saw X-Client-Cert %q; want the PEM of the client's", escaped)
+	}
+
+	// Over plain HTTP; a client can't pass off its own certificate or TLS.
+	request = newRequest("GET", origin.URL+"/plain", "")
+	request.Header.Set("X-Forwarded-Proto", "https")
+	request.Header.Set("X-Client-Cert", "forged")
+	response = serve(proxy, request)
+
+	if proto := response.Header.Get("Seen-Proto"); proto != "" {
+		t.Errorf("origin saw X-Forwarded-Proto %q; want none", proto)
+	}
+	if seen := response.Header.Get("Seen-Cert"); seen != "" {
+		t.Errorf("origin saw X-Client-Cert %q; want none", seen)
+	}
+}
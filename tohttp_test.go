@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestToHTTPResponse(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Origin", "yes")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("converted"))
+	}))
+	defer origin.Close()
+
+	response := NewProxy().UseCachePath(t.TempDir()).Fetch(newRequest("GET", origin.URL+"/c", ""))
+
+	// Each copy reads the buffered body afresh.
+	for i := 0; i < 2; i++ {
+		httpResponse := response.ToHTTPResponse()
+		if httpResponse.StatusCode != http.StatusOK || httpResponse.Header.Get("X-Origin") != "yes" {
+			t.Errorf("copy %d = %d %v; want the origin's status and headers", i, httpResponse.StatusCode, httpResponse.Header)
+		}
+
+		body, err := ioutil.ReadAll(httpResponse.Body)
+		httpResponse.Body.Close()
+		if err != nil || string(body) != "converted" {
+			t.Errorf("copy %d body = %q, %v; want converted", i, body, err)
+		}
+		if httpResponse.ContentLength != int64(len("converted")) {
+			t.Errorf("copy %d ContentLength = %d", i, httpResponse.ContentLength)
+		}
+	}
+
+	// Changing a copy leaves the Response as it was.
+	response.ToHTTPResponse().Header.Set("X-Origin", "changed")
+	if got := response.GetHeader("X-Origin"); got != "yes" {
+		t.Errorf("header after changing a copy = %q; want yes", got)
+	}
+}
+
+func TestRoundTripAsClientTransport(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Origin", "yes")
+		w.Write([]byte("through " + r.URL.Path))
+	}))
+	defer origin.Close()
+
+	client := &http.Client{Transport: NewProxy().UseCachePath(t.TempDir())}
+	uri, _ := url.Parse(origin.URL + "/rt")
+
+	response, err := client.Get(uri.String())
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+
+	if got := readBody(t, response); got != "through /rt" || response.Header.Get("X-Origin") != "yes" {
+		t.Errorf("response = %q %v", got, response.Header)
+	}
+	if response.Request == nil || response.Request.URL.String() != uri.String() {
+		t.Errorf("response Request = %v; want the client's request", response.Request)
+	}
+}
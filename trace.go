@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// UseRequestIDHeader sets the header carrying the ID that traces a
+// request; the incoming one is kept, else an ID is generated. It is
+// sent upstream, set on the response served and logged with each line
+// of the request. Naming the cache by SHA1 leaves the header out.
+func (proxy *Proxy) UseRequestIDHeader(name string) *Proxy {
+	defer proxy.configure()()
+	proxy.requestIDHeader = http.CanonicalHeaderKey(name)
+	return proxy
+}
+
+// requestID returns the ID of the request under UseRequestIDHeader;
+// empty when no header is set.
+func (proxy *Proxy) requestID(httpRequest *http.Request) string {
+	if proxy.requestIDHeader == "" {
+		return ""
+	}
+
+	if id := httpRequest.Header.Get(proxy.requestIDHeader); id != "" {
+		return id
+	}
+
+	return newRequestID()
+}
+
+// newRequestID returns a random ID of 16 bytes in hex.
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		proxyLog.WithError(err).Error("Could Not Generate Request ID")
+	}
+
+	return fmt.Sprintf("%x", id)
+}
+
+// setRequestID traces the request by the ID; sending it upstream.
+func (request *Request) setRequestID(id string) {
+	if id == "" {
+		return
+	}
+
+	request.requestID = id
+	request.copyHeaders()
+	request.proxied.Header.Set(request.proxy.requestIDHeader, id)
+}
+
+// traced returns the entry with the request ID, if any; so the
+// log lines of one request can be told apart from the others.
+func (request *Request) traced(entry *logEntry) *logEntry {
+	if request.requestID == "" {
+		return entry
+	}
+
+	return entry.WithFields(Fields{"request-id": request.requestID})
+}
+
+// traced returns the entry with the ID of the request the response
+// is served for, if any; as Request.traced does.
+func (response *Response) traced(entry *logEntry) *logEntry {
+	if response.requestID == "" {
+		return entry
+	}
+
+	return entry.WithFields(Fields{"request-id": response.requestID})
+}
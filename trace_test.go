@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDHeader(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(r.Header.Get("X-Request-ID")))
+	}))
+	defer origin.Close()
+
+	messages, restore := captureLogs()
+	defer restore()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseRequestIDHeader("x-request-id")
+
+	// The incoming ID is kept; sent upstream and echoed to the client.
+	request := newRequest("GET", origin.URL+"/a", "")
+	request.Header.Set("X-Request-ID", "trace-1")
+	response := serve(proxy, request)
+	if body := readBody(t, response); body != "trace-1" {
+		t.Errorf("origin saw ID %q; want trace-1", body)
+	}
+	if id := response.Header.Get("X-Request-ID"); id != "trace-1" {
+		t.Errorf("response ID = %q; want trace-1", id)
+	}
+
+	fetch := findLog(messages(), "Fetching Response From Request")
+	if !strings.Contains(fetch, " request-id=trace-1") {
+		t.Errorf("fetch message lacks the request ID: %q", fetch)
+	}
+
+	// Without one, an ID is generated; the cached response carries it
+	// rather than the ID of the request that stored it.
+	response = get(proxy, origin.URL+"/a")
+	if body := readBody(t, response); body != "trace-1" {
+		t.Errorf("cached body = %q; want trace-1", body)
+	}
+
+	id := response.Header.Get("X-Request-ID")
+	if len(id) != 32 || id == "trace-1" {
+		t.Errorf("generated ID = %q; want 32 hex digits", id)
+	}
+}
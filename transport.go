@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// http2Setting is how the built transport negotiates HTTP/2.
+type http2Setting int
+
+const (
+	http2Default http2Setting = iota
+	http2Forced
+	http2Disabled
+)
+
+// Transport returns the http.RoundTripper used to fetch upstream.
+//
+// When transport options are set they are applied to a clone of the
+// *http.Transport given to NewProxy (or http.DefaultTransport); any
+// other http.RoundTripper is used as is. It is then wrapped by the
+// UseTransportMiddleware.
+func (proxy *Proxy) Transport() http.RoundTripper {
+	proxy = proxy.snapshot()
+
+	return proxy.transportWith(proxy.http2)
+}
+
+// protoTransport returns the transport the request is sent upstream
+// with; under PreserveProto, one speaking the protocol of the client's
+// request in place of the ForceHTTP2 setting.
+func (proxy *Proxy) protoTransport(httpRequest *http.Request) http.RoundTripper {
+	switch {
+	case !proxy.preserveProto || httpRequest.ProtoMajor == 0:
+		return proxy.Transport()
+	case httpRequest.ProtoMajor >= 2:
+		return proxy.transportWith(http2Forced)
+	default:
+		return proxy.transportWith(http2Disabled)
+	}
+}
+
+// transportWith returns the transport built with the http2 setting; once
+// for each setting, and kept by the settings until an option is changed.
+func (proxy *Proxy) transportWith(http2 http2Setting) http.RoundTripper {
+	proxy.built.mutex.Lock()
+	defer proxy.built.mutex.Unlock()
+
+	if transport, ok := proxy.built.transports[http2]; ok {
+		return transport
+	}
+
+	if http2 == http2Default && !proxy.customTransport() && len(proxy.middleware) == 0 {
+		return proxy.transport
+	}
+
+	transport := proxy.optionsTransport(http2)
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	// The first middleware is the outermost; it sees the request first.
+	for i := len(proxy.middleware) - 1; i >= 0; i-- {
+		transport = proxy.middleware[i](transport)
+	}
+
+	proxyLog.Debug("Built Transport")
+	if proxy.built.transports == nil {
+		proxy.built.transports = make(map[http2Setting]http.RoundTripper)
+	}
+
+	proxy.built.transports[http2] = transport
+	return transport
+}
+
+// builtTransport is the transports built by Transport and protoTransport;
+// kept by the settings until an option of them is changed.
+type builtTransport struct {
+	mutex      sync.Mutex
+	transports map[http2Setting]http.RoundTripper
+}
+
+// optionsTransport returns the transport with the options applied;
+// negotiating HTTP/2 by the http2 setting.
+func (proxy *Proxy) optionsTransport(http2 http2Setting) http.RoundTripper {
+	if http2 == http2Default && !proxy.customTransport() {
+		return proxy.transport
+	}
+
+	base, ok := proxy.transport.(*http.Transport)
+	switch {
+	case proxy.transport == nil:
+		base = http.DefaultTransport.(*http.Transport)
+	case !ok:
+		proxyLog.Warning("Transport Options Need A *http.Transport")
+		return proxy.transport
+	}
+
+	transport := base.Clone()
+
+	// Forced; only h2 is offered over TLS, and http:// URLs
+	// are sent as h2c with prior knowledge of the origin.
+	switch http2 {
+	case http2Forced:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP2(true)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+		offerProtos(transport, "h2")
+	case http2Disabled:
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetHTTP1(true)
+		offerProtos(transport, "http/1.1")
+	}
+
+	// The client's Accept-Encoding is forwarded as is; without the
+	// transport asking for gzip (and ungzipping) on its own.
+	if proxy.noDecompress {
+		transport.DisableCompression = true
+	}
+
+	// A dialer of the given transport is its own; only the
+	// default one (or none) is replaced for the keep-alive.
+	if period := proxy.keepAlive; period != 0 {
+		if transport.DialContext == nil || base == http.DefaultTransport {
+			transport.DialContext = keepAliveDialer(period).DialContext
+		} else {
+			proxyLog.Warning("Keeping Transport Dialer Over Keep-Alive")
+		}
+	}
+
+	if len(proxy.unixSockets) > 0 {
+		sockets := make(map[string]string, len(proxy.unixSockets))
+		for host, socket := range proxy.unixSockets {
+			sockets[host] = socket
+		}
+
+		transport.DialContext = unixSocketDialer(sockets, transport.DialContext)
+	}
+
+	return transport
+}
+
+// offerProtos sets the ALPN protocols of the TLS config of the cloned
+// transport, if it has any; they would be offered over the Protocols.
+func offerProtos(transport *http.Transport, protos ...string) {
+	if transport.TLSClientConfig == nil || len(transport.TLSClientConfig.NextProtos) == 0 {
+		return
+	}
+
+	transport.TLSClientConfig.NextProtos = protos
+}
+
+// customTransport reports if any transport option is set.
+func (proxy *Proxy) customTransport() bool {
+	return proxy.http2 != http2Default ||
+		proxy.noDecompress ||
+		proxy.keepAlive != 0 ||
+		len(proxy.unixSockets) > 0
+}
+
+// keepAliveDialer returns the dialer of http.DefaultTransport with the
+// TCP keep-alive period; negative disables the keep-alive probes.
+func keepAliveDialer(period time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: 30 * time.Second, KeepAlive: period}
+}
+
+// unixSocketDialer dials the socket of a host (or host:port)
+// in sockets; any other address is dialed with dial.
+func unixSocketDialer(
+	sockets map[string]string,
+	dial func(ctx context.Context, network, addr string) (net.Conn, error),
+) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = new(net.Dialer).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		socket, ok := sockets[addr]
+		if host, _, err := net.SplitHostPort(addr); !ok && err == nil {
+			socket, ok = sockets[host]
+		}
+
+		if !ok {
+			return dial(ctx, network, addr)
+		}
+
+		proxyLog.WithFields(Fields{
+			"addr":   addr,
+			"socket": socket,
+		}).Debug("Dialing Unix Socket")
+		return new(net.Dialer).DialContext(ctx, "unix", socket)
+	}
+}
+
+// resetTransport discards the built transport after an option changes;
+// the requests still served by the settings before keep to theirs.
+func (proxy *Proxy) resetTransport() {
+	proxy.built = new(builtTransport)
+}
+
+// UseUnixSocket proxies the requests for host (with or without
+// a port) to the HTTP server listening on the Unix socketPath.
+func (proxy *Proxy) UseUnixSocket(host, socketPath string) *Proxy {
+	defer proxy.configure()()
+	if proxy.unixSockets == nil {
+		proxy.unixSockets = make(map[string]string)
+	}
+
+	proxy.unixSockets[host] = socketPath
+	proxy.resetTransport()
+	return proxy
+}
+
+// ForceHTTP2 sets whether every upstream connection is HTTP/2; over
+// TLS without falling back to HTTP/1.1, and as h2c for http:// URLs,
+// so the origins must speak it. False disables HTTP/2 entirely.
+func (proxy *Proxy) ForceHTTP2(force bool) *Proxy {
+	defer proxy.configure()()
+	proxy.http2 = http2Disabled
+	if force {
+		proxy.http2 = http2Forced
+	}
+
+	proxy.resetTransport()
+	return proxy
+}
+
+// DisableAutoDecompress sets whether the transport is kept from asking
+// for gzip itself and transparently decompressing the response; so the
+// bodies are cached and forwarded compressed as the origin sent them.
+func (proxy *Proxy) DisableAutoDecompress(disable bool) *Proxy {
+	defer proxy.configure()()
+	proxy.noDecompress = disable
+	proxy.resetTransport()
+	return proxy
+}
+
+// UseKeepAlive sets the period of the TCP keep-alive probes of the
+// upstream connections; so half-open connections to a flaky backend
+// are found out rather than reused. Zero disables the probes. It sets
+// the dialer of a transport without one, or of http.DefaultTransport;
+// the DialContext of a *http.Transport given to NewProxy is kept.
+func (proxy *Proxy) UseKeepAlive(period time.Duration) *Proxy {
+	defer proxy.configure()()
+	if period <= 0 {
+		period = -1
+	}
+
+	proxy.keepAlive = period
+	proxy.resetTransport()
+	return proxy
+}
+
+// UseUpstreamAcceptEncoding sets the Accept-Encoding sent upstream over
+// the client's; such as "gzip, br", so the bodies are cached compressed
+// even with DisableAutoDecompress. They are served as the origin sent
+// them and the transport never decompresses a set Accept-Encoding; so
+// it is only sent for clients whose own accepts each of its codings.
+func (proxy *Proxy) UseUpstreamAcceptEncoding(value string) *Proxy {
+	defer proxy.configure()()
+	proxy.acceptEncoding = value
+	return proxy
+}
+
+// acceptsEncodings reports if the Accept-Encoding of the client gives
+// each coding of the value (or "*") a q above zero.
+func acceptsEncodings(accept, value string) bool {
+	for _, coding := range strings.Split(value, ",") {
+		coding = strings.ToLower(strings.TrimSpace(strings.SplitN(coding, ";", 2)[0]))
+		if coding == "" {
+			continue
+		}
+
+		quality := acceptQuality(accept, func(accepted string) bool {
+			return accepted == coding || accepted == "*"
+		})
+		if quality <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UseTransportMiddleware wraps the transport fetching upstream (see
+// Transport) in the middleware; such as for logging, retries or
+// metrics. The first one given is the outermost, so each sees the
+// request before and the response after those following it.
+func (proxy *Proxy) UseTransportMiddleware(
+	middleware ...func(http.RoundTripper) http.RoundTripper,
+) *Proxy {
+	defer proxy.configure()()
+	proxy.middleware = append(proxy.middleware, middleware...)
+	proxy.resetTransport()
+	return proxy
+}
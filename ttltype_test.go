@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTTLByContentType(t *testing.T) {
+	ttls := map[string]time.Duration{
+		"image/*":   24 * time.Hour,
+		"text/html": time.Minute,
+	}
+	proxy := NewProxy().UseTTLByContentType(ttls)
+
+	// Changing the map after it is set has no effect.
+	ttls["text/html"] = 0
+
+	for contentType, want := range map[string]time.Duration{
+		"image/png":                24 * time.Hour,
+		"IMAGE/JPEG":               24 * time.Hour,
+		"text/html; charset=utf-8": time.Minute,
+	} {
+		response := LoadResponse(&http.Response{Header: http.Header{
+			"Cache-Control": {"max-age=5"},
+			"Content-Type":  {contentType},
+		}}, nil)
+		response.proxy = proxy.snapshot()
+
+		if ttl, yes := response.freshnessLifetime(); !yes || ttl != want {
+			t.Errorf("%s: lifetime %v, %v; want %v", contentType, ttl, yes, want)
+		}
+	}
+}
+
+func TestTTLByContentTypeServed(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=5")
+		w.Header().Set("Content-Type", map[string]string{"/a.png": "image/png", "/a.html": "text/html"}[r.URL.Path])
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseTTLByContentType(map[string]time.Duration{
+		"image/": 24 * time.Hour,
+		"text/":  time.Minute,
+	})
+
+	stored := time.Now()
+	for path, want := range map[string]time.Duration{"/a.png": 24 * time.Hour, "/a.html": time.Minute} {
+		readBody(t, get(proxy, origin.URL+path))
+
+		cached := get(proxy, origin.URL+path)
+		readBody(t, cached)
+
+		expires, err := http.ParseTime(cached.Header.Get("Expires"))
+		if err != nil {
+			t.Fatalf("%s: Expires %q: %v", path, cached.Header.Get("Expires"), err)
+		}
+		if diff := expires.Sub(stored.Add(want)); diff < -2*time.Second || diff > 2*time.Second {
+			t.Errorf("%s: Expires in %v; want %v", path, expires.Sub(stored).Round(time.Second), want)
+		}
+	}
+}
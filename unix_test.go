@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocketUpstream(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "origin.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+
+	origin := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unix " + r.Host + r.URL.Path))
+	}))
+	origin.Listener = listener
+	origin.Start()
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseUnixSocket("backend.internal", socket)
+	for url, want := range map[string]string{
+		"http://backend.internal/a":      "unix backend.internal/a",
+		"http://backend.internal:8080/b": "unix backend.internal:8080/b",
+	} {
+		response := get(proxy, url)
+		if body := readBody(t, response); response.StatusCode != http.StatusOK || body != want {
+			t.Errorf("%s: %d %q; want 200 %q", url, response.StatusCode, body, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestURICacheName(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://example.com":           "example.com/__index__",
+		"http://example.com/":          "example.com/__index__",
+		"http://example.com/docs":      "example.com/docs/__leaf__",
+		"http://example.com/docs/":     "example.com/docs/__index__",
+		"http://example.com/docs/page": "example.com/docs/page/__leaf__",
+		"http://example.com/../etc":    "example.com/etc/__leaf__",
+	} {
+		uri, _ := url.Parse(raw)
+		if got := uriCacheName(uri); got != filepath.FromSlash(want) {
+			t.Errorf("uriCacheName(%s) = %s; want %s", raw, got, want)
+		}
+	}
+
+	// The Host of a request read by a server is the client's to set.
+	for host, want := range map[string]string{
+		"..":             "/etc/__leaf__",
+		"../../tmp":      "tmp/etc/__leaf__",
+		"example.com/..": "/etc/__leaf__",
+	} {
+		uri := &url.URL{Host: host, Path: "/etc"}
+		if got := uriCacheName(uri); got != filepath.FromSlash(want) {
+			t.Errorf("uriCacheName of host %q = %s; want %s", host, got, want)
+		}
+	}
+}
+
+func TestURICacheNamesCoexist(t *testing.T) {
+	var fetches atomic.Int32
+	origin := cacheOrigin(&fetches)
+	defer origin.Close()
+
+	paths := []string{"/docs", "/docs/", "/docs/page"}
+	for _, order := range [][]string{paths, {paths[2], paths[1], paths[0]}} {
+		fetches.Store(0)
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseCacheNameStyle(CacheNameURI)
+
+		for pass := 0; pass < 2; pass++ {
+			for _, path := range order {
+				if body := readBody(t, get(proxy, origin.URL+path)); body != path {
+					t.Errorf("%v: %s body = %q", order, path, body)
+				}
+			}
+		}
+
+		// Each fetched once; then served from its own entry.
+		if n := fetches.Load(); n != int32(len(order)) {
+			t.Errorf("%v: origin fetched %d times; want %d", order, n, len(order))
+		}
+	}
+}
@@ -1,11 +1,39 @@
 package proxy
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
+// CopyHeaders appends the values of the src headers to dst; keeping
+// repeated headers such as Set-Cookie in the order they were received.
 func CopyHeaders(src, dst http.Header) {
 	for k, vv := range src {
-		for _, v := range vv {
-			dst.Add(k, v)
-		}
+		k = http.CanonicalHeaderKey(k)
+		dst[k] = append(dst[k], vv...)
 	}
 }
+
+// ReplaceHeaders sets the headers of dst to the values of the src
+// headers; dropping any values dst had for them, rather than adding.
+func ReplaceHeaders(src, dst http.Header) {
+	for k, vv := range src {
+		dst[http.CanonicalHeaderKey(k)] = append([]string(nil), vv...)
+	}
+}
+
+// WeakETagMatch compares entity tags ignoring their W/ prefix;
+// as used when revalidating a cached response.
+func WeakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// StrongETagMatch compares entity tags that must both be strong
+// and equal; as required when serving or conditioning a Range.
+func StrongETagMatch(a, b string) bool {
+	if strings.HasPrefix(a, "W/") || strings.HasPrefix(b, "W/") {
+		return false
+	}
+
+	return a == b
+}
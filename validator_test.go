@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidatorDecidesFreshness(t *testing.T) {
+	for _, test := range []struct {
+		control string
+		fresh   bool
+		fetches int32
+	}{
+		// The headers say stale; the body says fresh.
+		{"max-age=0", true, 1},
+		// The headers say fresh; the body says stale.
+		{"max-age=3600", false, 2},
+	} {
+		var fetches atomic.Int32
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fetches.Add(1)
+			w.Header().Set("Cache-Control", test.control)
+			json.NewEncoder(w).Encode(map[string]bool{"fresh": test.fresh})
+		}))
+
+		var consulted atomic.Int32
+		proxy := NewProxy().UseCachePath(t.TempDir()).UseValidator(func(cached *Response) bool {
+			consulted.Add(1)
+			var body struct{ Fresh bool }
+			if err := json.NewDecoder(cached.copyBody()).Decode(&body); err != nil {
+				t.Errorf("decoding cached body: %v", err)
+			}
+			return body.Fresh
+		})
+
+		want, _ := json.Marshal(map[string]bool{"fresh": test.fresh})
+		readBody(t, get(proxy, origin.URL+"/a"))
+		if body := readBody(t, get(proxy, origin.URL+"/a")); body != string(want)+"\n" {
+			t.Errorf("%s: body = %q; want %q", test.control, body, want)
+		}
+		origin.Close()
+
+		if n := consulted.Load(); n != 1 {
+			t.Errorf("%s: validator consulted %d times; want 1", test.control, n)
+		}
+		if n := fetches.Load(); n != test.fetches {
+			t.Errorf("%s: origin fetched %d times; want %d", test.control, n, test.fetches)
+		}
+	}
+}
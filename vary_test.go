@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVaryStarNotCached(t *testing.T) {
+	var fetches atomic.Int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language, *")
+		w.Write([]byte("hello"))
+	}))
+	defer origin.Close()
+
+	root := t.TempDir()
+	proxy := NewProxy().UseCachePath(root)
+	for i := 0; i < 2; i++ {
+		if body := readBody(t, get(proxy, origin.URL+"/a")); body != "hello" {
+			t.Fatalf("body = %q", body)
+		}
+	}
+
+	if files := cacheFiles(t, root); len(files) != 0 {
+		t.Errorf("Vary: * response was cached: %v", files)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("origin fetched %d times; want 2", n)
+	}
+}
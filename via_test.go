@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// viaOrigin records the Via of requests; answering with one of its own.
+func viaOrigin(seen *string, via string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*seen = r.Header.Get("Via")
+		if via != "" {
+			w.Header().Set("Via", via)
+		}
+		w.Write([]byte("via"))
+	}))
+}
+
+func TestViaAdded(t *testing.T) {
+	var seen string
+	origin := viaOrigin(&seen, "")
+	defer origin.Close()
+
+	response := get(NewProxy().UseCachePath(t.TempDir()), origin.URL+"/via")
+	readBody(t, response)
+
+	if seen != "1.1 go.proxy" {
+		t.Errorf("forwarded Via = %q; want 1.1 go.proxy", seen)
+	}
+	if got := response.Header.Get("Via"); got != "1.1 go.proxy" {
+		t.Errorf("served Via = %q; want 1.1 go.proxy", got)
+	}
+}
+
+func TestViaAppended(t *testing.T) {
+	var seen string
+	origin := viaOrigin(&seen, "1.0 upstream")
+	defer origin.Close()
+
+	httpRequest := newRequest("GET", origin.URL+"/via", "")
+	httpRequest.Header.Set("Via", "1.0 client")
+
+	response := serve(NewProxy().UseCachePath(t.TempDir()).UseViaName("edge"), httpRequest)
+	readBody(t, response)
+
+	if seen != "1.0 client, 1.1 edge" {
+		t.Errorf("forwarded Via = %q; want the client's chain then 1.1 edge", seen)
+	}
+	if got := response.Header.Get("Via"); got != "1.0 upstream, 1.1 edge" {
+		t.Errorf("served Via = %q; want the origin's chain then 1.1 edge", got)
+	}
+}
+
+func TestViaDisabled(t *testing.T) {
+	var seen string
+	origin := viaOrigin(&seen, "")
+	defer origin.Close()
+
+	response := get(NewProxy().UseCachePath(t.TempDir()).UseViaName(""), origin.URL+"/via")
+	readBody(t, response)
+
+	if seen != "" || response.Header.Get("Via") != "" {
+		t.Errorf("Via = %q forwarded, %q served; want none", seen, response.Header.Get("Via"))
+	}
+}
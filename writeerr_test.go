@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// fullWriter fails as a full disk would; after taking some bytes.
+type fullWriter struct{ room int }
+
+func (writer *fullWriter) Write(data []byte) (int, error) {
+	if len(data) > writer.room {
+		n := writer.room
+		writer.room = 0
+		return n, syscall.ENOSPC
+	}
+
+	writer.room -= len(data)
+	return len(data), nil
+}
+
+func TestWriteBodyToRecordsError(t *testing.T) {
+	response := LoadResponse(&http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 4096))),
+	}, nil)
+
+	response.WriteBodyTo(&fullWriter{room: 100})
+	if err := response.Err(); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("Err() = %v; want the write error", err)
+	}
+}
+
+func TestStoreCacheRemovesPartialFile(t *testing.T) {
+	root := t.TempDir()
+	name := filepath.Join(root, "entry")
+
+	response := LoadResponse(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil).
+		SetCacheName(name)
+	response.proxy = NewProxy().UseCachePath(root)
+
+	file, err := createCacheFile(name)
+	if err != nil {
+		t.Fatalf("createCacheFile: %v", err)
+	}
+
+	// The disk filled partway through the entry.
+	file.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 4096\r\n\r\npart"))
+	response.storeCache(file, syscall.ENOSPC)
+
+	if err := response.Err(); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("Err() = %v; want the cache write error", err)
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("partial cache file left behind: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("partial cache file stored as the entry: %v", err)
+	}
+	if response.proxy.index.Has(root, name) {
+		t.Error("partial cache file still in the index")
+	}
+}
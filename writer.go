@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ErrWriteTimeout is returned once a client stalls past UseWriteTimeout.
+var ErrWriteTimeout = errors.New("proxy: write to client timed out")
+
+// timeoutWriter aborts writing to a client that stalls for longer than
+// the timeout; each write sets a deadline on the connection, and the write
+// failing past it is the abort. Writers without deadlines are not bounded.
+type timeoutWriter struct {
+	http.ResponseWriter
+	proxy   *Proxy
+	timeout time.Duration
+	err     error
+}
+
+func (writer *timeoutWriter) Write(data []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+
+	http.NewResponseController(writer.ResponseWriter).
+		SetWriteDeadline(time.Now().Add(writer.timeout))
+
+	n, err := writer.ResponseWriter.Write(data)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			proxyLog.WithFields(Fields{
+				"timeout": writer.timeout,
+			}).Warning("Aborting Write To Stalled Client")
+
+			writer.proxy.abortedWrites.Add(1)
+			err = ErrWriteTimeout
+		}
+
+		writer.err = err
+	}
+
+	return n, err
+}
+
+// Unwrap returns the http.ResponseWriter; for http.ResponseController.
+func (writer *timeoutWriter) Unwrap() http.ResponseWriter {
+	return writer.ResponseWriter
+}
+
+// Flush passes through to the http.ResponseWriter; so streams still flush.
+func (writer *timeoutWriter) Flush() {
+	if flusher, ok := writer.ResponseWriter.(http.Flusher); ok && writer.err == nil {
+		flusher.Flush()
+	}
+}
+
+// UseWriteTimeout sets how long a write to a client may stall before
+// serving it is aborted; freeing the response. Zero disables it.
+func (proxy *Proxy) UseWriteTimeout(timeout time.Duration) *Proxy {
+	defer proxy.configure()()
+	proxy.writeTimeout = timeout
+	return proxy
+}
+
+// AbortedWrites returns how many clients were
+// abandoned for stalling past UseWriteTimeout.
+func (proxy *Proxy) AbortedWrites() int64 {
+	return proxy.snapshot().abortedWrites.Load()
+}
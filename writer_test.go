@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowWriter never drains; each write blocks until its deadline passes.
+type slowWriter struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+	pending  atomic.Int32
+}
+
+func (writer *slowWriter) SetWriteDeadline(deadline time.Time) error {
+	writer.deadline = deadline
+	return nil
+}
+
+func (writer *slowWriter) Write(data []byte) (int, error) {
+	writer.pending.Add(1)
+	defer writer.pending.Add(-1)
+
+	time.Sleep(time.Until(writer.deadline))
+	return 0, os.ErrDeadlineExceeded
+}
+
+func TestWriteTimeoutAbortsSlowClient(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1<<20)))
+	}))
+	defer origin.Close()
+
+	proxy := NewProxy().UseCachePath(t.TempDir()).UseWriteTimeout(50 * time.Millisecond)
+	writer := &slowWriter{ResponseRecorder: httptest.NewRecorder()}
+
+	started := time.Now()
+	proxy.ServeHTTP(writer, newRequest("GET", origin.URL+"/slow", ""))
+	elapsed := time.Since(started)
+
+	if elapsed > 2*time.Second {
+		t.Errorf("ServeHTTP took %v; want it aborted after the timeout", elapsed)
+	}
+	if n := proxy.AbortedWrites(); n != 1 {
+		t.Errorf("AbortedWrites() = %d; want 1", n)
+	}
+	if n := writer.pending.Load(); n != 0 {
+		t.Errorf("%d writes still in flight after ServeHTTP returned", n)
+	}
+}
+
+func TestWriteTimeoutUnwraps(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := &timeoutWriter{ResponseWriter: recorder, timeout: time.Second}
+
+	if err := http.NewResponseController(writer).Flush(); err != nil {
+		t.Fatalf("Flush through the controller: %v", err)
+	}
+	if unwrapped := writer.Unwrap(); unwrapped != recorder {
+		t.Errorf("Unwrap() = %v; want the wrapped writer", unwrapped)
+	}
+}